@@ -2,12 +2,39 @@ package main
 
 import (
 	"image"
+	"io"
+	"math"
+	"os"
+	"sort"
 
+	mgl "github.com/go-gl/mathgl/mgl32"
 	"golang.org/x/mobile/gl"
 
 	"github.com/shazow/linerage3d/collision"
 )
 
+// Arena outlines which can be used instead of a rectangle.
+var (
+	hexagonArena = &collision.Outline{Loops: []collision.Loop{
+		collision.RegularPolygon(mgl.Vec2{0, 0}, 12, 6),
+	}}
+	ringArena = &collision.Outline{Loops: []collision.Loop{
+		collision.Circle{Center: mgl.Vec2{0, 0}, Radius: 12},
+		collision.Circle{Center: mgl.Vec2{0, 0}, Radius: 4},
+	}}
+	crossArena = &collision.Outline{Loops: []collision.Loop{
+		collision.Polygon{{-3, -12}, {3, -12}, {3, -3}, {12, -3}, {12, 3}, {3, 3}, {3, 12}, {-3, 12}, {-3, 3}, {-12, 3}, {-12, -3}, {-3, -3}},
+	}}
+)
+
+// Obstacles which can be placed in an arena, clear of where the line starts.
+var pillarObstacles = []*collision.Obstacle{
+	collision.Pillar(mgl.Vec2{-5, 5}, 1),
+	collision.Pillar(mgl.Vec2{5, -5}, 1),
+	collision.Wall(0.25, mgl.Vec2{-6, -3}, mgl.Vec2{-3, -6}),
+	collision.PolygonObstacle(mgl.Vec2{6, 3}, mgl.Vec2{8, 3}, mgl.Vec2{8, 5}, mgl.Vec2{6, 5}),
+}
+
 func NewArenaNode(bounds image.Rectangle, shader Shader) *arena {
 	shape := NewStaticShape()
 	shape.vertices = []float32{
@@ -26,6 +53,37 @@ func NewArenaNode(bounds image.Rectangle, shader Shader) *arena {
 	})
 }
 
+// NewOutlineArenaNode is NewArenaNode for an arena of any shape, with holes.
+func NewOutlineArenaNode(outline *collision.Outline, shader Shader) *arena {
+	shape := NewStaticShape()
+	shape.vertices = triangulate(outline)
+	shape.Buffer()
+
+	arena := newArena(outline.Bounds(), &Node{
+		Shape:  shape,
+		shader: shader,
+	})
+	arena.SetOutline(outline)
+	return arena
+}
+
+// NewChunkedArenaNode is NewArenaNode for an endless arena, which is split
+// into chunks around the lines. The floor only covers the chunks around the
+// heads of the lines passed to Follow, and the collider drops the rest along
+// with the trails in them.
+func NewChunkedArenaNode(opts collision.ChunkOptions, shader Shader) *arena {
+	arena := &arena{
+		Node: &Node{
+			Shape:  NewStaticShape(),
+			shader: shader,
+		},
+		Collider: collision.ChunkedCollider(opts),
+		chunks:   &opts,
+	}
+	arena.Reset()
+	return arena
+}
+
 func newArena(bounds image.Rectangle, node *Node) *arena {
 	arena := &arena{
 		Node:     node,
@@ -38,6 +96,136 @@ func newArena(bounds image.Rectangle, node *Node) *arena {
 type arena struct {
 	*Node
 	collision.Collider
+
+	// Walls of the obstacles, if there are any.
+	walls *StaticShape
+
+	// Chunks of an endless arena, and the ones around the heads of the lines
+	// which the floor covers.
+	chunks *collision.ChunkOptions
+	floor  []image.Rectangle
+}
+
+// Follow moves the floor of an endless arena along with the heads of lines,
+// covering the chunks around them. Bounded arenas stay where they are.
+func (arena *arena) Follow(lines ...[]mgl.Vec3) {
+	if arena.chunks == nil {
+		return
+	}
+	var floor []image.Rectangle
+	for _, segments := range lines {
+		var head []mgl.Vec3
+		for i := len(segments) - 1; i >= 0 && len(head) < 2; i-- {
+			if !collision.IsBreak(segments[i]) {
+				head = append(head, segments[i])
+			}
+		}
+		switch len(head) {
+		case 1:
+			floor = append(floor, arena.chunks.Around(head[0], head[0]))
+		case 2:
+			floor = append(floor, arena.chunks.Around(head[1], head[0]))
+		}
+	}
+	if sameChunks(floor, arena.floor) {
+		return
+	}
+	arena.floor = floor
+
+	shape := arena.Shape.(*StaticShape)
+	shape.vertices = chunkFloor(*arena.chunks, floor)
+	shape.Buffer()
+}
+
+func sameChunks(a, b []image.Rectangle) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkFloor returns the vertices of a quad for each chunk in any of the
+// rectangles, once each.
+func chunkFloor(opts collision.ChunkOptions, rects []image.Rectangle) []float32 {
+	var vertices []float32
+	for i, r := range rects {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				p := image.Pt(x, y)
+				seen := false
+				for _, other := range rects[:i] {
+					if p.In(other) {
+						seen = true
+						break
+					}
+				}
+				if seen {
+					continue
+				}
+				b := opts.Bounds(p)
+				vertices = append(vertices,
+					b.X1, 0, b.Y1,
+					b.X2, 0, b.Y1,
+					b.X2, 0, b.Y2,
+					b.X2, 0, b.Y2,
+					b.X1, 0, b.Y1,
+					b.X1, 0, b.Y2,
+				)
+			}
+		}
+	}
+	return vertices
+}
+
+// SetObstacles places obstacles in the arena, and builds the walls which are
+// drawn for them.
+func (arena *arena) SetObstacles(obstacles []*collision.Obstacle) {
+	arena.Collider.SetObstacles(obstacles)
+	if arena.walls != nil {
+		arena.walls.Close()
+		arena.walls = nil
+	}
+	if len(obstacles) == 0 {
+		return
+	}
+	arena.walls = NewStaticShape()
+	arena.walls.vertices, arena.walls.normals = extrudeObstacles(obstacles)
+	arena.walls.Buffer()
+}
+
+// Pixels per world unit of pictures of the arena.
+const pictureScale = 20
+
+// SavePicture writes a picture of the arena and its lines from above, as
+// seen by the collider, to path with .png and .svg added. It returns the
+// path of the PNG.
+func (arena *arena) SavePicture(path string) (string, error) {
+	pic := arena.Picture()
+	if err := writeFile(path+".svg", func(w io.Writer) error {
+		return pic.WriteSVG(w, pictureScale)
+	}); err != nil {
+		return "", err
+	}
+	return path + ".png", writeFile(path+".png", func(w io.Writer) error {
+		return pic.WritePNG(w, pictureScale)
+	})
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
 func (shape *arena) Draw(camera Camera) {
@@ -52,4 +240,235 @@ func (shape *arena) Draw(camera Camera) {
 	gl.Uniform3fv(shader.Uniform("lights[1].color"), []float32{0.05, 0.0, 0.1})
 
 	shape.Node.Draw(camera)
+	if shape.walls != nil {
+		shape.walls.Draw(shader, camera)
+	}
+}
+
+// Number of points around curved edges of the floor.
+const arenaCurvePoints = 64
+
+// triangulate returns the vertices of triangles covering the floor of an
+// outline, by joining each hole to the outer loop and clipping ears off the
+// resulting polygon.
+func triangulate(outline *collision.Outline) []float32 {
+	if len(outline.Loops) == 0 {
+		return nil
+	}
+	poly := outline.Loops[0].Polygon(arenaCurvePoints)
+
+	// Holes go clockwise, and are joined from the rightmost one
+	holes := make([][]mgl.Vec2, 0, len(outline.Loops)-1)
+	for _, loop := range outline.Loops[1:] {
+		hole := loop.Polygon(arenaCurvePoints)
+		for i, j := 0, len(hole)-1; i < j; i, j = i+1, j-1 {
+			hole[i], hole[j] = hole[j], hole[i]
+		}
+		holes = append(holes, hole)
+	}
+	sort.Slice(holes, func(i, j int) bool {
+		return holes[i][rightmost(holes[i])][0] > holes[j][rightmost(holes[j])][0]
+	})
+	for i, hole := range holes {
+		poly = bridgeHole(poly, hole, holes[i+1:])
+	}
+
+	var vertices []float32
+	for _, tri := range clipEars(poly) {
+		for _, p := range tri {
+			vertices = append(vertices, p[0], 0, p[1])
+		}
+	}
+	return vertices
+}
+
+func rightmost(points []mgl.Vec2) int {
+	r := 0
+	for i, p := range points {
+		if p[0] > points[r][0] {
+			r = i
+		}
+	}
+	return r
+}
+
+// cross2 returns the cross product of a -> b and a -> c, which is positive if
+// a, b, c turn counter-clockwise.
+func cross2(a, b, c mgl.Vec2) float32 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// bridgeHole joins hole into poly through a pair of edges between the
+// rightmost point of the hole and the nearest point of poly that it can see
+// without crossing poly or any of the other holes.
+func bridgeHole(poly, hole []mgl.Vec2, others [][]mgl.Vec2) []mgl.Vec2 {
+	m := hole[rightmost(hole)]
+	crosses := func(a, b mgl.Vec2, loop []mgl.Vec2) bool {
+		for i, c := range loop {
+			d := loop[(i+1)%len(loop)]
+			if c == a || c == b || d == a || d == b {
+				continue
+			}
+			if cross2(a, b, c)*cross2(a, b, d) < 0 && cross2(c, d, a)*cross2(c, d, b) < 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	best := -1
+	var bestDist float32
+	for j, p := range poly {
+		dist := p.Sub(m).Len()
+		if best >= 0 && dist >= bestDist {
+			continue
+		}
+		if crosses(m, p, poly) || crosses(m, p, hole) {
+			continue
+		}
+		blocked := false
+		for _, other := range others {
+			if crosses(m, p, other) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			best, bestDist = j, dist
+		}
+	}
+	if best < 0 {
+		return poly
+	}
+
+	start := rightmost(hole)
+	merged := make([]mgl.Vec2, 0, len(poly)+len(hole)+2)
+	merged = append(merged, poly[:best+1]...)
+	for i := 0; i <= len(hole); i++ {
+		merged = append(merged, hole[(start+i)%len(hole)])
+	}
+	merged = append(merged, poly[best:]...)
+	return merged
+}
+
+// clipEars triangulates a counter-clockwise polygon, which may touch itself
+// where holes were bridged.
+func clipEars(poly []mgl.Vec2) [][3]mgl.Vec2 {
+	points := append([]mgl.Vec2{}, poly...)
+	var tris [][3]mgl.Vec2
+
+	isEar := func(i int) bool {
+		n := len(points)
+		a, b, c := points[(i+n-1)%n], points[i], points[(i+1)%n]
+		if cross2(a, b, c) <= 0 {
+			return false
+		}
+		for _, p := range points {
+			if p == a || p == b || p == c {
+				continue
+			}
+			if cross2(a, b, p) >= 0 && cross2(b, c, p) >= 0 && cross2(c, a, p) >= 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for len(points) > 3 {
+		n := len(points)
+		ear := -1
+		for i := 0; i < n; i++ {
+			if isEar(i) {
+				ear = i
+				break
+			}
+		}
+		if ear < 0 {
+			// Only degenerate corners are left, clip the most convex one
+			ear = 0
+			for i := 1; i < n; i++ {
+				if cross2(points[(i+n-1)%n], points[i], points[(i+1)%n]) > cross2(points[(ear+n-1)%n], points[ear], points[(ear+1)%n]) {
+					ear = i
+				}
+			}
+		}
+		a, b, c := points[(ear+n-1)%n], points[ear], points[(ear+1)%n]
+		if cross2(a, b, c) > 0 {
+			tris = append(tris, [3]mgl.Vec2{a, b, c})
+		}
+		points = append(points[:ear], points[ear+1:]...)
+	}
+	if len(points) == 3 && cross2(points[0], points[1], points[2]) > 0 {
+		tris = append(tris, [3]mgl.Vec2{points[0], points[1], points[2]})
+	}
+	return tris
+}
+
+// Obstacles are drawn as tall as the lines.
+const wallHeight = 1.0
+
+// Number of points around each round end of thick walls.
+const wallCapPoints = 8
+
+// extrudeObstacles returns the vertices and normals of triangles for the walls
+// of obstacles. Thin walls are flat, and thick walls are the outline of their
+// capsule with a lid on top.
+func extrudeObstacles(obstacles []*collision.Obstacle) (vertices, normals []float32) {
+	side := func(p0, p1 mgl.Vec2, normal mgl.Vec2) {
+		for _, v := range [][3]float32{
+			{p0[0], 0, p0[1]}, {p1[0], 0, p1[1]}, {p1[0], wallHeight, p1[1]},
+			{p1[0], wallHeight, p1[1]}, {p0[0], wallHeight, p0[1]}, {p0[0], 0, p0[1]},
+		} {
+			vertices = append(vertices, v[:]...)
+			normals = append(normals, normal[0], 0, normal[1])
+		}
+	}
+
+	for _, obstacle := range obstacles {
+		obstacle.Segments(func(a3, b3 mgl.Vec3) {
+			a, b := mgl.Vec2{a3[0], a3[2]}, mgl.Vec2{b3[0], b3[2]}
+			dir := b.Sub(a)
+			if dir.Len() > 0 {
+				dir = dir.Normalize()
+			} else {
+				dir = mgl.Vec2{1, 0}
+			}
+			left := mgl.Vec2{-dir[1], dir[0]}
+
+			if obstacle.Radius <= 0 {
+				side(a, b, left)
+				return
+			}
+
+			// Around the capsule counter-clockwise, from the right of b
+			var footprint []mgl.Vec2
+			arc := func(center mgl.Vec2, from float64) {
+				for i := 0; i <= wallCapPoints; i++ {
+					angle := from + math.Pi*float64(i)/wallCapPoints
+					sin, cos := math.Sincos(angle)
+					d := dir.Mul(float32(cos)).Add(left.Mul(float32(sin)))
+					footprint = append(footprint, center.Add(d.Mul(obstacle.Radius)))
+				}
+			}
+			arc(b, -math.Pi/2)
+			arc(a, math.Pi/2)
+
+			for i, p0 := range footprint {
+				p1 := footprint[(i+1)%len(footprint)]
+				edge := p1.Sub(p0)
+				if edge.Len() == 0 {
+					continue
+				}
+				side(p0, p1, mgl.Vec2{edge[1], -edge[0]}.Normalize())
+			}
+			// The footprint is convex, so the lid is a fan
+			for i := 1; i+1 < len(footprint); i++ {
+				for _, p := range []mgl.Vec2{footprint[0], footprint[i], footprint[i+1]} {
+					vertices = append(vertices, p[0], wallHeight, p[1])
+					normals = append(normals, 0, 1, 0)
+				}
+			}
+		})
+	}
+	return vertices, normals
 }
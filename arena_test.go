@@ -0,0 +1,99 @@
+package main
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+
+	"github.com/shazow/linerage3d/collision"
+)
+
+func TestTriangulate(t *testing.T) {
+	for name, outline := range map[string]*collision.Outline{
+		"hexagon": hexagonArena,
+		"ring":    ringArena,
+		"cross":   crossArena,
+		"cross with a hole": {Loops: []collision.Loop{
+			crossArena.Loops[0],
+			collision.Polygon{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}},
+		}},
+	} {
+		expected := polygonArea(outline.Loops[0].Polygon(arenaCurvePoints))
+		for _, hole := range outline.Loops[1:] {
+			expected -= polygonArea(hole.Polygon(arenaCurvePoints))
+		}
+
+		vertices := triangulate(outline)
+		if len(vertices)%9 != 0 {
+			t.Fatalf("%s: expected whole triangles; got %d floats", name, len(vertices))
+		}
+		var area float64
+		for i := 0; i < len(vertices); i += 9 {
+			tri := []mgl.Vec2{{vertices[i], vertices[i+2]}, {vertices[i+3], vertices[i+5]}, {vertices[i+6], vertices[i+8]}}
+			a := polygonArea(tri)
+			if a <= 0 {
+				t.Errorf("%s: expected counter-clockwise triangle; got %v", name, tri)
+			}
+			center := tri[0].Add(tri[1]).Add(tri[2]).Mul(1.0 / 3)
+			if !outline.Contains(center[0], center[1]) {
+				t.Errorf("%s: expected triangle within the outline; got %v", name, tri)
+			}
+			area += a
+		}
+		if math.Abs(area-expected) > 1e-3*expected {
+			t.Errorf("%s: expected area %v; got %v", name, expected, area)
+		}
+	}
+}
+
+func TestExtrudeObstacles(t *testing.T) {
+	vertices, normals := extrudeObstacles(pillarObstacles)
+	if len(vertices) == 0 || len(vertices)%9 != 0 || len(normals) != len(vertices) {
+		t.Fatalf("expected whole triangles with a normal each; got %d vertices and %d normals", len(vertices), len(normals))
+	}
+	for i := 0; i < len(vertices); i += 3 {
+		if y := vertices[i+1]; y != 0 && y != wallHeight {
+			t.Errorf("expected vertex on the floor or the top of the wall; got %v", vertices[i:i+3])
+		}
+		if l := (mgl.Vec3{normals[i], normals[i+1], normals[i+2]}).Len(); !mgl.FloatEqualThreshold(l, 1, 1e-5) {
+			t.Errorf("expected unit normal; got %v", normals[i:i+3])
+		}
+	}
+
+	// The sides of a pillar face away from its center
+	pillar := pillarObstacles[0]
+	center := mgl.Vec2{pillar.Points[0][0], pillar.Points[0][1]}
+	vertices, normals = extrudeObstacles(pillarObstacles[:1])
+	for i := 0; i < len(vertices); i += 3 {
+		if normals[i+1] != 0 {
+			continue
+		}
+		out := mgl.Vec2{vertices[i], vertices[i+2]}.Sub(center)
+		if out.Dot(mgl.Vec2{normals[i], normals[i+2]}) <= 0 {
+			t.Errorf("expected side facing out of the pillar; got normal %v at %v", normals[i:i+3], vertices[i:i+3])
+		}
+	}
+}
+
+func TestChunkFloor(t *testing.T) {
+	opts := collision.ChunkOptions{Size: 4, Keep: 1}
+	// Two lines whose chunks overlap by a column
+	rects := []image.Rectangle{
+		opts.Around(mgl.Vec3{1, 0, 1}, mgl.Vec3{3, 0, 1}),
+		opts.Around(mgl.Vec3{9, 0, 1}, mgl.Vec3{9, 0, 2}),
+	}
+	vertices := chunkFloor(opts, rects)
+	if len(vertices) != 5*3*18 {
+		t.Fatalf("expected a quad for each of 15 chunks; got %d floats", len(vertices))
+	}
+	var area float64
+	for i := 0; i < len(vertices); i += 9 {
+		tri := []mgl.Vec2{{vertices[i], vertices[i+2]}, {vertices[i+3], vertices[i+5]}, {vertices[i+6], vertices[i+8]}}
+		area += math.Abs(polygonArea(tri))
+	}
+	if area != 15*4*4 {
+		t.Errorf("expected the floor to cover the chunks once; got area %v", area)
+	}
+}
@@ -0,0 +1,259 @@
+package collision
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+var benchColliders = []struct {
+	name        string
+	newCollider func(image.Rectangle) Collider
+}{
+	{"Linear", LinearCollider},
+	{"Grid", GridCollider},
+	{"Quadtree", QuadtreeCollider},
+}
+
+// serpentine returns a trail of n segments which zigzags back and forth in
+// rows of the given width without ever crossing itself.
+func serpentine(n int, width int) []mgl.Vec3 {
+	trail := make([]mgl.Vec3, 0, n+1)
+	for i := 0; i <= n; i++ {
+		row, col := i/width, i%width
+		if row%2 == 1 {
+			col = width - col - 1
+		}
+		trail = append(trail, mgl.Vec3{float32(col) + 0.5, 0, float32(row) + 0.25 + 0.5*float32(i%2)})
+	}
+	return trail
+}
+
+// trackAll registers every segment of trail with the collider, one point at
+// a time like a line being drawn.
+func trackAll(collider Collider, trail []mgl.Vec3) *[]mgl.Vec3 {
+	segment := []mgl.Vec3{}
+	tracker := collider.Track(&segment)
+	if _, ok := collider.(*linearCollider); ok {
+		// Nothing to register, skip the O(N^2) replay
+		segment = trail
+		return &segment
+	}
+	for i := range trail {
+		segment = trail[:i+1]
+		tracker.Update()
+	}
+	return &segment
+}
+
+// benchmarkUpdate measures the cost of updating a short line at random
+// positions within an arena filled with n segments.
+func benchmarkUpdate(b *testing.B, newCollider func(image.Rectangle) Collider, n int) {
+	width := int(math.Sqrt(float64(n)))
+	height := n/width + 1
+	collider := newCollider(image.Rect(-1, -1, width+1, height+1))
+	trackAll(collider, serpentine(n, width))
+
+	probe := []mgl.Vec3{{}, {}}
+	tracker := collider.Track(&probe)
+	rng := rand.New(rand.NewSource(42))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x, y := rng.Float32()*float32(width-1), rng.Float32()*float32(height-1)
+		probe[0] = mgl.Vec3{x, 0, y}
+		probe[1] = mgl.Vec3{x + 0.7, 0, y + 0.3}
+		tracker.Update()
+	}
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	for _, n := range []int{10000, 100000, 1000000} {
+		for _, c := range benchColliders {
+			b.Run(fmt.Sprintf("%s/%d", c.name, n), func(b *testing.B) {
+				benchmarkUpdate(b, c.newCollider, n)
+			})
+		}
+	}
+}
+
+// benchmarkGridLayout measures the memory retained by a grid holding a
+// serpentine trail of n segments scaled down by scale, and the cost of
+// updating a short line at random positions along it.
+func benchmarkGridLayout(b *testing.B, bounds image.Rectangle, opts GridOptions, n int, scale float32) {
+	width := int(math.Sqrt(float64(n)))
+	height := n/width + 1
+	trail := serpentine(n, width)
+	for i := range trail {
+		trail[i] = trail[i].Mul(scale)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	collider := NewGridCollider(bounds, opts)
+	trackAll(collider, trail)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	probe := []mgl.Vec3{{}, {}}
+	tracker := collider.Track(&probe)
+	rng := rand.New(rand.NewSource(42))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x, y := rng.Float32()*float32(width-1)*scale, rng.Float32()*float32(height-1)*scale
+		probe[0] = mgl.Vec3{x, 0, y}
+		probe[1] = mgl.Vec3{x + 0.7*scale, 0, y + 0.3*scale}
+		tracker.Update()
+	}
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc)), "heap-B")
+}
+
+// BenchmarkGridLayout compares dense and sparse grids of different cell sizes
+// in a huge arena where the trails only cover a corner, and in a tiny arena
+// where the trails need sub-unit precision.
+func BenchmarkGridLayout(b *testing.B) {
+	arenas := []struct {
+		name   string
+		bounds image.Rectangle
+		scale  float32
+		sizes  []float32
+	}{
+		{"Huge", image.Rect(-1, -1, 1000, 1000), 1, []float32{1, 4}},
+		{"Tiny", image.Rect(-1, -1, 3, 3), 0.02, []float32{1, 0.05}},
+	}
+	for _, arena := range arenas {
+		for _, size := range arena.sizes {
+			for _, sparse := range []bool{false, true} {
+				layout := "Dense"
+				if sparse {
+					layout = "Sparse"
+				}
+				opts := GridOptions{CellSize: size, Sparse: sparse}
+				b.Run(fmt.Sprintf("%s/%s/%v", arena.name, layout, size), func(b *testing.B) {
+					benchmarkGridLayout(b, arena.bounds, opts, 10000, arena.scale)
+				})
+			}
+		}
+	}
+}
+
+// drawTrail draws trail with a single tracked line like Line does, extending
+// each segment in steps before turning onto the next.
+func drawTrail(collider Collider, trail []mgl.Vec3, steps int) {
+	segment := []mgl.Vec3{trail[0]}
+	tracker := collider.Track(&segment)
+	for i := 1; i < len(trail); i++ {
+		from := trail[i-1]
+		segment = append(segment, from)
+		for step := 1; step <= steps; step++ {
+			segment[len(segment)-1] = lerp(from, trail[i], float32(step)/float32(steps))
+			tracker.Update()
+		}
+	}
+}
+
+// BenchmarkTrail measures the cost per update of drawing trails of increasing
+// length from scratch.
+func BenchmarkTrail(b *testing.B) {
+	const steps = 4
+	for _, n := range []int{100, 1000, 10000} {
+		width := int(math.Sqrt(float64(n)))
+		trail := serpentine(n, width)
+		bounds := image.Rect(-1, -1, width+1, n/width+2)
+		for _, c := range benchColliders {
+			if c.name == "Linear" && n > 1000 {
+				// Quadratic, a single run takes several seconds
+				continue
+			}
+			b.Run(fmt.Sprintf("%s/%d", c.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					drawTrail(c.newCollider(bounds), trail, steps)
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n*steps), "ns/update")
+			})
+		}
+	}
+}
+
+// BenchmarkExtend measures the cost per update of extending a single straight
+// run of increasing length, which should stay the same.
+func BenchmarkExtend(b *testing.B) {
+	const step = 0.05
+	colliders := []struct {
+		name        string
+		newCollider func(image.Rectangle) Collider
+	}{
+		{"Grid", GridCollider},
+		{"GridFullWalk", func(bounds image.Rectangle) Collider {
+			return fullWalkGrid(bounds, GridOptions{})
+		}},
+	}
+	for _, length := range []int{10, 100, 1000} {
+		bounds := image.Rect(-1, -1, length+1, 1)
+		for _, c := range colliders {
+			b.Run(fmt.Sprintf("%s/%d", c.name, length), func(b *testing.B) {
+				updates := 0
+				for i := 0; i < b.N; i++ {
+					segment := []mgl.Vec3{{0, 0, 0.5}, {0, 0, 0.5}}
+					tracker := c.newCollider(bounds).Track(&segment)
+					for x := float32(step); x < float32(length); x += step {
+						segment[1][0] = x
+						tracker.Update()
+						updates++
+					}
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(updates), "ns/update")
+			})
+		}
+	}
+}
+
+// BenchmarkUpdateAll compares updating a crowd of short lines at random
+// positions one after another, and all at once with UpdateAll, within an
+// arena filled with segments.
+func BenchmarkUpdateAll(b *testing.B) {
+	const n, crowd = 10000, 64
+	width := int(math.Sqrt(float64(n)))
+	height := n/width + 1
+	for _, c := range benchColliders {
+		collider := c.newCollider(image.Rect(-1, -1, width+1, height+1))
+		trackAll(collider, serpentine(n, width))
+
+		probes := make([][]mgl.Vec3, crowd)
+		trackers := make([]Tracker, crowd)
+		for i := range probes {
+			probes[i] = []mgl.Vec3{{}, {}}
+			trackers[i] = collider.Track(&probes[i])
+		}
+		rng := rand.New(rand.NewSource(42))
+		move := func() {
+			for _, probe := range probes {
+				x, y := rng.Float32()*float32(width-1), rng.Float32()*float32(height-1)
+				probe[0] = mgl.Vec3{x, 0, y}
+				probe[1] = mgl.Vec3{x + 0.7, 0, y + 0.3}
+			}
+		}
+
+		b.Run(c.name+"/Sequential", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				move()
+				for _, tracker := range trackers {
+					tracker.Update()
+				}
+			}
+		})
+		b.Run(c.name+"/Parallel", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				move()
+				collider.UpdateAll(trackers)
+			}
+		})
+	}
+}
@@ -0,0 +1,721 @@
+package collision
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// ChunkOptions configures a chunked collider.
+type ChunkOptions struct {
+	// Size is the width and height of each chunk in world units, 16 if unset.
+	Size float32
+	// Keep is how many chunks are kept on every side of the chunks that the
+	// head segment of a line is in, 2 if unset.
+	Keep int
+}
+
+func (opts ChunkOptions) withDefaults() ChunkOptions {
+	if opts.Size <= 0 {
+		opts.Size = 16
+	}
+	if opts.Keep <= 0 {
+		opts.Keep = 2
+	}
+	return opts
+}
+
+// Chunk returns the chunk containing x, z. Points on the edge between chunks
+// are in the chunk after it.
+func (opts ChunkOptions) Chunk(x, z float32) image.Point {
+	opts = opts.withDefaults()
+	return image.Pt(int(math.Floor(float64(x/opts.Size))), int(math.Floor(float64(z/opts.Size))))
+}
+
+// Bounds returns the area of the arena that chunk covers.
+func (opts ChunkOptions) Bounds(chunk image.Point) Boundary {
+	opts = opts.withDefaults()
+	x, y := float32(chunk.X)*opts.Size, float32(chunk.Y)*opts.Size
+	return Boundary{x, y, x + opts.Size, y + opts.Size}
+}
+
+// Around returns the chunks which are kept around the head segment a -> b of a
+// line.
+func (opts ChunkOptions) Around(a, b mgl.Vec3) image.Rectangle {
+	opts = opts.withDefaults()
+	return opts.chunks(segmentBox(a, b)).Inset(-opts.Keep)
+}
+
+// chunks returns the chunks which r overlaps.
+func (opts ChunkOptions) chunks(r box) image.Rectangle {
+	min, max := opts.Chunk(r.minX, r.minY), opts.Chunk(r.maxX, r.maxY)
+	return image.Rectangle{Min: min, Max: max.Add(image.Pt(1, 1))}
+}
+
+// ChunkedCollider is a collision checker for an endless arena, which is split
+// into square chunks that are only kept around the lines. Chunks are created
+// as lines reach them, and dropped once they're further than Keep chunks from
+// the head segment of every line, so that memory stays flat however far the
+// lines go. Lines are trimmed like Tracker.Trim up to the last segment that
+// was in a dropped chunk, so that nothing is left of a trail that can't be hit,
+// and EventTrimmed is sent for them. There's no edge unless there's an
+// outline.
+func ChunkedCollider(opts ChunkOptions) Collider {
+	collider := &chunkCollider{
+		opts: opts.withDefaults(),
+	}
+	collider.SetOutline(nil)
+	collider.Reset()
+	return collider
+}
+
+type chunkCollider struct {
+	opts      ChunkOptions
+	edge      boundary
+	obstacles obstacles
+	chunks    map[image.Point]*chunk
+
+	// Chunks around the heads of lines when chunks were last dropped, or nil
+	// to drop them again whatever the lines did. Lines which reach far beyond
+	// their head can register chunks outside of them, which are dropped once
+	// any line moves on to other chunks.
+	kept []image.Rectangle
+
+	// Height of the walls of trails, or 0 to ignore heights.
+	wallHeight float32
+
+	// Intersect segments in fixed-point, see SetReproducible.
+	reproducible bool
+
+	// Boxes which were registered or removed during UpdateAll.
+	batch []box
+
+	// Subscribers to events.
+	hooks
+
+	// Every line tracked since the last reset, by ID.
+	tracked    []*chunkTracker
+	numTracked int
+}
+
+// UpdateAll drops chunks once before the trackers are checked, rather than
+// on every update.
+func (collider *chunkCollider) UpdateAll(trackers []Tracker) []error {
+	collider.drop()
+	collider.batch = []box{}
+	defer func() { collider.batch = nil }()
+	return updateAll(collider, trackers)
+}
+
+func (collider *chunkCollider) UpdateTick(trackers []Tracker, rule TickRule) []error {
+	return updateTick(collider, &collider.hooks, collider.wallHeight, collider.reproducible, trackers, rule)
+}
+
+// changed notes that r was registered or removed, if it's during UpdateAll.
+func (collider *chunkCollider) changed(r box) {
+	if collider.batch != nil {
+		collider.batch = append(collider.batch, r)
+	}
+}
+
+func (collider *chunkCollider) SetOutline(outline *Outline) {
+	collider.edge = unbounded{}
+	if outline != nil {
+		collider.edge = outline
+	}
+}
+
+// SetWrap only removes any outline, since there's nothing to wrap around.
+func (collider *chunkCollider) SetWrap(wrap bool) {
+	collider.edge = unbounded{}
+}
+
+func (collider *chunkCollider) SetWallHeight(height float32) {
+	collider.wallHeight = height
+}
+
+func (collider *chunkCollider) SetReproducible(reproducible bool) {
+	collider.reproducible = reproducible
+}
+
+func (collider *chunkCollider) SetObstacles(obs []*Obstacle) {
+	collider.obstacles = obs
+}
+
+func (collider *chunkCollider) Reset() {
+	collider.chunks = map[image.Point]*chunk{}
+	collider.kept = nil
+	collider.tracked = nil
+	collider.numTracked = 0
+	collider.collision = nil
+}
+
+// sorted returns the chunks in order of row, then column.
+func (collider *chunkCollider) sorted() []image.Point {
+	keys := make([]image.Point, 0, len(collider.chunks))
+	for p := range collider.chunks {
+		keys = append(keys, p)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Y != keys[j].Y {
+			return keys[i].Y < keys[j].Y
+		}
+		return keys[i].X < keys[j].X
+	})
+	return keys
+}
+
+// Picture covers the chunks and the lines, and shows the chunks as cells.
+func (collider *chunkCollider) Picture() *Picture {
+	var bounds *Boundary
+	grow := func(b Boundary) {
+		if bounds == nil {
+			bounds = &b
+			return
+		}
+		bounds.X1, bounds.Y1 = minf(bounds.X1, b.X1), minf(bounds.Y1, b.Y1)
+		bounds.X2, bounds.Y2 = maxf(bounds.X2, b.X2), maxf(bounds.Y2, b.Y2)
+	}
+	var cells []Boundary
+	for _, p := range collider.sorted() {
+		cell := collider.opts.Bounds(p)
+		cells = append(cells, cell)
+		grow(cell)
+	}
+	for _, tracker := range collider.tracked {
+		if tracker.closed {
+			continue
+		}
+		for _, p := range *tracker.segment {
+			if !IsBreak(p) {
+				grow(Boundary{p[0], p[2], p[0], p[2]})
+			}
+		}
+	}
+	if bounds == nil {
+		b := collider.opts.Bounds(image.Point{})
+		bounds = &b
+	}
+
+	pic := newPicture(*bounds, collider.edge, collider.obstacles, &collider.hooks)
+	for _, tracker := range collider.tracked {
+		if !tracker.closed {
+			pic.line(tracker.id, tracker.radius, *tracker.segment)
+		}
+	}
+	pic.Cells = cells
+	return pic
+}
+
+func (collider *chunkCollider) String() string {
+	w := &bytes.Buffer{}
+	for _, p := range collider.sorted() {
+		fmt.Fprintf(w, "[%d,%d] %v\n", p.X, p.Y, *collider.chunks[p])
+	}
+	return w.String()
+}
+
+func (collider *chunkCollider) Track(segment *[]mgl.Vec3) Tracker {
+	return collider.TrackRadius(segment, 0)
+}
+
+func (collider *chunkCollider) TrackRadius(segment *[]mgl.Vec3, radius float32) Tracker {
+	tracker := &chunkTracker{
+		trackedLine: newTrackedLine(collider, segment, collider.numTracked, radius),
+		collider:    collider,
+		head:        -1,
+	}
+	collider.tracked = append(collider.tracked, tracker)
+	collider.numTracked += 1
+	collider.kept = nil
+	return tracker
+}
+
+func (collider *chunkCollider) Untrack(t Tracker) {
+	tracker, ok := t.(*chunkTracker)
+	if !ok || tracker.collider != collider || tracker.closed {
+		return
+	}
+	segment := *tracker.segment
+	for i := 0; i+1 < len(segment); i++ {
+		collider.unregister(tracker, tracker.trimmed+i, segment[i], segment[i+1])
+	}
+	tracker.closed = true
+	tracker.head = -1
+	// Its chunks are only kept for the other lines now
+	collider.kept = nil
+}
+
+// register adds the segment to every chunk that r overlaps, creating those
+// around the heads as needed, so that a head which is registered again as it's
+// extended doesn't bring back the chunks which were dropped behind it.
+func (collider *chunkCollider) register(cs chunkSegment, r box) {
+	area := collider.opts.chunks(r)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			p := image.Pt(x, y)
+			c, ok := collider.chunks[p]
+			if !ok {
+				if collider.kept != nil && !collider.isKept(p) {
+					continue
+				}
+				c = &chunk{}
+				collider.chunks[p] = c
+			}
+			c.add(cs)
+		}
+	}
+	collider.changed(r)
+}
+
+// unregister removes the tracker's segment at offset, which is a -> b, from
+// the chunks it overlaps, and drops any chunks that are left empty. Gaps were
+// never registered. A head which was registered before it moved elsewhere,
+// such as in a gap, can be left behind in other chunks, which forget it once
+// it's no longer available.
+func (collider *chunkCollider) unregister(tracker *chunkTracker, offset int, a, b mgl.Vec3) {
+	if isGap(a, b) {
+		return
+	}
+	r := segmentBox(a, b).grow(tracker.radius)
+	area := collider.opts.chunks(r)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			p := image.Pt(x, y)
+			c, ok := collider.chunks[p]
+			if !ok {
+				continue
+			}
+			if c.remove(chunkSegment{tracker, offset}); len(*c) == 0 {
+				delete(collider.chunks, p)
+			}
+		}
+	}
+	collider.changed(r)
+}
+
+// each calls fn with every segment in the chunks that r overlaps, in order of
+// the chunks. Segments which are in several of them are seen more than once.
+func (collider *chunkCollider) each(r box, fn func(cs chunkSegment)) {
+	area := collider.opts.chunks(r)
+	if area.Dx()*area.Dy() > len(collider.chunks) {
+		// There are fewer chunks than the area covers, such as for a long ray
+		for _, p := range collider.sorted() {
+			if p.In(area) {
+				for _, cs := range *collider.chunks[p] {
+					fn(cs)
+				}
+			}
+		}
+		return
+	}
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if c, ok := collider.chunks[image.Pt(x, y)]; ok {
+				for _, cs := range *c {
+					fn(cs)
+				}
+			}
+		}
+	}
+}
+
+func (collider *chunkCollider) isKept(p image.Point) bool {
+	for _, r := range collider.kept {
+		if p.In(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// drop drops the chunks which are no longer around the head of any line, and
+// trims the lines which passed through them up to the last segment that did,
+// but never past the oldest segment still in a kept chunk, so that a line
+// which loops back keeps the trail in front of it. Segments after that which
+// were only in dropped chunks stay on the line, though nothing collides with
+// them until they're trimmed. Nothing is dropped until the lines move on to
+// other chunks, so that updating lines one after another drops the same
+// chunks as UpdateAll.
+func (collider *chunkCollider) drop() {
+	kept := []image.Rectangle{}
+	for _, tracker := range collider.tracked {
+		if r, ok := tracker.around(); ok {
+			kept = append(kept, r)
+		}
+	}
+	if collider.kept != nil && sameRects(kept, collider.kept) {
+		return
+	}
+	collider.kept = kept
+
+	trim := map[*chunkTracker]int{}
+	oldest := map[*chunkTracker]int{}
+	for _, p := range collider.sorted() {
+		if collider.isKept(p) {
+			for _, cs := range *collider.chunks[p] {
+				if _, _, ok := cs.Points(); !ok {
+					continue
+				}
+				if n, ok := oldest[cs.tracker]; !ok || cs.offset < n {
+					oldest[cs.tracker] = cs.offset
+				}
+			}
+			continue
+		}
+		for _, cs := range *collider.chunks[p] {
+			if _, _, ok := cs.Points(); ok && cs.offset+1 > trim[cs.tracker] {
+				trim[cs.tracker] = cs.offset + 1
+			}
+		}
+		delete(collider.chunks, p)
+		b := collider.opts.Bounds(p)
+		collider.changed(box{b.X1, b.Y1, b.X2, b.Y2})
+	}
+
+	for _, tracker := range collider.tracked {
+		n, ok := trim[tracker]
+		if !ok {
+			continue
+		}
+		if m, ok := oldest[tracker]; ok && m < n {
+			n = m
+		}
+		trimmed := tracker.trimmed
+		tracker.Trim(n - tracker.trimmed)
+		if tracker.trimmed != trimmed {
+			collider.trimmed(tracker.id, (*tracker.segment)[0])
+		}
+	}
+}
+
+func sameRects(a, b []image.Rectangle) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (collider *chunkCollider) Nearest(point mgl.Vec3, radius float32) *Proximity {
+	return collider.nearest(nil, point, point, radius)
+}
+
+func (collider *chunkCollider) nearest(self *chunkTracker, p0, p1 mgl.Vec3, radius float32) *Proximity {
+	skip, clip := -1, float32(0)
+	if self != nil {
+		skip, clip = nearSkip(*self.segment, radius)
+		skip += self.trimmed
+	}
+
+	// Ties go to the lowest line ID and offset, like the quadtree
+	near, nearOffset := collider.obstacles.proximity(p0, p1, radius), -1
+	collider.each(segmentBox(p0, p1).grow(radius), func(cs chunkSegment) {
+		if cs.tracker == self && cs.offset > skip {
+			return
+		}
+		a, b, ok := cs.Points()
+		if !ok {
+			return
+		}
+		if cs.tracker == self && cs.offset == skip {
+			b = lerp(a, b, clip)
+		}
+		p := segmentProximity(a, b, p0, p1, radius, collider.wallHeight, cs.tracker.id, cs.tracker == self)
+		if p == nil || near != nil && p.Distance > near.Distance {
+			return
+		}
+		if near != nil && p.Distance == near.Distance && (near.Obstacle || near.ID < p.ID || near.ID == p.ID && nearOffset <= cs.offset) {
+			return
+		}
+		near, nearOffset = p, cs.offset
+	})
+	return near
+}
+
+func (collider *chunkCollider) Raycast(origin, direction mgl.Vec3, maxDist float32) *RayHit {
+	return collider.raycast(nil, origin, direction, maxDist)
+}
+
+func (collider *chunkCollider) raycast(self *chunkTracker, origin, direction mgl.Vec3, maxDist float32) *RayHit {
+	r, ok := newRay(origin, direction, maxDist)
+	if !ok {
+		return nil
+	}
+	r.height = collider.wallHeight
+
+	head := -1
+	if self != nil {
+		head = self.trimmed + len(*self.segment) - 2
+	}
+
+	hit := nearerHit(r.boundaryHit(collider.edge), collider.obstacles.hit(r))
+	collider.each(segmentBox(origin, r.end()), func(cs chunkSegment) {
+		if cs.tracker == self && cs.offset == head {
+			return
+		}
+		a, b, ok := cs.Points()
+		if !ok {
+			return
+		}
+		hit = nearerHit(hit, r.segmentHit(a, b, cs.tracker.id))
+	})
+	return hit
+}
+
+type chunkTracker struct {
+	trackedLine
+	collider *chunkCollider
+
+	// Number of points that were trimmed off the start of the line, which
+	// offsets count from.
+	trimmed int
+
+	// Offset of the last registered head segment, which is registered again
+	// as it's extended, or -1.
+	head int
+
+	// What the last check found, until it's committed.
+	pass chunkPass
+}
+
+// chunkPass is what checking the head of a line found.
+type chunkPass struct {
+	// Nothing to commit, such as for a gap.
+	noop   bool
+	offset int
+	// Box around the head that the chunks were checked with.
+	query box
+	err   error
+}
+
+// around returns the chunks which are kept around the head of the line, or
+// around its last point if it has no head segment, or false if it's closed.
+func (tracker *chunkTracker) around() (image.Rectangle, bool) {
+	segment := *tracker.segment
+	if tracker.closed {
+		return image.Rectangle{}, false
+	}
+	if p0, p1, _, ok := headOf(segment, false); ok {
+		return tracker.collider.opts.Around(p0, p1), true
+	}
+	for i := len(segment) - 1; i >= 0; i-- {
+		if !IsBreak(segment[i]) {
+			return tracker.collider.opts.Around(segment[i], segment[i]), true
+		}
+	}
+	return image.Rectangle{}, false
+}
+
+func (tracker *chunkTracker) Near(radius float32) *Proximity {
+	segment := *tracker.segment
+	n := len(segment)
+	if n < 2 || isGap(segment[n-2], segment[n-1]) {
+		return nil
+	}
+	return tracker.collider.nearest(tracker, segment[n-2], segment[n-1], radius)
+}
+
+func (tracker *chunkTracker) Raycast(direction mgl.Vec3, maxDist float32) *RayHit {
+	segment := *tracker.segment
+	if len(segment) == 0 || IsBreak(segment[len(segment)-1]) {
+		return nil
+	}
+	return tracker.collider.raycast(tracker, segment[len(segment)-1], direction, maxDist)
+}
+
+func (tracker *chunkTracker) Trim(n int) {
+	segment := *tracker.segment
+	if n > len(segment)-2 {
+		n = len(segment) - 2
+	}
+	if n <= 0 {
+		return
+	}
+	if !tracker.closed {
+		for i := 0; i < n; i++ {
+			tracker.collider.unregister(tracker, tracker.trimmed+i, segment[i], segment[i+1])
+		}
+	}
+	*tracker.segment = segment[n:]
+	tracker.trimmed += n
+}
+
+func (tracker *chunkTracker) Close() {
+	tracker.collider.Untrack(tracker)
+}
+
+// Update drops chunks first, unless it's during UpdateAll which already did,
+// so that a collision refers to the line as it's left.
+func (tracker *chunkTracker) Update() error {
+	if tracker.collider.batch == nil {
+		tracker.collider.drop()
+	}
+	tracker.check()
+	return tracker.commit()
+}
+
+// check finds the collision of the head, without registering it. Its own
+// segments since the last registered head aren't in the chunks yet, so
+// they're checked directly.
+func (tracker *chunkTracker) check() {
+	tracker.pass = chunkPass{noop: true}
+	segment := *tracker.segment
+	collider := tracker.collider
+
+	head0, head1, offset, ok := headOf(segment, tracker.closed)
+	if !ok {
+		return
+	}
+	offset += tracker.trimmed
+
+	skip, clip := selfSkip(segment, tracker.radius)
+	skip += tracker.trimmed
+	from := tracker.trimmed
+	if tracker.head >= from {
+		from = tracker.head
+	}
+
+	var hit *CollisionSegment
+	query := segmentBox(head0, head1).grow(tracker.radius)
+	check := func(cs chunkSegment) {
+		if cs.tracker == tracker && cs.offset > skip {
+			return
+		}
+		a, b, ok := cs.Points()
+		if !ok {
+			return
+		}
+		if cs.tracker == tracker && cs.offset == skip && clip < 1 {
+			b = lerp(a, b, clip)
+		}
+		r := tracker.radius + cs.tracker.radius
+		if c := segmentCollision(a, b, head0, head1, r, collider.wallHeight, collider.reproducible, cs.tracker.id, cs.offset-cs.tracker.trimmed, cs.tracker == tracker); c != nil && !cs.tracker.tickHead(cs.offset-cs.tracker.trimmed) && before(c, hit) {
+			hit = c
+		}
+	}
+	collider.each(query, func(cs chunkSegment) {
+		if cs.tracker == tracker && cs.offset >= from {
+			return
+		}
+		check(cs)
+	})
+	for i := from; i <= offset && i <= skip; i++ {
+		cs := chunkSegment{tracker, i}
+		a, b, ok := cs.Points()
+		if !ok || isGap(a, b) || !segmentBox(a, b).grow(tracker.radius).intersects(query) {
+			continue
+		}
+		check(cs)
+	}
+
+	tracker.pass = chunkPass{
+		offset: offset,
+		query:  query,
+		err:    earliest(hit, collider.obstacles.collision(head0, head1, tracker.radius, collider.reproducible), collider.edge.crossing(head0, head1, tracker.radius)),
+	}
+}
+
+// stale returns true if anything was registered or removed where the last
+// check looked.
+func (tracker *chunkTracker) stale() bool {
+	if tracker.pass.noop {
+		return false
+	}
+	for _, r := range tracker.collider.batch {
+		if r.intersects(tracker.pass.query) {
+			return true
+		}
+	}
+	return false
+}
+
+// commit registers every segment from the last registered head up to the
+// head, except for gaps, even if it crosses the edge.
+func (tracker *chunkTracker) commit() error {
+	tracker.committed()
+	pass := tracker.pass
+	tracker.pass = chunkPass{noop: true}
+	if pass.noop {
+		return nil
+	}
+	from := tracker.trimmed
+	if tracker.head >= from {
+		from = tracker.head
+	}
+	for i := from; i <= pass.offset; i++ {
+		cs := chunkSegment{tracker, i}
+		a, b, ok := cs.Points()
+		if !ok || isGap(a, b) {
+			continue
+		}
+		tracker.collider.register(cs, segmentBox(a, b).grow(tracker.radius))
+		tracker.head = i
+	}
+	return tracker.collider.updated(tracker, pass.err)
+}
+
+// chunkSegment is a reference to the segment of a tracked line which starts
+// at offset and passes through a chunk, like a cellSegment.
+type chunkSegment struct {
+	tracker *chunkTracker
+	offset  int
+}
+
+// Points returns the endpoints of the referenced segment, or false if the
+// segment is not (or no longer) available.
+func (cs chunkSegment) Points() (a, b mgl.Vec3, ok bool) {
+	if cs.tracker.closed {
+		return a, b, false
+	}
+	segment := *cs.tracker.segment
+	i := cs.offset - cs.tracker.trimmed
+	if i < 0 || i+1 >= len(segment) {
+		return a, b, false
+	}
+	return segment[i], segment[i+1], true
+}
+
+func (cs chunkSegment) String() string {
+	a, b, _ := cs.Points()
+	return fmt.Sprintf("%d: %v -> %v", cs.tracker.id, a, b)
+}
+
+// chunk holds the segments which pass through a chunk of the arena.
+type chunk []chunkSegment
+
+// add registers the segment with the chunk, unless it's already there, and
+// forgets any segments which are no longer available.
+func (c *chunk) add(cs chunkSegment) {
+	found := false
+	kept := (*c)[:0]
+	for _, other := range *c {
+		if _, _, ok := other.Points(); !ok {
+			continue
+		}
+		found = found || other == cs
+		kept = append(kept, other)
+	}
+	*c = kept
+	if !found {
+		*c = append(*c, cs)
+	}
+}
+
+// remove unregisters the segment from the chunk.
+func (c *chunk) remove(cs chunkSegment) {
+	for i, other := range *c {
+		if other == cs {
+			*c = append((*c)[:i], (*c)[i+1:]...)
+			return
+		}
+	}
+}
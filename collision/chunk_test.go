@@ -0,0 +1,229 @@
+package collision
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// chunkedArena is a chunked collider with bounds as its outline, for the
+// testers of bounded colliders. Chunks are small enough that lines cross
+// them, and kept for long enough that none of the bounds are dropped.
+func chunkedArena(bounds image.Rectangle) Collider {
+	collider := ChunkedCollider(ChunkOptions{Size: 4, Keep: (bounds.Dx() + bounds.Dy()) / 4})
+	collider.SetOutline(&Outline{Loops: []Loop{Polygon{
+		{float32(bounds.Min.X), float32(bounds.Min.Y)},
+		{float32(bounds.Max.X), float32(bounds.Min.Y)},
+		{float32(bounds.Max.X), float32(bounds.Max.Y)},
+		{float32(bounds.Min.X), float32(bounds.Max.Y)},
+	}}})
+	return collider
+}
+
+// TestChunkedLinear replays random moves against a linear collider without
+// an edge, and chunked colliders which keep every chunk.
+func TestChunkedLinear(t *testing.T) {
+	n := 1000
+	if testing.Short() {
+		n = 100
+	}
+	bounds := image.Rect(-10, -10, 10, 10)
+	rng := rand.New(rand.NewSource(8))
+	for i := 0; i < n; i++ {
+		data := make([]byte, 3*(1+rng.Intn(200)))
+		rng.Read(data)
+		radius := float32(rng.Intn(3)) / 10
+		colliders := []Collider{
+			thick{LinearCollider(bounds), radius},
+			thick{ChunkedCollider(ChunkOptions{Size: 0.5, Keep: 1000}), radius},
+			thick{ChunkedCollider(ChunkOptions{Size: 3, Keep: 1000}), radius},
+		}
+		colliders[0].SetWrap(true)
+		if err := replay(data, replayOptions{gaps: i%2 == 1}, colliders...); err != nil {
+			attachPictures(t, colliders...)
+			t.Fatalf("radius %v: %s\n\tdata: %v", radius, err, data)
+		}
+	}
+}
+
+func TestChunkedDrop(t *testing.T) {
+	collider := ChunkedCollider(ChunkOptions{Size: 4, Keep: 1})
+	var events []Event
+	collider.Subscribe(func(event Event) {
+		events = append(events, event)
+	})
+
+	// A line which turns a corner and heads off east
+	segment := []mgl.Vec3{{0, 0, -2}, {0, 0, 2}}
+	tracker := collider.Track(&segment)
+	if err := tracker.Update(); err != nil {
+		t.Fatalf("expected no collision; got %s", err)
+	}
+	segment = append(segment, mgl.Vec3{2, 0, 2})
+	for x := float32(2); x <= 40; x++ {
+		segment[len(segment)-1] = mgl.Vec3{x, 0, 2}
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("expected no collision; got %s", err)
+		}
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected nothing to be dropped while the head reaches back; got %v", events)
+	}
+
+	// Turning, the head moves on from the chunks of the first segment, but the
+	// second one still reaches the chunks around the head
+	segment = append(segment, mgl.Vec3{40, 0, 3})
+	if err := tracker.Update(); err != nil {
+		t.Fatalf("expected no collision; got %s", err)
+	}
+	if len(segment) != 3 || segment[0] != (mgl.Vec3{0, 0, 2}) {
+		t.Errorf("expected the line to be trimmed to its second segment; got %v", segment)
+	}
+	if len(events) != 1 || events[0].Kind != EventTrimmed || events[0].ID != tracker.ID() || events[0].Point != segment[0] {
+		t.Errorf("expected the line to be trimmed; got %v", events)
+	}
+	around := ChunkOptions{Size: 4, Keep: 1}.Around(segment[1], segment[2])
+	for p := range collider.(*chunkCollider).chunks {
+		if !p.In(around) {
+			t.Errorf("expected only chunks around the head; got %v", p)
+		}
+	}
+
+	// The trail is forgotten where the chunks were dropped
+	crossing := []mgl.Vec3{{-2, 0, 0}, {2, 0, 0}}
+	if err := collider.Track(&crossing).Update(); err != nil {
+		t.Errorf("expected no collision with the dropped trail; got %s", err)
+	}
+	if hit := collider.Raycast(mgl.Vec3{20, 0, 0}, mgl.Vec3{0, 0, 1}, 10); hit != nil {
+		t.Errorf("expected the ray to miss the dropped trail; got %s", hit)
+	}
+
+	// Chunks with lines in them stay, and so do their trails
+	if chunks := collider.Picture().Cells; len(chunks) == 0 {
+		t.Errorf("expected the chunks of both lines")
+	}
+	if err := collider.Track(&[]mgl.Vec3{{39, 0, 2.5}, {41, 0, 2.5}}).Update(); err == nil {
+		t.Errorf("expected to hit the head")
+	}
+}
+
+func TestChunkedDropLoop(t *testing.T) {
+	collider := ChunkedCollider(ChunkOptions{Size: 4, Keep: 1})
+
+	// A line which stays put, keeping the chunks around it
+	if err := collider.Track(&[]mgl.Vec3{{19, 0, -3}, {20, 0, -3}}).Update(); err != nil {
+		t.Fatalf("expected no collision; got %s", err)
+	}
+
+	// A line which heads off east and loops back across its first segment,
+	// next to the other line, leaving the chunks around the far corners behind
+	segment := []mgl.Vec3{{0, 0, 0}, {40, 0, 0}}
+	tracker := collider.Track(&segment)
+	for _, p := range []mgl.Vec3{{40, 0, 20}, {22, 0, 20}} {
+		segment = append(segment, p)
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("expected no collision; got %s", err)
+		}
+	}
+	segment = append(segment, mgl.Vec3{22, 0, -1})
+	err := tracker.Update()
+	if c, ok := err.(*CollisionSegment); !ok || c.ID != tracker.ID() || !c.Point.ApproxEqual(mgl.Vec3{22, 0, 0}) {
+		t.Errorf("expected to hit the first segment at %v; got %v", mgl.Vec3{22, 0, 0}, err)
+	}
+	if segment[0] != (mgl.Vec3{0, 0, 0}) {
+		t.Errorf("expected the line to keep the segment in a kept chunk; got %v", segment)
+	}
+}
+
+// TestChunkedMemory runs two lines apart for 30 minutes at 60 ticks a second,
+// meandering without ever turning back, and checks that the chunks and the
+// points of the lines stop growing.
+func TestChunkedMemory(t *testing.T) {
+	const ticks = 30 * 60 * 60
+	const speed = 3.0 / 60
+	collider := ChunkedCollider(ChunkOptions{})
+
+	type line struct {
+		segment []mgl.Vec3
+		tracker Tracker
+		heading float64
+	}
+	lines := []*line{{heading: 0}, {heading: math.Pi}}
+	for _, l := range lines {
+		l.segment = []mgl.Vec3{{float32(math.Cos(l.heading)), 0, float32(math.Sin(l.heading))}}
+		l.tracker = collider.Track(&l.segment)
+	}
+	trackers := []Tracker{lines[0].tracker, lines[1].tracker}
+
+	size := func() int {
+		n := 0
+		for _, c := range collider.(*chunkCollider).chunks {
+			n += len(*c)
+		}
+		for _, l := range lines {
+			n += len(l.segment)
+		}
+		return n
+	}
+	var most [2]int
+	for tick := 0; tick < ticks; tick++ {
+		for i, l := range lines {
+			heading := l.heading + 0.8*math.Sin(float64(tick)/600+float64(i))
+			head := l.segment[len(l.segment)-1]
+			next := mgl.Vec3{head[0] + float32(speed*math.Cos(heading)), 0, head[2] + float32(speed*math.Sin(heading))}
+			if len(l.segment) < 2 || tick%30 == 0 {
+				l.segment = append(l.segment, next)
+			} else {
+				l.segment[len(l.segment)-1] = next
+			}
+		}
+		for i, err := range collider.UpdateTick(trackers, TickCrashBoth) {
+			if err != nil {
+				t.Fatalf("tick %d: expected line %d not to crash; got %s", tick, i, err)
+			}
+		}
+		if half := tick * 2 / ticks; size() > most[half] {
+			most[half] = size()
+		}
+	}
+
+	if most[1] > most[0] {
+		t.Errorf("expected memory to stay flat; grew from %d to %d in the second 15 minutes", most[0], most[1])
+	}
+	if chunks := len(collider.(*chunkCollider).chunks); chunks > 2*7*7 {
+		t.Errorf("expected only the chunks around both heads; got %d", chunks)
+	}
+}
+
+func TestChunkedSnapshot(t *testing.T) {
+	snapshotTester(t, chunkedArena)
+}
+
+func TestChunkedParallel(t *testing.T) {
+	parallelTester(t, chunkedArena)
+}
+
+func TestChunkedEvents(t *testing.T) {
+	eventsTester(t, chunkedArena)
+}
+
+func TestChunkedUntrack(t *testing.T) {
+	untrackTester(t, chunkedArena)
+	trimTester(t, chunkedArena)
+}
+
+func TestChunkedTick(t *testing.T) {
+	tickTester(t, chunkedArena)
+	tickTieTester(t, chunkedArena)
+	tickStaticTester(t, chunkedArena)
+	tickEventsTester(t, chunkedArena)
+}
+
+func TestChunkedHeight(t *testing.T) {
+	heightTester(t, chunkedArena)
+	heightTrailTester(t, chunkedArena)
+	heightProximityTester(t, chunkedArena)
+}
@@ -9,24 +9,429 @@ import (
 
 type Tracker interface {
 	Update() error
+	// ID identifies the tracked line within its Collider.
+	ID() int
+	// Near returns the nearest segment within radius of the head segment,
+	// ignoring its own trail within radius of the head along the trail.
+	Near(radius float32) *Proximity
+	// Raycast casts a ray from the head in direction, ignoring the head
+	// segment itself.
+	Raycast(direction mgl.Vec3, maxDist float32) *RayHit
+	// Trim removes the oldest n points of the tracked line, along with the
+	// segments between them, such as for a tail of limited length. The head
+	// segment is always kept.
+	Trim(n int)
+	// Close stops tracking the line, see Collider.Untrack.
+	Close()
 }
 
 type Collider interface {
 	Track(*[]mgl.Vec3) Tracker
+	// TrackRadius tracks a line which is radius thick on either side, so
+	// that it collides wherever it comes within the sum of both radii of
+	// another line. Track is the same as a radius of 0.
+	TrackRadius(segment *[]mgl.Vec3, radius float32) Tracker
+	// Untrack removes the trail of a tracked line, so that nothing collides
+	// with it anymore. Updating its tracker afterwards does nothing.
+	Untrack(Tracker)
+	// SetOutline keeps lines within outline instead of the rectangular
+	// bounds, which should contain it.
+	SetOutline(outline *Outline)
+	// SetWrap makes the arena wrap around, so that lines never collide with
+	// its edge and are expected to wrap instead, see Boundary.Wrap. It
+	// replaces any outline, and SetWrap(false) restores the bounds.
+	SetWrap(wrap bool)
+	// SetWallHeight makes the trails of lines into walls of height above
+	// their points, so that lines which climb and dive can pass over or
+	// under them, and only collide with them, come near them or hit them
+	// with a ray where the walls overlap. The head of a line is a wall of the
+	// same height. The default of 0 ignores heights, and it's kept by Reset.
+	// Obstacles and the edge are always in the way.
+	SetWallHeight(height float32)
+	// SetReproducible switches collisions of lines without a radius, with
+	// trails and thin obstacles, to exact fixed-point arithmetic (see
+	// IntersectFixed2D), so that every machine agrees on which of them
+	// collide given the same trails. Thick lines and walls, the edge,
+	// proximity and raycasts are still float32. It's kept by Reset, and
+	// should be set before anything is tracked.
+	SetReproducible(reproducible bool)
+	// SetNearMiss makes updating a line send an EventNearMiss to subscribers
+	// whenever it carries on within radius of a segment, as found by
+	// Tracker.Near. The default of 0 sends none, and it's kept by Reset.
+	SetNearMiss(radius float32)
+	// SetObstacles replaces the static obstacles that lines collide with,
+	// which are kept by Reset. Collisions with them are *CollisionObstacle.
+	SetObstacles(obstacles []*Obstacle)
+	// UpdateAll updates each of trackers like calling Update on them in
+	// order, and returns their errors in the same order. Their heads are
+	// checked in parallel against the collider as it was before the call,
+	// then committed in order, checking again any that the lines before them
+	// came close to. Subscribers are called while committing, from the
+	// calling goroutine, and mustn't change the collider.
+	UpdateAll(trackers []Tracker) []error
+	// UpdateTick is UpdateAll for lines which all moved in the same tick, so
+	// that what happens when they run into each other doesn't depend on
+	// their order. Their heads don't collide with each other's heads while
+	// they're updated, and instead wherever they met is resolved by rule in
+	// order of the time of impact, with *CollisionHeadOn for the lines which
+	// crashed there. The part of a head from before the tick is trail, which
+	// lines run into as usual. Events are sent once it's all resolved.
+	UpdateTick(trackers []Tracker, rule TickRule) []error
+	// Subscribe calls fn with an Event whenever a tracked line collides
+	// with something, passes near it or is trimmed, see EventKind.
+	// Subscribers are kept by Reset.
+	Subscribe(fn func(Event))
 	Reset()
+	// Snapshot returns the state of the collider and its tracked lines,
+	// including their points, for Restore. Configuration such as the
+	// outline, wrap, obstacles and subscribers isn't included.
+	Snapshot() []byte
+	// Restore returns the collider and its tracked lines to a Snapshot of
+	// it, or of one like it which tracked at least as many lines in the same
+	// order since it was reset. Points are restored into the tracked
+	// segments. Lines tracked since the snapshot are untracked and their IDs
+	// are used again. Errors match ErrSnapshot, and leave it as it was.
+	Restore(data []byte) error
 	String() string
+	// Picture returns a top-down view of the arena, its tracked lines and
+	// the last collision, for debugging.
+	Picture() *Picture
+	// Nearest returns the nearest tracked segment within radius of point.
+	Nearest(point mgl.Vec3, radius float32) *Proximity
+	// Raycast returns the first thing hit by a ray from origin in direction
+	// along the X/Z plane, up to maxDist away, or nil.
+	Raycast(origin, direction mgl.Vec3, maxDist float32) *RayHit
 }
 
+// CollisionBoundary matches any *CollisionEdge when compared with errors.Is.
 var CollisionBoundary = errors.New("collision with boundary")
 
+// Collision describes where the moving head segment of a line was stopped.
+type Collision struct {
+	// Point is the exact point of impact.
+	Point mgl.Vec3
+	// T is the fractional position of Point along the moving segment, from
+	// 0 at its start to 1 at its end.
+	T float32
+}
+
+// Impact returns the collision details of err, if it's a collision.
+func Impact(err error) (Collision, bool) {
+	switch err := err.(type) {
+	case *CollisionSegment:
+		return err.Collision, true
+	case *CollisionEdge:
+		return err.Collision, true
+	case *CollisionObstacle:
+		return err.Collision, true
+	case *CollisionHeadOn:
+		return err.Collision, true
+	}
+	return Collision{}, false
+}
+
+// CollisionSegment is returned when a line collides with a segment of a
+// tracked line.
 type CollisionSegment struct {
-	x0, y0, x1, y1 float32
+	Collision
+
+	// ID of the tracked line that was hit.
+	ID int
+	// Self is true when the line hit its own trail.
+	Self bool
+	// Offset of the segment that was hit within the line, which is the index
+	// of its first point.
+	Offset int
+	// X0, Y0, X1, Y1 is the segment that was hit.
+	X0, Y0, X1, Y1 float32
 }
 
 func (seg *CollisionSegment) Error() string {
-	return fmt.Sprintf("collision with segment: %v,%v -> %v,%v", seg.x0, seg.y0, seg.x1, seg.y1)
+	return fmt.Sprintf("collision with segment of line %d: %v,%v -> %v,%v at %v", seg.ID, seg.X0, seg.Y0, seg.X1, seg.Y1, seg.Point)
+}
+
+// Edge identifies a side of a Boundary.
+type Edge int
+
+const (
+	EdgeX1 Edge = iota
+	EdgeY1
+	EdgeX2
+	EdgeY2
+	// EdgeOutline is the edge of an Outline.
+	EdgeOutline
+)
+
+func (edge Edge) String() string {
+	switch edge {
+	case EdgeX1:
+		return "X1"
+	case EdgeY1:
+		return "Y1"
+	case EdgeX2:
+		return "X2"
+	case EdgeY2:
+		return "Y2"
+	case EdgeOutline:
+		return "outline"
+	}
+	return fmt.Sprintf("Edge(%d)", int(edge))
+}
+
+// normal returns the normal of a side of a Boundary, pointing into it.
+func (edge Edge) normal() mgl.Vec3 {
+	switch edge {
+	case EdgeX1:
+		return mgl.Vec3{1, 0, 0}
+	case EdgeY1:
+		return mgl.Vec3{0, 0, 1}
+	case EdgeX2:
+		return mgl.Vec3{-1, 0, 0}
+	case EdgeY2:
+		return mgl.Vec3{0, 0, -1}
+	}
+	return mgl.Vec3{}
+}
+
+// CollisionEdge is returned when a line crosses the boundary.
+type CollisionEdge struct {
+	Collision
+
+	// Edge of the boundary that was crossed.
+	Edge Edge
+	// Loop of the Outline that was crossed, if Edge is EdgeOutline.
+	Loop int
+	// Normal of the edge where it was crossed, pointing back into the arena,
+	// such as for bouncing off it. It's zero if the line started outside.
+	Normal mgl.Vec3
+}
+
+func (err *CollisionEdge) Error() string {
+	return fmt.Sprintf("%s: edge %s at %v", CollisionBoundary, err.Edge, err.Point)
+}
+
+func (err *CollisionEdge) Is(target error) bool {
+	return target == CollisionBoundary
+}
+
+// boundary keeps lines within the arena, which is either a rectangular
+// Boundary or an Outline.
+type boundary interface {
+	// crossing returns the collision for segment p0 -> p1, which is r thick,
+	// leaving the arena, or nil.
+	crossing(p0, p1 mgl.Vec3, r float32) *CollisionEdge
 }
 
 type Boundary struct {
 	X1, Y1, X2, Y2 float32
 }
+
+// Inset returns the boundary shrunk by d on every side.
+func (b Boundary) Inset(d float32) Boundary {
+	return Boundary{b.X1 + d, b.Y1 + d, b.X2 - d, b.Y2 - d}
+}
+
+func (b Boundary) crossing(p0, p1 mgl.Vec3, r float32) *CollisionEdge {
+	return b.Inset(r).Crossing(p0, p1)
+}
+
+// Contains returns true if x, y is strictly within the boundary.
+func (b Boundary) Contains(x, y float32) bool {
+	return b.X1 < x && x < b.X2 && b.Y1 < y && y < b.Y2
+}
+
+// Crossing returns the collision for segment p0 -> p1 leaving the boundary,
+// or nil if p1 is within the boundary. The edge that is crossed first wins.
+func (b Boundary) Crossing(p0, p1 mgl.Vec3) *CollisionEdge {
+	x0, y0, x1, y1 := p0[0], p0[2], p1[0], p1[2]
+	if b.Contains(x1, y1) {
+		return nil
+	}
+
+	var edge Edge
+	t := float32(-1)
+	cross := func(e Edge, from, to, limit float32) {
+		var s float32
+		if from != to {
+			s = (limit - from) / (to - from)
+		}
+		if s < 0 {
+			// Already beyond the edge
+			s = 0
+		}
+		if t < 0 || s < t {
+			edge, t = e, s
+		}
+	}
+	if x1 <= b.X1 {
+		cross(EdgeX1, x0, x1, b.X1)
+	}
+	if x1 >= b.X2 {
+		cross(EdgeX2, x0, x1, b.X2)
+	}
+	if y1 <= b.Y1 {
+		cross(EdgeY1, y0, y1, b.Y1)
+	}
+	if y1 >= b.Y2 {
+		cross(EdgeY2, y0, y1, b.Y2)
+	}
+
+	return &CollisionEdge{
+		Collision: Collision{Point: lerp(p0, p1, t), T: t},
+		Edge:      edge,
+		Normal:    edge.normal(),
+	}
+}
+
+// segmentCollision returns the collision of the moving segment p0 -> p1 with
+// the segment a -> b at offset of the tracked line id, or nil if they don't
+// come within r of each other, or if their walls don't overlap while they do.
+// Without r, fixed intersects them in fixed-point.
+func segmentCollision(a, b, p0, p1 mgl.Vec3, r, height float32, fixed bool, id, offset int, self bool) *CollisionSegment {
+	var t float32
+	var ok bool
+	if r > 0 {
+		// Thick lines are never exact, see Collider.SetReproducible
+		t, ok = CapsuleIntersect2D(a[0], a[2], b[0], b[2], p0[0], p0[2], p1[0], p1[2], r)
+	} else if fixed {
+		t, ok = intersectFixed(a, b, p0, p1)
+	} else {
+		t, ok = Intersect2D(a[0], a[2], b[0], b[2], p0[0], p0[2], p1[0], p1[2])
+	}
+	if !ok {
+		return nil
+	}
+	if r > 0 && height > 0 {
+		// Thick lines touch over a stretch, and the walls may only overlap
+		// for some of it
+		if t, ok = overlapFrom(a, b, p0, p1, r, height, t); !ok {
+			return nil
+		}
+	} else if !wallsOverlap(a, b, lerp(p0, p1, t), height) {
+		return nil
+	}
+	point := lerp(p0, p1, t)
+	return &CollisionSegment{
+		Collision: Collision{Point: point, T: t},
+		ID:        id,
+		Self:      self,
+		Offset:    offset,
+		X0:        a[0],
+		Y0:        a[2],
+		X1:        b[0],
+		Y1:        b[2],
+	}
+}
+
+// trailHeight returns the height of segment a -> b at the point nearest to p
+// in the X/Z plane.
+func trailHeight(a, b, p mgl.Vec3) float32 {
+	dx, dz := b[0]-a[0], b[2]-a[2]
+	l := dx*dx + dz*dz
+	if l == 0 {
+		return a[1]
+	}
+	s := ((p[0]-a[0])*dx + (p[2]-a[2])*dz) / l
+	s = minf(maxf(s, 0), 1)
+	return a[1] + s*(b[1]-a[1])
+}
+
+// wallsOverlap returns true if walls of height standing on p and on segment
+// a -> b next to it overlap, which they always do for no height.
+func wallsOverlap(a, b, p mgl.Vec3, height float32) bool {
+	if height <= 0 {
+		return true
+	}
+	dy := p[1] - trailHeight(a, b, p)
+	return -height < dy && dy < height
+}
+
+// overlapFrom returns the first position from t along segment p0 -> p1, while
+// it's still within r of segment a -> b, where walls of height standing on
+// both overlap, or false if they don't before it's out of reach again.
+func overlapFrom(a, b, p0, p1 mgl.Vec3, r, height, t float32) (float32, bool) {
+	dy := func(u float32) float32 {
+		p := lerp(p0, p1, u)
+		return p[1] - trailHeight(a, b, p)
+	}
+	if d := dy(t); -height < d && d < height {
+		return t, true
+	}
+
+	// Out of reach where the reverse of p0 -> p1 comes within r
+	end := float32(1)
+	if u, ok := CapsuleIntersect2D(a[0], a[2], b[0], b[2], p1[0], p1[2], p0[0], p0[2], r); ok {
+		end = 1 - u
+	}
+	// The gap between the walls changes linearly, except where p0 -> p1
+	// passes the ends of a -> b and the height under it stops sloping
+	stops := []float32{t}
+	e_x, e_z := b[0]-a[0], b[2]-a[2]
+	if l := e_x*e_x + e_z*e_z; l > 0 {
+		s0 := ((p0[0]-a[0])*e_x + (p0[2]-a[2])*e_z) / l
+		ds := ((p1[0]-p0[0])*e_x + (p1[2]-p0[2])*e_z) / l
+		for _, s := range []float32{0, 1} {
+			if u := (s - s0) / ds; ds != 0 && t < u && u < end {
+				stops = append(stops, u)
+			}
+		}
+		if len(stops) == 3 && stops[1] > stops[2] {
+			stops[1], stops[2] = stops[2], stops[1]
+		}
+	}
+	stops = append(stops, end)
+
+	for i := 0; i+1 < len(stops); i++ {
+		u, v := stops[i], stops[i+1]
+		du, dv := dy(u), dy(v)
+		switch {
+		case du >= height && dv < height:
+			u += (v - u) * (du - height) / (du - dv)
+		case du <= -height && dv > -height:
+			u += (v - u) * (du + height) / (du - dv)
+		default:
+			continue
+		}
+		// The end is only reached on the next move
+		return u, u < 1
+	}
+	return 0, false
+}
+
+// before returns true if c is earlier along the head segment than hit, or if
+// hit is nil. Ties go to the lowest line ID and offset, so that the result
+// doesn't depend on the order that segments are checked in.
+func before(c, hit *CollisionSegment) bool {
+	if hit == nil {
+		return true
+	}
+	if c.T != hit.T {
+		return c.T < hit.T
+	}
+	if c.ID != hit.ID {
+		return c.ID < hit.ID
+	}
+	return c.Offset < hit.Offset
+}
+
+// selfSkip returns the offset of the newest segment of a line's own trail that
+// its head can collide with, and the fraction of that segment which counts,
+// like nearSkip. Only the head itself is skipped for lines without a radius.
+// Thick lines always touch their own trail right behind the head, so anything
+// within twice the touching distance along the trail is skipped too.
+func selfSkip(segment []mgl.Vec3, radius float32) (int, float32) {
+	if radius <= 0 {
+		return len(segment) - 3, 1
+	}
+	return nearSkip(segment, 4*radius)
+}
+
+func lerp(a, b mgl.Vec3, t float32) mgl.Vec3 {
+	// The explicit conversions prevent fused multiply-adds, which round
+	// differently on some architectures.
+	return mgl.Vec3{
+		a[0] + float32((b[0]-a[0])*t),
+		a[1] + float32((b[1]-a[1])*t),
+		a[2] + float32((b[2]-a[2])*t),
+	}
+}
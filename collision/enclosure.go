@@ -0,0 +1,51 @@
+package collision
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Enclosure is an area enclosed by a line's own trail, such as for claiming
+// territory.
+type Enclosure struct {
+	// Points around the area in the X/Z plane, counter-clockwise.
+	Points []mgl.Vec2
+	// Area within the points.
+	Area float32
+}
+
+// Enclose returns the area which the head of segment enclosed with its own
+// trail by hitting it, as reported by Update, or false if the hit didn't close
+// a loop. A loop with a gap in it isn't closed.
+func Enclose(segment []mgl.Vec3, hit *CollisionSegment) (*Enclosure, bool) {
+	n := len(segment)
+	if !hit.Self || hit.Offset < 0 || hit.Offset+1 > n-2 {
+		return nil, false
+	}
+
+	// From the impact around the trail up to the start of the head, which
+	// leads back to the impact
+	points := []mgl.Vec2{{hit.Point[0], hit.Point[2]}}
+	for _, p := range segment[hit.Offset+1 : n-1] {
+		if IsBreak(p) {
+			return nil, false
+		}
+		points = append(points, mgl.Vec2{p[0], p[2]})
+	}
+
+	var area float64
+	for i, a := range points {
+		b := points[(i+1)%len(points)]
+		area += float64(a[0])*float64(b[1]) - float64(b[0])*float64(a[1])
+	}
+	area /= 2
+	if area == 0 {
+		return nil, false
+	}
+	if area < 0 {
+		area = -area
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+	return &Enclosure{Points: points, Area: float32(area)}, true
+}
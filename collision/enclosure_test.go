@@ -0,0 +1,78 @@
+package collision
+
+import (
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+func enclosureTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	tests := []struct {
+		name string
+		line []mgl.Vec3
+		trim int
+		area float32 // Negative if there's no enclosure
+	}{
+		{"Around a square", []mgl.Vec3{{-1, 0, 0}, {4, 0, 0}, {4, 0, 4}, {0, 0, 4}, {0, 0, -2}}, 0, 16},
+		{"Around a square the other way", []mgl.Vec3{{0, 0, -1}, {0, 0, 4}, {4, 0, 4}, {4, 0, 0}, {-2, 0, 0}}, 0, 16},
+		{"After trimming", []mgl.Vec3{{-3, 0, -3}, {-1, 0, 0}, {4, 0, 0}, {4, 0, 4}, {0, 0, 4}, {0, 0, -2}}, 1, 16},
+		{"Around a triangle", []mgl.Vec3{{-2, 0, 0}, {6, 0, 0}, {2, 0, 4}, {0, 0, -2}}, 0, 32.0 / 3},
+		{"Around a gap", []mgl.Vec3{{-1, 0, 0}, {4, 0, 0}, Break, {4, 0, 1}, {4, 0, 4}, {0, 0, 4}, {0, 0, -2}}, 0, -1},
+	}
+	for _, test := range tests {
+		collider := newCollider(image.Rect(-10, -10, 10, 10))
+		var segment []mgl.Vec3
+		tracker := collider.Track(&segment)
+		var err error
+		for i, p := range test.line {
+			if i == len(test.line)-1 {
+				tracker.Trim(test.trim)
+			}
+			segment = append(segment, p)
+			if err = tracker.Update(); err != nil {
+				break
+			}
+		}
+		hit, ok := err.(*CollisionSegment)
+		if !ok || !hit.Self {
+			t.Errorf("%s: expected to hit its own trail; got %v", test.name, err)
+			continue
+		}
+
+		enclosure, ok := Enclose(segment, hit)
+		if test.area < 0 {
+			if ok {
+				t.Errorf("%s: expected no enclosure; got %v", test.name, enclosure)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: expected enclosure of %v; got none", test.name, test.area)
+			continue
+		}
+		if !mgl.FloatEqualThreshold(enclosure.Area, test.area, 1e-4) {
+			t.Errorf("%s: expected enclosure of %v; got %v around %v", test.name, test.area, enclosure.Area, enclosure.Points)
+		}
+		var signed float32
+		for i, a := range enclosure.Points {
+			b := enclosure.Points[(i+1)%len(enclosure.Points)]
+			signed += a[0]*b[1] - b[0]*a[1]
+		}
+		if signed <= 0 {
+			t.Errorf("%s: expected counter-clockwise points; got %v", test.name, enclosure.Points)
+		}
+	}
+}
+
+func TestGridEnclosure(t *testing.T) {
+	enclosureTester(t, GridCollider)
+}
+
+func TestLinearEnclosure(t *testing.T) {
+	enclosureTester(t, LinearCollider)
+}
+
+func TestQuadtreeEnclosure(t *testing.T) {
+	enclosureTester(t, QuadtreeCollider)
+}
@@ -0,0 +1,147 @@
+package collision
+
+import (
+	"fmt"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// EventKind is the kind of thing that happened to a tracked line.
+type EventKind int
+
+const (
+	// EventCollision is a line hitting a tracked line or an obstacle.
+	EventCollision EventKind = iota
+	// EventNearMiss is a line passing near a segment without hitting it, see
+	// Collider.SetNearMiss.
+	EventNearMiss
+	// EventBoundary is a line crossing the edge of the arena.
+	EventBoundary
+	// EventTrimmed is a line being trimmed by the collider rather than by
+	// Tracker.Trim, such as when a chunked collider drops the chunks its
+	// oldest segments were in.
+	EventTrimmed
+)
+
+func (kind EventKind) String() string {
+	switch kind {
+	case EventCollision:
+		return "collision"
+	case EventNearMiss:
+		return "near miss"
+	case EventBoundary:
+		return "boundary"
+	case EventTrimmed:
+		return "trimmed"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(kind))
+}
+
+// Event is sent to the subscribers of a Collider whenever one of its tracked
+// lines collides with something, passes near it, or is trimmed.
+type Event struct {
+	Kind EventKind
+	// ID of the tracked line that the event happened to.
+	ID int
+	// Other is the ID of the tracked line that was hit or passed, which is ID
+	// for its own trail, or -1 for obstacles and the boundary.
+	Other int
+	// Point is the point of impact, the nearest point of a near miss, or the
+	// new first point of a trimmed line.
+	Point mgl.Vec3
+
+	// Err is the collision returned by Tracker.Update, unless it's a near
+	// miss.
+	Err error
+	// Proximity is the result of Tracker.Near, if it's a near miss.
+	Proximity *Proximity
+}
+
+func (event Event) String() string {
+	return fmt.Sprintf("<%s of line %d with %d at %v>", event.Kind, event.ID, event.Other, event.Point)
+}
+
+// hooks keeps the subscribers of a Collider, which are kept by Reset.
+type hooks struct {
+	subscribers []func(Event)
+	// How near a line passes to send a near miss, or 0 for none.
+	nearRadius float32
+
+	// Point of the last collision, for Picture, until Reset.
+	collision *mgl.Vec3
+
+	// Hold off on collisions until UpdateTick has resolved them.
+	muted bool
+}
+
+// Subscribe calls fn with every event from now on, in the order that they
+// happen, before the call that caused it returns.
+func (h *hooks) Subscribe(fn func(Event)) {
+	h.subscribers = append(h.subscribers, fn)
+}
+
+func (h *hooks) SetNearMiss(radius float32) {
+	h.nearRadius = radius
+}
+
+func (h *hooks) emit(event Event) {
+	for _, fn := range h.subscribers {
+		fn(event)
+	}
+}
+
+// updated sends the event for err returned by Update of tracker, or for it
+// passing near a segment if it carried on, and returns err.
+func (h *hooks) updated(tracker Tracker, err error) error {
+	if h.muted {
+		return err
+	}
+	if err == nil {
+		h.nearMiss(tracker)
+		return nil
+	}
+	impact, ok := Impact(err)
+	if ok {
+		h.collision = &impact.Point
+	}
+	if len(h.subscribers) == 0 {
+		return err
+	}
+	event := Event{Kind: EventCollision, ID: tracker.ID(), Other: -1, Err: err}
+	switch err := err.(type) {
+	case *CollisionSegment:
+		event.Other = err.ID
+	case *CollisionHeadOn:
+		event.Other = err.ID
+	case *CollisionEdge:
+		event.Kind = EventBoundary
+	}
+	if ok {
+		event.Point = impact.Point
+	}
+	h.emit(event)
+	return err
+}
+
+// nearMiss sends the event for the nearest segment within the near miss
+// radius of the head of tracker, if there is one.
+func (h *hooks) nearMiss(tracker Tracker) {
+	if h.nearRadius <= 0 || len(h.subscribers) == 0 {
+		return
+	}
+	near := tracker.Near(h.nearRadius)
+	if near == nil {
+		return
+	}
+	other := near.ID
+	if near.Obstacle {
+		other = -1
+	}
+	h.emit(Event{Kind: EventNearMiss, ID: tracker.ID(), Other: other, Point: near.Point, Proximity: near})
+}
+
+// trimmed sends the event for the collider trimming the tracked line id, which
+// now starts at start.
+func (h *hooks) trimmed(id int, start mgl.Vec3) {
+	h.emit(Event{Kind: EventTrimmed, ID: id, Other: -1, Point: start})
+}
@@ -0,0 +1,102 @@
+package collision
+
+import (
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+func eventsTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	collider.SetObstacles([]*Obstacle{Pillar(mgl.Vec2{5, 5}, 1)})
+	var events []Event
+	collider.Subscribe(func(event Event) {
+		events = append(events, event)
+	})
+
+	wall := []mgl.Vec3{{-5, 0, 0}, {5, 0, 0}}
+	walls := collider.Track(&wall)
+	if err := walls.Update(); err != nil {
+		t.Fatalf("expected no collision; got %s", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events; got %v", events)
+	}
+
+	tests := []struct {
+		name  string
+		line  []mgl.Vec3
+		near  float32
+		kind  EventKind
+		other int
+		point mgl.Vec3
+	}{
+		{"Into the wall", []mgl.Vec3{{0, 0, -3}, {0, 0, 3}}, 0, EventCollision, walls.ID(), mgl.Vec3{0, 0, 0}},
+		{"Into the pillar", []mgl.Vec3{{5, 0, 2}, {5, 0, 8}}, 0, EventCollision, -1, mgl.Vec3{5, 0, 4}},
+		{"Out of the arena", []mgl.Vec3{{-3, 0, 5}, {-3, 0, 12}}, 0, EventBoundary, -1, mgl.Vec3{-3, 0, 10}},
+		{"Past the wall", []mgl.Vec3{{-3, 0, -1}, {3, 0, -1}}, 1.5, EventNearMiss, walls.ID(), mgl.Vec3{-3, 0, 0}},
+	}
+	for _, test := range tests {
+		events = nil
+		collider.SetNearMiss(test.near)
+		line := test.line
+		tracker := collider.Track(&line)
+		err := tracker.Update()
+		// Only updating sends events
+		tracker.Near(1.5)
+		tracker.Near(1.5)
+		if len(events) != 1 {
+			t.Errorf("%s: expected 1 event; got %v", test.name, events)
+			continue
+		}
+		event := events[0]
+		if event.Kind != test.kind || event.ID != tracker.ID() || event.Other != test.other || !event.Point.ApproxEqualThreshold(test.point, 1e-4) {
+			t.Errorf("%s: expected %s of line %d with %d at %v; got %s", test.name, test.kind, tracker.ID(), test.other, test.point, event)
+		}
+		if event.Err != err {
+			t.Errorf("%s: expected event for %v; got %v", test.name, err, event.Err)
+		}
+		if (event.Proximity != nil) != (test.kind == EventNearMiss) {
+			t.Errorf("%s: expected proximity only for a near miss; got %v", test.name, event.Proximity)
+		}
+		tracker.Close()
+	}
+
+	collider.Reset()
+	events = nil
+	line := []mgl.Vec3{{0, 0, 5}, {0, 0, 15}}
+	collider.Track(&line).Update()
+	if len(events) != 1 {
+		t.Errorf("expected subscribers to be kept by reset; got %v", events)
+	}
+
+	// Near misses are sent by UpdateAll too, and kept by Reset
+	events = nil
+	wall = []mgl.Vec3{{-5, 0, 0}, {5, 0, 0}}
+	walls = collider.Track(&wall)
+	past := []mgl.Vec3{{-3, 0, -1}, {3, 0, -1}}
+	passing := collider.Track(&past)
+	collider.UpdateAll([]Tracker{walls, passing})
+	missed := false
+	for _, event := range events {
+		if event.Kind == EventNearMiss && event.ID == passing.ID() && event.Other == walls.ID() {
+			missed = true
+		}
+	}
+	if !missed {
+		t.Errorf("expected a near miss of the wall; got %v", events)
+	}
+}
+
+func TestGridEvents(t *testing.T) {
+	eventsTester(t, GridCollider)
+}
+
+func TestLinearEvents(t *testing.T) {
+	eventsTester(t, LinearCollider)
+}
+
+func TestQuadtreeEvents(t *testing.T) {
+	eventsTester(t, QuadtreeCollider)
+}
@@ -0,0 +1,219 @@
+package collision
+
+import (
+	"math"
+	"math/bits"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Fixed is a 16.16 fixed-point number. Arithmetic on Fixed values is integer
+// arithmetic, so it produces bit-identical results on every machine, unlike
+// float32 math which may be fused or rounded differently.
+//
+// Coordinates are expected to be within ±16384 units, so that the products in
+// IntersectFixed2D can't overflow.
+type Fixed int32
+
+const fixedShift = 16
+const FixedOne Fixed = 1 << fixedShift
+
+// ToFixed returns the nearest Fixed value to f.
+func ToFixed(f float64) Fixed {
+	return Fixed(math.Round(f * float64(FixedOne)))
+}
+
+// FixedAngle returns rad as a Fixed angle, reduced to within one turn so that
+// long-running angles don't overflow.
+func FixedAngle(rad float64) Fixed {
+	// Reduce with the extra precision of the CORDIC constants
+	z := int64(math.Round(rad*(1<<cordicShift))) % (2 * cordicPi)
+	return Fixed((z + 1<<(cordicShift-fixedShift-1)) >> (cordicShift - fixedShift))
+}
+
+// Float returns f as the nearest float32.
+func (f Fixed) Float() float32 {
+	return float32(f) / float32(FixedOne)
+}
+
+func (f Fixed) Mul(g Fixed) Fixed {
+	return Fixed((int64(f) * int64(g)) >> fixedShift)
+}
+
+func (f Fixed) Div(g Fixed) Fixed {
+	return Fixed((int64(f) << fixedShift) / int64(g))
+}
+
+// CORDIC constants with 30 fractional bits.
+const (
+	cordicShift = 30
+	cordicPi    = 3373259426
+	cordicGain  = 652032874
+)
+
+// atan(2^-i) for each CORDIC iteration.
+var cordicAtan = [...]int64{
+	843314857, 497837829, 263043837, 133525159, 67021687, 33543516, 16775851, 8388437,
+	4194283, 2097149, 1048576, 524288, 262144, 131072, 65536, 32768,
+	16384, 8192, 4096, 2048, 1024, 512, 256, 128,
+	64, 32, 16, 8, 4, 2,
+}
+
+// FixedSinCos returns the sine and cosine of angle in radians, computed with
+// integer-only CORDIC rotations.
+func FixedSinCos(angle Fixed) (sin, cos Fixed) {
+	z := (int64(angle) << (cordicShift - fixedShift)) % (2 * cordicPi)
+	if z > cordicPi {
+		z -= 2 * cordicPi
+	} else if z < -cordicPi {
+		z += 2 * cordicPi
+	}
+
+	// CORDIC only converges within ±π/2, rotate the rest by π
+	flip := false
+	if z > cordicPi/2 {
+		z, flip = z-cordicPi, true
+	} else if z < -cordicPi/2 {
+		z, flip = z+cordicPi, true
+	}
+
+	x, y := int64(cordicGain), int64(0)
+	for i, atan := range cordicAtan {
+		if z >= 0 {
+			x, y, z = x-y>>uint(i), y+x>>uint(i), z-atan
+		} else {
+			x, y, z = x+y>>uint(i), y-x>>uint(i), z+atan
+		}
+	}
+	if flip {
+		x, y = -x, -y
+	}
+
+	// Round to the nearest Fixed
+	const half = 1 << (cordicShift - fixedShift - 1)
+	return Fixed((y + half) >> (cordicShift - fixedShift)), Fixed((x + half) >> (cordicShift - fixedShift))
+}
+
+// IsCollisionFixed2D is IsCollision2D with exact fixed-point arithmetic.
+func IsCollisionFixed2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y Fixed) bool {
+	_, ok := IntersectFixed2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y)
+	return ok
+}
+
+// IntersectFixed2D is Intersect2D with fixed-point arithmetic. Every decision
+// is made on exact integer products like Intersect2D, but the position along
+// b is computed with integers too, so it's the same on every machine.
+func IntersectFixed2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y Fixed) (Fixed, bool) {
+	s1_x := int64(a2_x) - int64(a1_x)
+	s1_y := int64(a2_y) - int64(a1_y)
+	s2_x := int64(b2_x) - int64(b1_x)
+	s2_y := int64(b2_y) - int64(b1_y)
+
+	connected := a2_x == b1_x && a2_y == b1_y
+	denom := s1_x*s2_y - s2_x*s1_y
+	if denom == 0 {
+		// Parallel, only collinear segments can touch
+		if s1_x*(int64(b1_y)-int64(a1_y))-s1_y*(int64(b1_x)-int64(a1_x)) != 0 {
+			return 0, false
+		}
+		if s2_x*(int64(a1_y)-int64(b1_y))-s2_y*(int64(a1_x)-int64(b1_x)) != 0 {
+			return 0, false
+		}
+
+		if connected {
+			// Pointing away?
+			if (s1_x*s2_x < 0) || (s1_y*s2_y < 0) {
+				return 0, true
+			}
+			return 0, false
+		}
+
+		// Any of the wrong points connected? (Head-on connected)
+		if a2_x == b2_x && a2_y == b2_y {
+			return collinearEntryFixed(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, s2_x, s2_y), true
+		}
+
+		// Basically box collision
+		if minFixed(a1_x, a2_x) <= maxFixed(b1_x, b2_x) && maxFixed(a1_x, a2_x) >= minFixed(b1_x, b2_x) &&
+			minFixed(a1_y, a2_y) <= maxFixed(b1_y, b2_y) && maxFixed(a1_y, a2_y) >= minFixed(b1_y, b2_y) {
+			return collinearEntryFixed(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, s2_x, s2_y), true
+		}
+		return 0, false
+	}
+
+	if connected {
+		// Connected but not collinear
+		return 0, false
+	}
+
+	s3_x := int64(a1_x) - int64(b1_x)
+	s3_y := int64(a1_y) - int64(b1_y)
+
+	s_numer := s1_x*s3_y - s1_y*s3_x
+	t_numer := s2_x*s3_y - s2_y*s3_x
+	if denom < 0 {
+		// Same orientation either way, so that touching endpoints are treated
+		// the same no matter which way the segments wind.
+		denom, s_numer, t_numer = -denom, -s_numer, -t_numer
+	}
+	// All of a is solid, but the end of b is only reached on the next move.
+	if s_numer < 0 || t_numer < 0 || s_numer >= denom || t_numer > denom {
+		return 0, false
+	}
+
+	return fixedFraction(s_numer, denom), true
+}
+
+// collinearEntryFixed is collinearEntry with exact fixed-point arithmetic.
+func collinearEntryFixed(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y Fixed, s2_x, s2_y int64) Fixed {
+	l := s2_x*s2_x + s2_y*s2_y
+	if l == 0 {
+		return 0
+	}
+	t1 := (int64(a1_x)-int64(b1_x))*s2_x + (int64(a1_y)-int64(b1_y))*s2_y
+	t2 := (int64(a2_x)-int64(b1_x))*s2_x + (int64(a2_y)-int64(b1_y))*s2_y
+	if t2 < t1 {
+		t1 = t2
+	}
+	return fixedFraction(t1, l)
+}
+
+func minFixed(a, b Fixed) Fixed {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFixed(a, b Fixed) Fixed {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// fixedFraction returns numer/denom clamped to [0, 1], rounded down.
+func fixedFraction(numer, denom int64) Fixed {
+	if denom < 0 {
+		numer, denom = -numer, -denom
+	}
+	if numer <= 0 {
+		return 0
+	}
+	if numer >= denom {
+		return FixedOne
+	}
+	// numer < denom, so the quotient fits and the 128-bit product can't
+	// overflow the division.
+	hi, lo := bits.Mul64(uint64(numer), uint64(FixedOne))
+	q, _ := bits.Div64(hi, lo, uint64(denom))
+	return Fixed(q)
+}
+
+// intersectFixed is Intersect2D of the X/Z planes of a -> b and p0 -> p1 in
+// fixed-point.
+func intersectFixed(a, b, p0, p1 mgl.Vec3) (float32, bool) {
+	fixed := func(v float32) Fixed { return ToFixed(float64(v)) }
+	t, ok := IntersectFixed2D(fixed(a[0]), fixed(a[2]), fixed(b[0]), fixed(b[2]), fixed(p0[0]), fixed(p0[2]), fixed(p1[0]), fixed(p1[2]))
+	return t.Float(), ok
+}
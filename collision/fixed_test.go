@@ -0,0 +1,75 @@
+package collision
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestFixedSinCos(t *testing.T) {
+	for _, angle := range []float64{0, 0.1, -0.1, 0.5, 1, math.Pi / 2, 2, -2, math.Pi, -math.Pi, 4, 100, -1234.5} {
+		sin, cos := FixedSinCos(FixedAngle(angle))
+		if d := math.Abs(float64(sin.Float()) - math.Sin(angle)); d > 1e-4 {
+			t.Errorf("sin(%v): got %v; want %v", angle, sin.Float(), math.Sin(angle))
+		}
+		if d := math.Abs(float64(cos.Float()) - math.Cos(angle)); d > 1e-4 {
+			t.Errorf("cos(%v): got %v; want %v", angle, cos.Float(), math.Cos(angle))
+		}
+	}
+}
+
+func TestIsCollisionFixed(t *testing.T) {
+	tests := []struct {
+		result bool
+
+		a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float64
+	}{
+		{true, 0, 0, 1, 1, 1, 1, 0, 0},      // a -> -a
+		{true, 0, 0, 1, 1, 1, 1, 0.5, 0.5},  // a -> b intersect
+		{false, 0, 0, 1, 1, 1, 1, 2, 2},     // a -> b
+		{false, 2, 2, 1, 1, 1, 1, 0.5, 0.5}, // b -> a
+		{true, 0, 0, 4, 4, 1, 1, 2, 2},      // a -> d, b -> c, collinear contained
+		{false, 0, 1, 0, 4, 1, 3, 1, 2},     // a -> d, b -> c, parallel offset
+		{true, 1, 0, 2, 0, 3, 0, 2, 0},      // a -> b <- c
+		{true, 0, 1, 0, 4, 0, 1, 1, 3},      // a -> b, a->c, non-collinear
+		{false, 0, 1, 0, 4, 0, 4, 1, 3},
+		{true, 3, 1, 3, 2, 2.5, 1.5, 3.5, 1},
+		{false, 2, 1, 3, 1, 1, 0, 2, 0}, // collinear disjoint vertically
+		{false, 1.37, 1.39, 1.34, 1.35, 1.31, 1.31, 1.34, 1.35},
+	}
+
+	for i, test := range tests {
+		r := IsCollisionFixed2D(ToFixed(test.a1_x), ToFixed(test.a1_y), ToFixed(test.a2_x), ToFixed(test.a2_y), ToFixed(test.b1_x), ToFixed(test.b1_y), ToFixed(test.b2_x), ToFixed(test.b2_y))
+		if r != test.result {
+			t.Errorf("IsCollisionFixed2D test #%d failed: %v", i, test)
+		}
+	}
+
+	// Crossing halfway along b
+	s, ok := IntersectFixed2D(0, 0, 2*FixedOne, 0, FixedOne, -FixedOne, FixedOne, FixedOne)
+	if !ok || s != FixedOne/2 {
+		t.Errorf("expected intersection at %v; got %v, %v", FixedOne/2, s, ok)
+	}
+}
+
+// reproducible returns newCollider with SetReproducible.
+func reproducible(newCollider func(image.Rectangle) Collider) func(image.Rectangle) Collider {
+	return func(bounds image.Rectangle) Collider {
+		collider := newCollider(bounds)
+		collider.SetReproducible(true)
+		return collider
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	// The same suites hold in fixed-point
+	colliderTester(t, reproducible(GridCollider))
+	multiColliderTester(t, reproducible(LinearCollider))
+
+	c := segmentCollision(mgl.Vec3{0, 0, 0}, mgl.Vec3{2, 0, 0}, mgl.Vec3{1, 0, -1}, mgl.Vec3{1, 0, 3}, 0, 0, true, 0, 0, false)
+	if c == nil || c.T != 0.25 || c.Point != (mgl.Vec3{1, 0, 0}) {
+		t.Errorf("expected collision at [1 0 0] 0.25 along; got %v", c)
+	}
+}
@@ -0,0 +1,251 @@
+package collision
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Lines start spread out across the arena.
+var fuzzStarts = []mgl.Vec3{{-5, 0, -5}, {5, 0, 5}, {-5, 0, 6}}
+
+// replayMoves decodes data into turns and extensions of a few lines, like the
+// Extending suites, and replays them against every collider at once. It
+// returns the first move where the colliders disagree about the collision.
+func replayMoves(data []byte, colliders ...Collider) error {
+	return replay(data, replayOptions{}, colliders...)
+}
+
+// replayOptions are the rules of the arena that replay follows like Line does.
+type replayOptions struct {
+	// Wrap lines around the boundary, unless it's nil.
+	wrap *Boundary
+	// Leave gaps in the trails, two moves long out of every eight moves.
+	gaps bool
+}
+
+// replay is replayMoves with other rules.
+func replay(data []byte, opts replayOptions, colliders ...Collider) error {
+	type line struct {
+		// Each collider trims its own copy of the line.
+		segments [][]mgl.Vec3
+		heading  float64
+		trackers []Tracker
+		crashed  bool
+		// Where the line enters again after it wrapped, if it did.
+		entry *mgl.Vec3
+		moves int
+	}
+	lines := make([]*line, len(fuzzStarts))
+	for i, start := range fuzzStarts {
+		l := &line{segments: make([][]mgl.Vec3, len(colliders)), heading: float64(i) * math.Pi / 2}
+		for j, collider := range colliders {
+			l.segments[j] = []mgl.Vec3{start}
+			l.trackers = append(l.trackers, collider.Track(&l.segments[j]))
+		}
+		lines[i] = l
+	}
+
+	// Each move is 3 bytes: which line and whether it turns, the angle of the
+	// turn, and how far to move and whether to trim the tail first.
+	for i := 0; i+2 < len(data); i += 3 {
+		l := lines[int(data[i]>>1)%len(lines)]
+		if l.crashed {
+			continue
+		}
+		if data[i+2]&0xe0 == 0xe0 {
+			for _, tracker := range l.trackers {
+				tracker.Trim(2)
+			}
+		}
+		segment := l.segments[0]
+		turning := data[i]&1 == 1 || len(segment) < 2
+		if turning {
+			l.heading += (float64(data[i+1]) - 128) / 128 * math.Pi
+		}
+		dist := float64(data[i+2]%32+1) / 16
+
+		head := segment[len(segment)-1]
+		entry := l.entry
+		if entry != nil {
+			head, l.entry = *entry, nil
+		}
+		next := mgl.Vec3{head[0] + float32(math.Cos(l.heading)*dist), 0, head[2] + float32(math.Sin(l.heading)*dist)}
+		if opts.wrap != nil {
+			if exit, entry, ok := opts.wrap.Wrap(head, next); ok {
+				next, l.entry = exit, &entry
+			}
+		}
+		l.moves++
+		gap := opts.gaps && l.moves%8 == 5
+		inGap := opts.gaps && l.moves%8 == 6
+		for j := range l.segments {
+			if entry != nil || gap {
+				l.segments[j] = append(l.segments[j], Break, head, next)
+			} else if inGap {
+				// Only the head is left while in a gap
+				n := len(l.segments[j])
+				l.segments[j][n-2], l.segments[j][n-1] = head, next
+			} else if turning {
+				l.segments[j] = append(l.segments[j], next)
+			} else {
+				l.segments[j][len(l.segments[j])-1] = next
+			}
+		}
+
+		errs := make([]error, len(l.trackers))
+		for j, tracker := range l.trackers {
+			errs[j] = tracker.Update()
+		}
+		for j := 1; j < len(errs); j++ {
+			if !sameCollision(errs[0], errs[j]) {
+				return fmt.Errorf("move %d of line %d to %v: %T says %v; %T says %v", i/3, l.trackers[0].ID(), next, colliders[0], errs[0], colliders[j], errs[j])
+			}
+		}
+		l.crashed = errs[0] != nil
+	}
+	return nil
+}
+
+// sameCollision returns true if both errors are the same kind of collision at
+// the same point.
+func sameCollision(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if fmt.Sprintf("%T", a) != fmt.Sprintf("%T", b) {
+		return false
+	}
+	ia, _ := Impact(a)
+	ib, _ := Impact(b)
+	return ia == ib
+}
+
+// fullWalkGrid is a grid which walks the whole head segment on every update.
+func fullWalkGrid(bounds image.Rectangle, opts GridOptions) Collider {
+	grid := NewGridCollider(bounds, opts).(*gridCollider)
+	grid.fullWalk = true
+	return grid
+}
+
+func FuzzGridLinear(f *testing.F) {
+	f.Add([]byte{0, 0, 31, 1, 64, 31, 1, 64, 31, 1, 64, 31})
+	f.Add([]byte{0, 0, 15, 0, 0, 15, 0, 0, 15, 2, 0, 31, 3, 200, 31, 2, 0, 31})
+	f.Add([]byte{1, 32, 3, 1, 96, 3, 1, 160, 3, 1, 224, 3, 0, 0, 1, 0, 0, 1})
+
+	bounds := image.Rect(-10, -10, 10, 10)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		colliders := []Collider{LinearCollider(bounds), GridCollider(bounds), NewGridCollider(bounds, GridOptions{CellSize: 0.3}), fullWalkGrid(bounds, GridOptions{})}
+		if err := replayMoves(data, colliders...); err != nil {
+			attachPictures(t, colliders...)
+			t.Error(err)
+		}
+	})
+}
+
+// TestGridLinear runs random move sequences through FuzzGridLinear's replay,
+// so that regular test runs cover it too.
+func TestGridLinear(t *testing.T) {
+	n := 2000
+	if testing.Short() {
+		n = 200
+	}
+	bounds := image.Rect(-10, -10, 10, 10)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < n; i++ {
+		data := make([]byte, 3*(1+rng.Intn(100)))
+		rng.Read(data)
+		colliders := []Collider{LinearCollider(bounds), GridCollider(bounds), NewGridCollider(bounds, GridOptions{CellSize: 0.3}), QuadtreeCollider(bounds)}
+		if err := replayMoves(data, colliders...); err != nil {
+			attachPictures(t, colliders...)
+			t.Fatalf("%s\n\tdata: %v", err, data)
+		}
+	}
+}
+
+// TestGridExtending checks that extending the head only where it grew gets
+// the same results as walking the whole head, with long straight runs.
+func TestGridExtending(t *testing.T) {
+	n := 2000
+	if testing.Short() {
+		n = 200
+	}
+	bounds := image.Rect(-10, -10, 10, 10)
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < n; i++ {
+		data := make([]byte, 3*(1+rng.Intn(200)))
+		rng.Read(data)
+		for j := 0; j < len(data); j += 3 {
+			// Mostly short extensions
+			if rng.Intn(8) > 0 {
+				data[j] &^= 1
+				data[j+2] %= 4
+			}
+		}
+		colliders := []Collider{fullWalkGrid(bounds, GridOptions{}), GridCollider(bounds), NewGridCollider(bounds, GridOptions{CellSize: 0.3, Sparse: true})}
+		if err := replayMoves(data, colliders...); err != nil {
+			attachPictures(t, colliders...)
+			t.Fatalf("%s\n\tdata: %v", err, data)
+		}
+	}
+}
+
+// TestWrapGridLinear is TestGridLinear in a wraparound arena, where lines
+// are split into runs wherever they wrap.
+func TestWrapGridLinear(t *testing.T) {
+	n := 1000
+	if testing.Short() {
+		n = 100
+	}
+	bounds := image.Rect(-10, -10, 10, 10)
+	wrap := Boundary{-10, -10, 10, 10}
+	rng := rand.New(rand.NewSource(5))
+	for i := 0; i < n; i++ {
+		data := make([]byte, 3*(1+rng.Intn(200)))
+		rng.Read(data)
+		radius := float32(rng.Intn(3)) / 10
+		colliders := []Collider{
+			thick{LinearCollider(bounds), radius},
+			thick{GridCollider(bounds), radius},
+			thick{NewGridCollider(bounds, GridOptions{CellSize: 0.3, Sparse: true}), radius},
+			thick{QuadtreeCollider(bounds), radius},
+		}
+		for _, collider := range colliders {
+			collider.SetWrap(true)
+		}
+		if err := replay(data, replayOptions{wrap: &wrap}, colliders...); err != nil {
+			attachPictures(t, colliders...)
+			t.Fatalf("radius %v: %s\n\tdata: %v", radius, err, data)
+		}
+	}
+}
+
+// TestGapGridLinear is TestGridLinear with gaps in the trails, which only
+// leave the head behind while they last.
+func TestGapGridLinear(t *testing.T) {
+	n := 1000
+	if testing.Short() {
+		n = 100
+	}
+	bounds := image.Rect(-10, -10, 10, 10)
+	rng := rand.New(rand.NewSource(6))
+	for i := 0; i < n; i++ {
+		data := make([]byte, 3*(1+rng.Intn(200)))
+		rng.Read(data)
+		radius := float32(rng.Intn(3)) / 10
+		colliders := []Collider{
+			thick{LinearCollider(bounds), radius},
+			thick{GridCollider(bounds), radius},
+			thick{NewGridCollider(bounds, GridOptions{CellSize: 0.3, Sparse: true}), radius},
+			thick{QuadtreeCollider(bounds), radius},
+		}
+		if err := replay(data, replayOptions{gaps: true}, colliders...); err != nil {
+			attachPictures(t, colliders...)
+			t.Fatalf("radius %v: %s\n\tdata: %v", radius, err, data)
+		}
+	}
+}
@@ -4,183 +4,857 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"math"
+	"sort"
 
 	mgl "github.com/go-gl/mathgl/mgl32"
 )
 
+// GridCollider is a collision checker backed by a dense grid of cells which
+// are 1 world unit in size.
 func GridCollider(bounds image.Rectangle) Collider {
+	return NewGridCollider(bounds, GridOptions{})
+}
+
+// GridOptions configures a grid collider.
+type GridOptions struct {
+	// CellSize is the width and height of each cell in world units, 1 if
+	// unset. Smaller cells are cheaper to check in crowded arenas, larger cells
+	// are cheaper to walk through in sparse ones.
+	CellSize float32
+	// Sparse stores the cells in a hash map keyed by index, only allocating
+	// cells once something passes through them. Memory grows with the length
+	// of the trails rather than the size of the arena.
+	Sparse bool
+}
+
+func NewGridCollider(bounds image.Rectangle, opts GridOptions) Collider {
+	cellSize := opts.CellSize
+	if cellSize <= 0 {
+		cellSize = 1
+	}
 	size := bounds.Size()
 
 	grid := &gridCollider{
-		bounds: Boundary{float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Max.X), float32(bounds.Max.Y)},
-		width:  size.X,
-		height: size.Y,
+		bounds:   Boundary{float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Max.X), float32(bounds.Max.Y)},
+		cellSize: cellSize,
+		width:    int(math.Ceil(float64(float32(size.X) / cellSize))),
+		height:   int(math.Ceil(float64(float32(size.Y) / cellSize))),
+		sparse:   opts.Sparse,
 	}
+	grid.SetOutline(nil)
 	grid.Reset()
 	return grid
 }
 
 type gridCollider struct {
-	bounds Boundary
-	width  int
-	height int
-	grid   []gridCell
+	bounds    Boundary
+	edge      boundary
+	obstacles obstacles
+	cellSize  float32
+	width     int
+	height    int
+	sparse    bool
+	cells     cellStore
+
+	// Height of the walls of trails, or 0 to ignore heights.
+	wallHeight float32
+
+	// Intersect segments in fixed-point, see SetReproducible.
+	reproducible bool
+
+	// Walk the whole head segment on every update, rather than only where it
+	// was extended. Used to check that extending gets the same results.
+	fullWalk bool
+
+	// Changes during UpdateAll.
+	batch *gridBatch
+
+	// Subscribers to events.
+	hooks
+
+	// Every line tracked since the last reset, by ID.
+	tracked    []*gridTracker
+	numTracked int
 }
 
 func (grid *gridCollider) String() string {
 	w := &bytes.Buffer{}
-	for idx, cell := range grid.grid {
-		if len(cell) == 0 {
-			continue
-		}
+	grid.cells.Each(func(idx int, cell gridCell) {
+		x := float32(idx%grid.width)*grid.cellSize + grid.bounds.X1
+		y := float32(idx/grid.width)*grid.cellSize + grid.bounds.Y1
 
-		x := idx%grid.width + int(grid.bounds.X1)
-		y := (idx-x)/grid.height + int(grid.bounds.Y1)
+		fmt.Fprintf(w, "[%v,%v] %v\n", x, y, cell)
+	})
+	return w.String()
+}
 
-		fmt.Fprintf(w, "[%d,%d] %+v\n", x, y, cell)
+func (grid *gridCollider) UpdateAll(trackers []Tracker) []error {
+	grid.batch = &gridBatch{
+		cells:    map[int]bool{},
+		notified: map[*gridTracker]bool{},
+		moved:    map[*gridTracker]bool{},
 	}
-	return w.String()
+	defer func() { grid.batch = nil }()
+	return updateAll(grid, trackers)
 }
 
-func (grid *gridCollider) Reset() {
-	grid.grid = make([]gridCell, grid.width*grid.height, grid.width*grid.height)
+func (grid *gridCollider) UpdateTick(trackers []Tracker, rule TickRule) []error {
+	return updateTick(grid, &grid.hooks, grid.wallHeight, grid.reproducible, trackers, rule)
 }
 
-func (grid *gridCollider) Track(segment *[]mgl.Vec3) Tracker {
-	return &gridTracker{
-		grid:    grid,
-		segment: segment,
+func (grid *gridCollider) SetOutline(outline *Outline) {
+	grid.edge = grid.bounds
+	if outline != nil {
+		grid.edge = outline
 	}
 }
 
-func (grid *gridCollider) index(x, y float32) int {
-	return int(x-grid.bounds.X1) + int(y-grid.bounds.Y1)*grid.width
+func (grid *gridCollider) SetWrap(wrap bool) {
+	grid.edge = grid.bounds
+	if wrap {
+		grid.edge = unbounded{}
+	}
 }
 
-type gridTracker struct {
-	grid    *gridCollider
-	cs      *cellSegment
-	segment *[]mgl.Vec3
+func (grid *gridCollider) SetWallHeight(height float32) {
+	grid.wallHeight = height
 }
 
-func (tracker *gridTracker) Update() error {
-	cs := tracker.cs
-	segment := *tracker.segment
-	grid := tracker.grid
+func (grid *gridCollider) SetReproducible(reproducible bool) {
+	grid.reproducible = reproducible
+}
 
-	if len(segment) < 2 {
-		return nil
+func (grid *gridCollider) SetObstacles(obs []*Obstacle) {
+	grid.obstacles = obs
+}
+
+func (grid *gridCollider) Reset() {
+	if grid.sparse {
+		grid.cells = sparseCells{}
+	} else {
+		grid.cells = make(denseCells, grid.width*grid.height)
 	}
+	grid.tracked = nil
+	grid.numTracked = 0
+	grid.collision = nil
+}
 
-	offset := len(segment) - 2
+// Picture shows the cells which hold segments.
+func (grid *gridCollider) Picture() *Picture {
+	pic := newPicture(grid.bounds, grid.edge, grid.obstacles, &grid.hooks)
+	for _, tracker := range grid.tracked {
+		if !tracker.closed {
+			pic.line(tracker.id, tracker.radius, *tracker.segment)
+		}
+	}
+	grid.cells.Each(func(idx int, cell gridCell) {
+		x := float32(idx%grid.width)*grid.cellSize + grid.bounds.X1
+		y := float32(idx/grid.width)*grid.cellSize + grid.bounds.Y1
+		pic.Cells = append(pic.Cells, Boundary{x, y, x + grid.cellSize, y + grid.cellSize})
+	})
+	return pic
+}
 
-	var vec mgl.Vec3 = segment[offset+1]
-	x1, y1 := vec[0], vec[2]
+func (grid *gridCollider) Track(segment *[]mgl.Vec3) Tracker {
+	return grid.TrackRadius(segment, 0)
+}
 
-	// Check boundary
-	if grid.bounds.X1 >= x1 || x1 >= grid.bounds.X2 ||
-		grid.bounds.Y1 >= y1 || y1 >= grid.bounds.Y2 {
-		return CollisionBoundary
+func (grid *gridCollider) TrackRadius(segment *[]mgl.Vec3, radius float32) Tracker {
+	tracker := &gridTracker{
+		trackedLine: newTrackedLine(grid, segment, grid.numTracked, radius),
+		grid:        grid,
+		cellIdx:     -1,
 	}
+	grid.tracked = append(grid.tracked, tracker)
+	grid.numTracked += 1
+	return tracker
+}
 
-	// Check segment collision
-	vec = segment[offset]
-	x0, y0 := vec[0], vec[2]
+func (grid *gridCollider) Untrack(t Tracker) {
+	tracker, ok := t.(*gridTracker)
+	if !ok || tracker.grid != grid || tracker.closed {
+		return
+	}
+	segment := *tracker.segment
+	for i := 0; i+1 < len(segment); i++ {
+		grid.unregister(tracker, tracker.trimmed+i, segment[i], segment[i+1])
+	}
+	tracker.closed = true
+	tracker.near, tracker.pending = nil, nil
+}
 
-	dx, dy := x1-x0, y1-y0
-	steps := (dx*dx + dy*dy)
-	if steps > 1.0 {
-		dx, dy = dx/steps, dy/steps
+// unregister removes the tracker's segment at offset, which is a -> b, from
+// every cell it could have been registered in. That's the cells its capsule
+// overlaps, and the ones around them since it may have been registered before
+// rounding nudged it. Gaps were never registered.
+func (grid *gridCollider) unregister(tracker *gridTracker, offset int, a, b mgl.Vec3) {
+	if isGap(a, b) {
+		return
 	}
+	k := grid.reach(tracker.radius) + 1
+	prev := -1
+	grid.walk(a[0], a[2], b[0], b[2], func(idx int, exit float32) bool {
+		grid.around(idx, prev, k, func(idx int) {
+			if len(grid.cells.Get(idx)) == 0 {
+				return
+			}
+			cell := grid.cells.Cell(idx)
+			cell.Remove(tracker, offset)
+			if cell.Len() == 0 {
+				grid.cells.Free(idx)
+			}
+		})
+		prev = idx
+		return true
+	})
+}
 
-	// Extending only works if the extension is collinearly forward. All hell
-	// will break loose otherwise.
-	extending := cs != nil && cs.offset == offset
+// reach returns how many cells around a cell are within d of it.
+func (grid *gridCollider) reach(d float32) int {
+	return int(math.Ceil(float64(d / grid.cellSize)))
+}
 
-	// Check cell segments
-	var lastIdx int = -1
-	var err error
-	for ; steps >= 0; steps -= 1.0 {
-		idx := grid.index(x1-dx*steps, y1-dy*steps)
-		if idx == lastIdx {
-			// FIXME: This is happening more than it should
+// around calls fn with every cell within k cells of the cell at idx, except
+// for the ones which are also within k cells of the cell at prev, unless prev
+// is negative. Cells along a walk are in order, so skipping the ones around
+// the previous cell skips every cell that was already around one of them.
+func (grid *gridCollider) around(idx, prev, k int, fn func(idx int)) {
+	col, row := idx%grid.width, idx/grid.width
+	prevCol, prevRow := prev%grid.width, prev/grid.width
+	for r := row - k; r <= row+k; r++ {
+		if r < 0 || r >= grid.height {
 			continue
 		}
-		if idx > len(grid.grid) && err == nil {
-			err = CollisionBoundary
-			break
-		}
-		lastIdx = idx
-
-		if extending && false {
-			// Skip until we reach the last cell we filled last
-			if cs.cellIdx == idx {
-				extending = false
-			} else {
+		for c := col - k; c <= col+k; c++ {
+			if c < 0 || c >= grid.width {
 				continue
 			}
+			if prev >= 0 && prevCol-k <= c && c <= prevCol+k && prevRow-k <= r && r <= prevRow+k {
+				continue
+			}
+			fn(c + r*grid.width)
 		}
+	}
+}
 
-		if cs != nil && cs.cellIdx == idx && len(cs.segment) == len(segment)-offset+1 {
-			// Already set
-			continue
+// cell returns the column and row of the cell containing x, y, clamped to
+// the grid.
+func (grid *gridCollider) cell(x, y float32) (int, int) {
+	col, row := int((x-grid.bounds.X1)/grid.cellSize), int((y-grid.bounds.Y1)/grid.cellSize)
+	if col < 0 {
+		col = 0
+	} else if col >= grid.width {
+		col = grid.width - 1
+	}
+	if row < 0 {
+		row = 0
+	} else if row >= grid.height {
+		row = grid.height - 1
+	}
+	return col, row
+}
+
+// walk visits the cells along segment x0,y0 -> x1,y1 in order, calling fn
+// with the index of each cell within the grid and the fraction along the
+// segment where it leaves that cell, until fn returns false. When the segment
+// passes exactly through a corner, both cells beside the corner are visited.
+//
+// Every point of the segment is within one of the visited cells, counting
+// points on an edge between cells as within the cell after the edge. So two
+// segments which touch always share a visited cell. Points on the far edges of
+// the grid, which wrapping lines run up to, are within the last cells.
+func (grid *gridCollider) walk(x0, y0, x1, y1 float32, fn func(idx int, exit float32) bool) {
+	// Cell coordinates relative to the grid
+	size := float64(grid.cellSize)
+	gx0, gy0 := (float64(x0)-float64(grid.bounds.X1))/size, (float64(y0)-float64(grid.bounds.Y1))/size
+	gx1, gy1 := (float64(x1)-float64(grid.bounds.X1))/size, (float64(y1)-float64(grid.bounds.Y1))/size
+	gx0, gx1 = withinLast(gx0, grid.width), withinLast(gx1, grid.width)
+	gy0, gy1 = withinLast(gy0, grid.height), withinLast(gy1, grid.height)
+	dx, dy := gx1-gx0, gy1-gy0
+	col, row := int(math.Floor(gx0)), int(math.Floor(gy0))
+
+	stepCol, nextX, deltaX := 0, math.Inf(1), math.Inf(1)
+	if dx > 0 {
+		stepCol, nextX, deltaX = 1, (float64(col+1)-gx0)/dx, 1/dx
+	} else if dx < 0 {
+		stepCol, nextX, deltaX = -1, (gx0-float64(col))/-dx, -1/dx
+	}
+	stepRow, nextY, deltaY := 0, math.Inf(1), math.Inf(1)
+	if dy > 0 {
+		stepRow, nextY, deltaY = 1, (float64(row+1)-gy0)/dy, 1/dy
+	} else if dy < 0 {
+		stepRow, nextY, deltaY = -1, (gy0-float64(row))/-dy, -1/dy
+	}
+
+	visit := func(col, row int, exit float64) bool {
+		if col < 0 || col >= grid.width || row < 0 || row >= grid.height {
+			return true
+		}
+		return fn(col+row*grid.width, float32(math.Min(exit, 1)))
+	}
+
+	for {
+		exit := math.Min(nextX, nextY)
+		if !visit(col, row, exit) {
+			return
+		}
+		if exit >= 1 {
+			// Ending exactly on an edge touches the cell after it too
+			if endCol, endRow := int(math.Floor(gx1)), int(math.Floor(gy1)); endCol != col || endRow != row {
+				visit(endCol, endRow, 1)
+			}
+			return
 		}
+		if nextX == nextY {
+			// Through the corner, visit both cells beside it
+			if !visit(col+stepCol, row, exit) || !visit(col, row+stepRow, exit) {
+				return
+			}
+			col, row = col+stepCol, row+stepRow
+			nextX, nextY = nextX+deltaX, nextY+deltaY
+		} else if nextX < nextY {
+			col += stepCol
+			nextX += deltaX
+		} else {
+			row += stepRow
+			nextY += deltaY
+		}
+	}
+}
 
-		if err == nil {
-			err = grid.grid[idx].IsCollision(x0, y0, x1, y1)
+// withinLast nudges g back into the last of n cells if it's exactly on the
+// far edge.
+func withinLast(g float64, n int) float64 {
+	if g == float64(n) {
+		return math.Nextafter(g, 0)
+	}
+	return g
+}
+
+func (grid *gridCollider) Raycast(origin, direction mgl.Vec3, maxDist float32) *RayHit {
+	return grid.raycast(nil, origin, direction, maxDist)
+}
+
+// raycast walks the cells along the ray, stopping as soon as the nearest hit
+// so far is within the cells that were already visited.
+func (grid *gridCollider) raycast(self *gridTracker, origin, direction mgl.Vec3, maxDist float32) *RayHit {
+	r, ok := newRay(origin, direction, maxDist)
+	if !ok {
+		return nil
+	}
+	r.height = grid.wallHeight
+
+	head := -1
+	if self != nil {
+		head = self.trimmed + len(*self.segment) - 2
+	}
+
+	var hit *RayHit
+	end := r.end()
+	grid.walk(origin[0], origin[2], end[0], end[2], func(idx int, exit float32) bool {
+		for _, cs := range grid.cells.Get(idx) {
+			if cs.tracker == self && cs.offset == head {
+				continue
+			}
+			a, b, ok := cs.Points()
+			if !ok {
+				continue
+			}
+			hit = nearerHit(hit, r.segmentHit(a, b, cs.tracker.id))
 		}
+		return hit == nil || hit.Distance > exit*maxDist
+	})
+	return nearerHit(nearerHit(hit, r.boundaryHit(grid.edge)), grid.obstacles.hit(r))
+}
+
+func (grid *gridCollider) Nearest(point mgl.Vec3, radius float32) *Proximity {
+	return grid.nearest(nil, point, point, radius)
+}
+
+// nearest checks every cell overlapping the bounding box of p0 -> p1 grown
+// by radius.
+func (grid *gridCollider) nearest(self *gridTracker, p0, p1 mgl.Vec3, radius float32) *Proximity {
+	minX, maxX := p0[0], p1[0]
+	if minX > maxX {
+		minX, maxX = maxX, minX
+	}
+	minY, maxY := p0[2], p1[2]
+	if minY > maxY {
+		minY, maxY = maxY, minY
+	}
+	col0, row0 := grid.cell(minX-radius, minY-radius)
+	col1, row1 := grid.cell(maxX+radius, maxY+radius)
 
-		cell := &grid.grid[idx]
-		if cs == nil || cs.cellIdx != idx {
-			*cell = append(*cell, cellSegment{
-				cellIdx:    idx,
-				segmentIdx: len(*cell),
-				offset:     offset,
-			})
-			cs = &grid.grid[idx][len(*cell)-1]
+	skip, clip := -1, float32(0)
+	if self != nil {
+		skip, clip = nearSkip(*self.segment, radius)
+		skip += self.trimmed
+	}
+
+	near := grid.obstacles.proximity(p0, p1, radius)
+	for row := row0; row <= row1; row++ {
+		for col := col0; col <= col1; col++ {
+			for _, cs := range grid.cells.Get(col + row*grid.width) {
+				if cs.tracker == self && cs.offset > skip {
+					continue
+				}
+				a, b, ok := cs.Points()
+				if !ok {
+					continue
+				}
+				if cs.tracker == self && cs.offset == skip {
+					b = lerp(a, b, clip)
+				}
+				if p := segmentProximity(a, b, p0, p1, radius, grid.wallHeight, cs.tracker.id, cs.tracker == self); p != nil && (near == nil || p.Distance < near.Distance) {
+					near = p
+				}
+			}
 		}
-		cs.segment = segment[cs.offset:]
 	}
+	return near
+}
 
-	tracker.cs = cs
-	return err
+type gridTracker struct {
+	trackedLine
+	grid *gridCollider
+
+	// Number of points that were trimmed off the start of the line. Offsets
+	// of its segments count from the first point it ever had, so that the
+	// registered ones don't change when it's trimmed.
+	trimmed int
+
+	// Cursor of the last cell the head segment was registered in, and where
+	// the head started and ended when it was registered.
+	cellIdx int
+	offset  int
+	start   mgl.Vec3
+	end     mgl.Vec3
+
+	// How far rounding could have nudged the head away from the cells it was
+	// registered in, since it was last walked from the start.
+	drift float32
+
+	// Segments which were found near the head segment, and segments which
+	// other lines registered next to its cells since the last update.
+	near    []cellSegment
+	pending []cellSegment
+
+	// What the last check found, until it's committed.
+	pass gridPass
 }
 
-type cellSegment struct {
+// Most heads of other lines that a line is told about between its updates.
+// Beyond that, it walks its whole head again instead of remembering them, so
+// that lines which stopped updating, such as crashed ones, don't keep growing.
+const maxPending = 64
+
+// gridPass is what checking the head of a line found.
+type gridPass struct {
+	// Nothing to commit, such as for a gap.
+	noop bool
+	err  error
+
+	// Where the head was registered, as for gridTracker.
 	cellIdx    int
-	segmentIdx int
 	offset     int
-	segment    []mgl.Vec3
+	start, end mgl.Vec3
+	drift      float32
+	near       []cellSegment
+
+	// Segments which were already checked.
+	seen map[cellSegment]bool
+
+	// Cells to register the head with, and lines to tell about it.
+	cells  []int
+	notify []*gridTracker
+
+	// Cells that were checked, and lines whose head was checked, during
+	// UpdateAll.
+	visited []int
+	heads   []*gridTracker
 }
 
-type gridCell []cellSegment
+// gridBatch is what lines changed while committing during UpdateAll.
+type gridBatch struct {
+	// Cells that heads were registered with.
+	cells map[int]bool
+	// Lines that were told about other heads.
+	notified map[*gridTracker]bool
+	// Lines whose head moved on to a new segment.
+	moved map[*gridTracker]bool
+}
 
-func (cell *gridCell) Len() int {
-	n := 0
-	for _, cs := range *cell {
-		n += len(cs.segment)
+func (tracker *gridTracker) Near(radius float32) *Proximity {
+	segment := *tracker.segment
+	n := len(segment)
+	if n < 2 || isGap(segment[n-2], segment[n-1]) {
+		return nil
+	}
+	return tracker.grid.nearest(tracker, segment[n-2], segment[n-1], radius)
+}
+
+func (tracker *gridTracker) Raycast(direction mgl.Vec3, maxDist float32) *RayHit {
+	segment := *tracker.segment
+	if len(segment) == 0 || IsBreak(segment[len(segment)-1]) {
+		return nil
 	}
-	return n
+	return tracker.grid.raycast(tracker, segment[len(segment)-1], direction, maxDist)
 }
 
-func (cell *gridCell) IsCollision(x0, y0, x1, y1 float32) error {
-	var vec mgl.Vec3
-	for _, cellSegment := range *cell {
-		for i := 1; i < len(cellSegment.segment); i += 1 {
-			vec = cellSegment.segment[i-1]
-			seg_x0, seg_y0 := vec[0], vec[2]
+func (tracker *gridTracker) Trim(n int) {
+	segment := *tracker.segment
+	if n > len(segment)-2 {
+		n = len(segment) - 2
+	}
+	if n <= 0 {
+		return
+	}
+	if !tracker.closed {
+		for i := 0; i < n; i++ {
+			tracker.grid.unregister(tracker, tracker.trimmed+i, segment[i], segment[i+1])
+		}
+	}
+	*tracker.segment = segment[n:]
+	tracker.trimmed += n
+}
+
+func (tracker *gridTracker) Close() {
+	tracker.grid.Untrack(tracker)
+}
 
-			vec = cellSegment.segment[i]
-			seg_x1, seg_y1 := vec[0], vec[2]
+func (tracker *gridTracker) Update() error {
+	tracker.check()
+	return tracker.commit()
+}
 
-			if IsCollision2D(seg_x0, seg_y0, seg_x1, seg_y1, x0, y0, x1, y1) {
-				if seg_x0 == x0 && seg_y0 == y0 && seg_x1 == x1 && seg_y1 == y1 {
-					// FIXME: Temporary hack to avoid checking the same segment
-					continue
-				}
-				return &CollisionSegment{seg_x0, seg_y0, seg_x1, seg_y1}
+// check finds the collision of the head, and which cells to register it with
+// and which lines to tell about it, without changing the grid or any line.
+func (tracker *gridTracker) check() {
+	pass := &tracker.pass
+	pass.noop = true
+	segment := *tracker.segment
+	grid := tracker.grid
+
+	head0, head1, offset, ok := headOf(segment, tracker.closed)
+	if !ok {
+		return
+	}
+	offset += tracker.trimmed
+
+	// Extending the head only walks the cells from where it ended last time.
+	// Line.Add stretches the head along its direction, but rounding nudges
+	// the rest of it by up to the deviation of the old end. As long as the
+	// total drift stays within maxDrift, anything the rest of the head could
+	// reach was registered next to its cells, and anything that close was
+	// kept as near. Otherwise the whole head is walked again. Keeping
+	// maxDrift tiny keeps near down to what practically touches the head,
+	// so that running alongside a trail doesn't check all of it every time.
+	slack := grid.cellSize / 4
+	maxDrift := grid.cellSize / 256
+	from := head0
+	known := tracker.pending
+	pass.drift = 0
+	if !grid.fullWalk && tracker.cellIdx >= 0 && tracker.offset == offset && tracker.start == head0 {
+		if dev, ok := deviation(head0, tracker.end, head1); ok && tracker.drift+dev <= maxDrift {
+			pass.drift = tracker.drift + dev
+			from = tracker.end
+			known = append(known[:len(known):len(known)], tracker.near...)
+		}
+	}
+	pass.near = nil
+	if pass.seen == nil {
+		pass.seen = map[cellSegment]bool{}
+	}
+	for cs := range pass.seen {
+		delete(pass.seen, cs)
+	}
+	pass.cells, pass.notify = pass.cells[:0], pass.notify[:0]
+	pass.visited, pass.heads = pass.visited[:0], pass.heads[:0]
+	batching := grid.batch != nil
+
+	skip, clip := selfSkip(segment, tracker.radius)
+	skip += tracker.trimmed
+
+	// check checks the head against cs, and keeps it as near if it's close
+	// enough to be reached by drifting. Other lines' heads are always kept,
+	// since they can move. Each segment is only checked once.
+	var hit *CollisionSegment
+	check := func(cs cellSegment) {
+		if cs.tracker == tracker && cs.offset > skip || pass.seen[cs] {
+			return
+		}
+		pass.seen[cs] = true
+		a, b, ok := cs.Points()
+		if !ok {
+			return
+		}
+		if cs.tracker == tracker && cs.offset == skip && clip < 1 {
+			b = lerp(a, b, clip)
+		}
+		r := tracker.radius + cs.tracker.radius
+		if c := segmentCollision(a, b, head0, head1, r, grid.wallHeight, grid.reproducible, cs.tracker.id, cs.offset-cs.tracker.trimmed, cs.tracker == tracker); c != nil && !cs.tracker.tickHead(cs.offset-cs.tracker.trimmed) && before(c, hit) {
+			hit = c
+		}
+		if other := cs.tracker; other != tracker && cs.offset == other.offset && batching {
+			pass.heads = append(pass.heads, other)
+		}
+		if other := cs.tracker; other == tracker || cs.offset != other.offset {
+			if dist, _, _ := SegmentDistance2D(a[0], a[2], b[0], b[2], head0[0], head0[2], head1[0], head1[2]); dist > r+maxDrift {
+				return
+			}
+		}
+		pass.near = append(pass.near, cs)
+	}
+	for _, cs := range known {
+		check(cs)
+	}
+
+	// visit checks every segment in the cell, and notes other lines whose
+	// head is there to tell about ours, since they won't otherwise find it
+	// when they're extending.
+	visit := func(idx int) {
+		if batching {
+			pass.visited = append(pass.visited, idx)
+		}
+		for _, cs := range grid.cells.Get(idx) {
+			check(cs)
+			if other := cs.tracker; other != tracker && cs.offset == other.offset {
+				pass.notify = append(pass.notify, other)
 			}
 		}
 	}
+
+	// Check segment collision in every cell the head's capsule overlaps, and
+	// note them to register it with. It's registered even if it crosses the
+	// boundary, so that other lines can still hit what's left inside. The
+	// cells around them are checked too, unless every update walks the whole
+	// head.
+	add := func(idx int) {
+		pass.cells = append(pass.cells, idx)
+	}
+	reach := grid.reach(tracker.radius)
+	checkReach := reach
+	if !grid.fullWalk {
+		checkReach = grid.reach(tracker.radius + slack)
+	}
+	lastIdx := -1
+	grid.walk(from[0], from[2], head1[0], head1[2], func(idx int, exit float32) bool {
+		grid.around(idx, lastIdx, checkReach, visit)
+		grid.around(idx, lastIdx, reach, add)
+		lastIdx = idx
+		return true
+	})
+
+	pass.noop = false
+	pass.cellIdx, pass.offset = lastIdx, offset
+	pass.start, pass.end = head0, head1
+	pass.err = earliest(hit, grid.obstacles.collision(head0, head1, tracker.radius, grid.reproducible), grid.edge.crossing(head0, head1, tracker.radius))
+}
+
+// stale returns true if any line committed since the last check registered
+// its head in a cell that was checked, told this line about its head, or
+// moved on from a head that was checked.
+func (tracker *gridTracker) stale() bool {
+	pass, batch := &tracker.pass, tracker.grid.batch
+	if pass.noop {
+		return false
+	}
+	if batch.notified[tracker] {
+		return true
+	}
+	for _, other := range pass.heads {
+		if batch.moved[other] {
+			return true
+		}
+	}
+	for _, idx := range pass.visited {
+		if batch.cells[idx] {
+			return true
+		}
+	}
+	return false
+}
+
+// commit registers the head with the cells that check found, and tells the
+// other lines there about it.
+func (tracker *gridTracker) commit() error {
+	pass, grid := &tracker.pass, tracker.grid
+	tracker.committed()
+	if pass.noop {
+		return nil
+	}
+	pass.noop = true
+	batch := grid.batch
+
+	for _, idx := range pass.cells {
+		grid.cells.Cell(idx).Add(tracker, pass.offset)
+		if batch != nil {
+			batch.cells[idx] = true
+		}
+	}
+	for _, other := range pass.notify {
+		if len(other.pending) < maxPending {
+			other.pending = append(other.pending, cellSegment{tracker, pass.offset})
+		} else {
+			// It isn't updating, so it can walk its whole head when it does
+			other.pending, other.cellIdx = nil, -1
+		}
+		if batch != nil {
+			batch.notified[other] = true
+		}
+	}
+	if batch != nil && tracker.offset != pass.offset {
+		batch.moved[tracker] = true
+	}
+
+	tracker.near, tracker.pending, pass.near = pass.near, nil, nil
+	tracker.drift = pass.drift
+	tracker.cellIdx, tracker.offset = pass.cellIdx, pass.offset
+	tracker.start, tracker.end = pass.start, pass.end
+
+	err := pass.err
+	pass.err = nil
+	return grid.updated(tracker, err)
+}
+
+// deviation returns how far end is from the line through p0 -> p1, rounded
+// up, and true if p1 extends p0 -> end forward.
+func deviation(p0, end, p1 mgl.Vec3) (float32, bool) {
+	d_x, d_y := float64(p1[0])-float64(p0[0]), float64(p1[2])-float64(p0[2])
+	e_x, e_y := float64(end[0])-float64(p0[0]), float64(end[2])-float64(p0[2])
+	if d_x*e_x+d_y*e_y <= 0 || d_x*d_x+d_y*d_y < e_x*e_x+e_y*e_y {
+		return 0, false
+	}
+	dev := math.Abs(d_x*e_y-d_y*e_x) / math.Hypot(d_x, d_y)
+	return float32(dev * (1 + 1e-6)), true
+}
+
+// cellSegment is a reference to the segment of a tracked line which starts at
+// offset and passes through a cell. Points are read from the tracked line
+// when needed, so extending the segment does not need to update the cell.
+// Segments which were trimmed off or untracked are no longer available.
+type cellSegment struct {
+	tracker *gridTracker
+	offset  int
+}
+
+// Points returns the endpoints of the referenced segment, or false if the
+// segment is not (or no longer) available.
+func (cs cellSegment) Points() (a, b mgl.Vec3, ok bool) {
+	if cs.tracker.closed {
+		return a, b, false
+	}
+	segment := *cs.tracker.segment
+	i := cs.offset - cs.tracker.trimmed
+	if i < 0 || i+1 >= len(segment) {
+		return a, b, false
+	}
+	return segment[i], segment[i+1], true
+}
+
+func (cs cellSegment) String() string {
+	a, b, _ := cs.Points()
+	return fmt.Sprintf("%d: %v -> %v", cs.tracker.id, a, b)
+}
+
+type gridCell []cellSegment
+
+// cellStore holds the cells of a grid by index.
+type cellStore interface {
+	// Get returns the cell at idx, which is empty if nothing passed through it.
+	Get(idx int) gridCell
+	// Cell returns the cell at idx for adding segments, allocating it if
+	// needed.
+	Cell(idx int) *gridCell
+	// Each calls fn with every non-empty cell in order of index.
+	Each(fn func(idx int, cell gridCell))
+	// Free releases the cell at idx once it's empty.
+	Free(idx int)
+}
+
+// denseCells is a slice of every cell in the grid.
+type denseCells []gridCell
+
+func (cells denseCells) Get(idx int) gridCell {
+	return cells[idx]
+}
+
+func (cells denseCells) Cell(idx int) *gridCell {
+	return &cells[idx]
+}
+
+func (cells denseCells) Each(fn func(idx int, cell gridCell)) {
+	for idx, cell := range cells {
+		if len(cell) > 0 {
+			fn(idx, cell)
+		}
+	}
+}
+
+func (cells denseCells) Free(idx int) {
+	cells[idx] = nil
+}
+
+// sparseCells only holds the cells that something passed through.
+type sparseCells map[int]*gridCell
+
+func (cells sparseCells) Get(idx int) gridCell {
+	if cell, ok := cells[idx]; ok {
+		return *cell
+	}
 	return nil
 }
+
+func (cells sparseCells) Cell(idx int) *gridCell {
+	cell, ok := cells[idx]
+	if !ok {
+		cell = &gridCell{}
+		cells[idx] = cell
+	}
+	return cell
+}
+
+func (cells sparseCells) Each(fn func(idx int, cell gridCell)) {
+	keys := make([]int, 0, len(cells))
+	for idx := range cells {
+		keys = append(keys, idx)
+	}
+	sort.Ints(keys)
+	for _, idx := range keys {
+		fn(idx, *cells[idx])
+	}
+}
+
+func (cells sparseCells) Free(idx int) {
+	delete(cells, idx)
+}
+
+func (cell *gridCell) Len() int {
+	return len(*cell)
+}
+
+// Add registers the tracker's segment at offset with the cell, unless it's
+// already there.
+func (cell *gridCell) Add(tracker *gridTracker, offset int) {
+	for i := len(*cell) - 1; i >= 0; i-- {
+		cs := (*cell)[i]
+		if cs.tracker == tracker && cs.offset == offset {
+			return
+		}
+	}
+	*cell = append(*cell, cellSegment{
+		tracker: tracker,
+		offset:  offset,
+	})
+}
+
+// Remove unregisters the tracker's segment at offset from the cell.
+func (cell *gridCell) Remove(tracker *gridTracker, offset int) {
+	for i, cs := range *cell {
+		if cs.tracker == tracker && cs.offset == offset {
+			*cell = append((*cell)[:i], (*cell)[i+1:]...)
+			return
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package collision
 
 import (
+	"errors"
 	"image"
+	"reflect"
 	"testing"
 
 	mgl "github.com/go-gl/mathgl/mgl32"
@@ -21,6 +23,22 @@ type stepSuite struct {
 
 var suites []stepSuite
 
+type multiStep struct {
+	line     int
+	collides bool
+	vec      mgl.Vec3
+	replace  bool // Replace the last point instead of appending, like Line.Add does when extending
+}
+
+type multiStepSuite struct {
+	name   string
+	bounds image.Rectangle
+	lines  int
+	steps  []multiStep
+}
+
+var multiSuites []multiStepSuite
+
 func init() {
 	bounds := image.Rect(-10, -10, 10, 10)
 	suites = []stepSuite{
@@ -73,6 +91,120 @@ func init() {
 			},
 		},
 	}
+
+	multiSuites = []multiStepSuite{
+		{
+			"Crossing",
+			bounds,
+			2,
+			[]multiStep{
+				{0, false, mgl.Vec3{-5, 0, 0}, false},
+				{1, false, mgl.Vec3{0, 0, -5}, false},
+				{0, false, mgl.Vec3{5, 0, 0}, false},
+				{1, false, mgl.Vec3{0, 0, -2}, false},
+				{1, true, mgl.Vec3{0, 0, 2}, false},
+			},
+		},
+		{
+			"Parallel",
+			bounds,
+			2,
+			[]multiStep{
+				{0, false, mgl.Vec3{-5, 0, 0}, false},
+				{1, false, mgl.Vec3{-5, 0, 1}, false},
+				{0, false, mgl.Vec3{5, 0, 0}, false},
+				{1, false, mgl.Vec3{5, 0, 1}, false},
+				{0, false, mgl.Vec3{7, 0, 0}, true},
+				{1, false, mgl.Vec3{6, 0, 1}, true},
+				{0, false, mgl.Vec3{7, 0, 5}, false},
+				{1, false, mgl.Vec3{6, 0, 4}, false},
+				{0, false, mgl.Vec3{5, 0, 5}, false},
+				{0, true, mgl.Vec3{5, 0, 0.5}, false},
+			},
+		},
+		{
+			"Self among others",
+			bounds,
+			2,
+			[]multiStep{
+				{0, false, mgl.Vec3{-8, 0, -8}, false},
+				{0, false, mgl.Vec3{8, 0, -8}, false},
+				{1, false, mgl.Vec3{0, 0, 0}, false},
+				{1, false, mgl.Vec3{2, 0, 0}, false},
+				{1, false, mgl.Vec3{2, 0, 2}, false},
+				{1, false, mgl.Vec3{1, 0, 2}, false},
+				{1, true, mgl.Vec3{1, 0, -1}, false},
+				{0, false, mgl.Vec3{8, 0, -6}, false},
+			},
+		},
+		{
+			"Turning in a shared cell",
+			bounds,
+			3,
+			[]multiStep{
+				{0, false, mgl.Vec3{0.1, 0, 0.1}, false},
+				{0, false, mgl.Vec3{0.3, 0, 0.1}, false},
+				{1, false, mgl.Vec3{0.1, 0, 0.6}, false},
+				{1, false, mgl.Vec3{0.3, 0, 0.6}, false},
+				{0, false, mgl.Vec3{0.3, 0, 0.4}, false},
+				{2, false, mgl.Vec3{0.6, 0, 0.25}, false},
+				{2, true, mgl.Vec3{0.1, 0, 0.25}, false},
+			},
+		},
+		{
+			"Extending through shared cells",
+			bounds,
+			3,
+			[]multiStep{
+				{0, false, mgl.Vec3{-3, 0, 0.5}, false},
+				{0, false, mgl.Vec3{-2, 0, 0.5}, false},
+				{0, false, mgl.Vec3{0, 0, 0.5}, true},
+				{1, false, mgl.Vec3{-3, 0, 1.5}, false},
+				{1, false, mgl.Vec3{-2, 0, 1.5}, false},
+				{0, false, mgl.Vec3{3, 0, 0.5}, true},
+				{1, false, mgl.Vec3{3, 0, 1.5}, true},
+				{2, false, mgl.Vec3{0.5, 0, -3}, false},
+				{2, false, mgl.Vec3{0.5, 0, -1}, false},
+				{2, false, mgl.Vec3{0.5, 0, 0}, true},
+				{2, true, mgl.Vec3{0.5, 0, 1}, true},
+				{1, false, mgl.Vec3{4, 0, 1.5}, true},
+				{0, false, mgl.Vec3{3, 0, -2}, false},
+			},
+		},
+		{
+			"Short segment across a cell edge",
+			bounds,
+			2,
+			[]multiStep{
+				{0, false, mgl.Vec3{0.8, 0, 0.5}, false},
+				{0, false, mgl.Vec3{1.3, 0, 0.5}, false},
+				{1, false, mgl.Vec3{0.9, 0, 0}, false},
+				{1, true, mgl.Vec3{0.9, 0, 1}, false},
+			},
+		},
+		{
+			"Crashed into the boundary",
+			bounds,
+			2,
+			[]multiStep{
+				{0, false, mgl.Vec3{8, 0, 0.5}, false},
+				{0, true, mgl.Vec3{12, 0, 0.5}, false},
+				{1, false, mgl.Vec3{9, 0, -1}, false},
+				{1, true, mgl.Vec3{9, 0, 1}, false},
+			},
+		},
+	}
+}
+
+// vecNear compares vectors with an absolute tolerance, unlike
+// mgl.Vec3.ApproxEqual which is relative and too strict around 0.
+func vecNear(a, b mgl.Vec3) bool {
+	for i := range a {
+		if d := a[i] - b[i]; d > 1e-5 || d < -1e-5 {
+			return false
+		}
+	}
+	return true
 }
 
 func colliderTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
@@ -95,6 +227,94 @@ func colliderTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
 	}
 }
 
+func multiColliderTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	for _, suite := range multiSuites {
+		t.Logf("Starting suite: %s", suite.name)
+
+		collider := newCollider(suite.bounds)
+		lines := make([][]mgl.Vec3, suite.lines)
+		trackers := make([]Tracker, suite.lines)
+		for i := range lines {
+			lines[i] = []mgl.Vec3{}
+			trackers[i] = collider.Track(&lines[i])
+		}
+
+		var err error
+		for _, test := range suite.steps {
+			t.Logf("line %d: adding %v", test.line, test.vec)
+			segments := &lines[test.line]
+			if test.replace && len(*segments) > 1 {
+				(*segments)[len(*segments)-1] = test.vec
+			} else {
+				*segments = append(*segments, test.vec)
+			}
+			err = trackers[test.line].Update()
+			if (err == nil) == test.collides {
+				t.Errorf("%s: line %d expected collision=%v; got %s", suite.name, test.line, test.collides, err)
+			}
+		}
+	}
+}
+
+func impactTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	a := []mgl.Vec3{{-5, 0, 0}}
+	b := []mgl.Vec3{{1, 0, -4}}
+	c := []mgl.Vec3{{0, 0, 3}}
+	trackA, trackB, trackC := collider.Track(&a), collider.Track(&b), collider.Track(&c)
+
+	add := func(tracker Tracker, line *[]mgl.Vec3, vecs ...mgl.Vec3) (err error) {
+		for _, vec := range vecs {
+			*line = append(*line, vec)
+			err = tracker.Update()
+		}
+		return err
+	}
+
+	expectSegment := func(err error, id int, self bool, offset int, point mgl.Vec3, T float32) {
+		seg, ok := err.(*CollisionSegment)
+		if !ok {
+			t.Errorf("expected *CollisionSegment; got %T: %v", err, err)
+			return
+		}
+		if seg.ID != id || seg.Self != self || seg.Offset != offset {
+			t.Errorf("expected collision with segment %d of line %d (self=%v); got %d of %d (self=%v)", offset, id, self, seg.Offset, seg.ID, seg.Self)
+		}
+		if !seg.Point.ApproxEqualThreshold(point, 1e-5) || !mgl.FloatEqualThreshold(seg.T, T, 1e-5) {
+			t.Errorf("expected collision at %v (T=%v); got %v (T=%v)", point, T, seg.Point, seg.T)
+		}
+		if c, ok := Impact(err); !ok || c != seg.Collision {
+			t.Errorf("Impact(%v) = %v, %v", err, c, ok)
+		}
+	}
+
+	if err := add(trackA, &a, mgl.Vec3{5, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	expectSegment(add(trackB, &b, mgl.Vec3{1, 0, 4}), trackA.ID(), false, 0, mgl.Vec3{1, 0, 0}, 0.5)
+	expectSegment(add(trackB, &b, mgl.Vec3{3, 0, 4}, mgl.Vec3{3, 0, 2}, mgl.Vec3{-1, 0, 2}), trackB.ID(), true, 0, mgl.Vec3{1, 0, 2}, 0.5)
+
+	// Crosses b before a
+	expectSegment(add(trackC, &c, mgl.Vec3{0, 0, -3}), trackB.ID(), false, 3, mgl.Vec3{0, 0, 2}, 1.0/6)
+
+	err := add(trackA, &a, mgl.Vec3{5, 0, -15})
+	if !errors.Is(err, CollisionBoundary) {
+		t.Fatalf("expected boundary collision; got %v", err)
+	}
+	edge, ok := err.(*CollisionEdge)
+	if !ok {
+		t.Fatalf("expected *CollisionEdge; got %T", err)
+	}
+	expect := mgl.Vec3{5, 0, -10}
+	if edge.Edge != EdgeY1 || !edge.Point.ApproxEqualThreshold(expect, 1e-5) || edge.Normal != (mgl.Vec3{0, 0, 1}) {
+		t.Errorf("expected edge %s at %v facing +Z; got %s at %v facing %v", EdgeY1, expect, edge.Edge, edge.Point, edge.Normal)
+	}
+
+	// Crosses a before leaving the arena
+	d := []mgl.Vec3{{-3, 0, 4}}
+	expectSegment(add(collider.Track(&d), &d, mgl.Vec3{-3, 0, -12}), trackA.ID(), false, 0, mgl.Vec3{-3, 0, 0}, 0.25)
+}
+
 func TestGrid(t *testing.T) {
 	colliderTester(t, GridCollider)
 }
@@ -102,3 +322,146 @@ func TestGrid(t *testing.T) {
 func TestLinear(t *testing.T) {
 	colliderTester(t, LinearCollider)
 }
+
+func TestQuadtree(t *testing.T) {
+	colliderTester(t, QuadtreeCollider)
+}
+
+func TestGridMulti(t *testing.T) {
+	multiColliderTester(t, GridCollider)
+}
+
+func TestLinearMulti(t *testing.T) {
+	multiColliderTester(t, LinearCollider)
+}
+
+func TestGridImpact(t *testing.T) {
+	impactTester(t, GridCollider)
+}
+
+func TestLinearImpact(t *testing.T) {
+	impactTester(t, LinearCollider)
+}
+
+func TestGridWalk(t *testing.T) {
+	grid := GridCollider(image.Rect(-10, -10, 10, 10)).(*gridCollider)
+	tests := []struct {
+		x0, y0, x1, y1 float32
+		cells          [][2]int
+	}{
+		{-9.5, -9.5, -7.5, -9.5, [][2]int{{0, 0}, {1, 0}, {2, 0}}},
+		{-9.5, -9.5, -9.5, -9.5, [][2]int{{0, 0}}},
+		{-7.5, -8.5, -9.5, -9.5, [][2]int{{2, 1}, {1, 1}, {1, 0}, {0, 0}}},
+		{-9.5, -9.5, -7.5, -7.5, [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {2, 1}, {1, 2}, {2, 2}}},
+		{-10.5, 0.5, -8.5, 0.5, [][2]int{{0, 10}, {1, 10}}},
+		{-9.5, -9.5, -9, -9.5, [][2]int{{0, 0}, {1, 0}}},
+		{-9.5, -8.5, -9, -9, [][2]int{{0, 1}, {1, 1}}},
+	}
+
+	for i, test := range tests {
+		cells := [][2]int{}
+		grid.walk(test.x0, test.y0, test.x1, test.y1, func(idx int, exit float32) bool {
+			cells = append(cells, [2]int{idx % grid.width, idx / grid.width})
+			return true
+		})
+		if !reflect.DeepEqual(cells, test.cells) {
+			t.Errorf("walk test #%d: got %v; want %v", i, cells, test.cells)
+		}
+	}
+}
+
+func TestQuadtreeMulti(t *testing.T) {
+	multiColliderTester(t, QuadtreeCollider)
+}
+
+func TestQuadtreeImpact(t *testing.T) {
+	impactTester(t, QuadtreeCollider)
+}
+
+// gridVariants are grids with other cell sizes and storage, which should
+// behave exactly like the default grid.
+var gridVariants = []struct {
+	name string
+	opts GridOptions
+}{
+	{"Sparse", GridOptions{Sparse: true}},
+	{"SmallCells", GridOptions{CellSize: 0.25}},
+	{"SparseLargeCells", GridOptions{CellSize: 3, Sparse: true}},
+}
+
+func TestGridVariants(t *testing.T) {
+	for _, variant := range gridVariants {
+		opts := variant.opts
+		newCollider := func(bounds image.Rectangle) Collider {
+			return NewGridCollider(bounds, opts)
+		}
+		t.Run(variant.name, func(t *testing.T) {
+			colliderTester(t, newCollider)
+			multiColliderTester(t, newCollider)
+			impactTester(t, newCollider)
+			proximityTester(t, newCollider)
+			raycastTester(t, newCollider)
+		})
+	}
+}
+
+func TestGridWalkCellSize(t *testing.T) {
+	grid := NewGridCollider(image.Rect(-10, -10, 10, 10), GridOptions{CellSize: 2.5}).(*gridCollider)
+	if grid.width != 8 || grid.height != 8 {
+		t.Fatalf("expected 8x8 cells; got %dx%d", grid.width, grid.height)
+	}
+
+	cells := [][2]int{}
+	grid.walk(-9.5, -9.5, -2.0, -9.0, func(idx int, exit float32) bool {
+		cells = append(cells, [2]int{idx % grid.width, idx / grid.width})
+		return true
+	})
+	if expect := [][2]int{{0, 0}, {1, 0}, {2, 0}, {3, 0}}; !reflect.DeepEqual(cells, expect) {
+		t.Errorf("got %v; want %v", cells, expect)
+	}
+
+	if col, row := grid.cell(4.9, 5.1); col != 5 || row != 6 {
+		t.Errorf("expected cell 5,6; got %d,%d", col, row)
+	}
+}
+
+func TestGridExtendAlongside(t *testing.T) {
+	const length = 1000
+	grid := NewGridCollider(image.Rect(-1, -1, length+1, length/2), GridOptions{Sparse: true})
+	trail := make([]mgl.Vec3, length+1)
+	for i := range trail {
+		trail[i] = mgl.Vec3{float32(i), 0, float32(i)*0.37 + 0.2}
+	}
+	trackAll(grid, trail)
+
+	// Running straight alongside the trail, just out of reach
+	segment := []mgl.Vec3{{0, 0, 0}, {0, 0, 0}}
+	tracker := grid.Track(&segment).(*gridTracker)
+	dir := mgl.Vec3{1, 0, 0.37}.Normalize()
+	for segment[1][0] < length-1 {
+		segment[1] = segment[1].Add(dir.Mul(0.25))
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("expected no collision; got %s", err)
+		}
+		if len(tracker.near) > 4 {
+			t.Fatalf("expected to only keep what's near the head; got %d segments at %v", len(tracker.near), segment[1])
+		}
+	}
+
+	// A line which stopped updating isn't told about every pass of another
+	crashed := []mgl.Vec3{{500, 0, 10}, {500, 0, 10.5}}
+	stopped := grid.Track(&crashed).(*gridTracker)
+	stopped.Update()
+	passing := []mgl.Vec3{{499, 0, 9}, {499, 0, 9}}
+	passer := grid.Track(&passing)
+	for i := 0; i < 1000; i++ {
+		passing[1][2] = 9 + float32(i%2)*0.1
+		passer.Update()
+	}
+	if len(stopped.pending) > 100 {
+		t.Errorf("expected pending to stay bounded; got %d", len(stopped.pending))
+	}
+	if err := stopped.Update(); err != nil {
+		t.Errorf("expected no collision; got %s", err)
+	}
+}
@@ -0,0 +1,127 @@
+package collision
+
+import (
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+func heightTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	flat := []mgl.Vec3{{-5, 0, 0}, {5, 0, 0}}
+	tests := []struct {
+		name   string
+		height float32
+		radius float32
+		trail  []mgl.Vec3
+		head   []mgl.Vec3
+		hit    bool
+	}{
+		{"Over", 1, 0, flat, []mgl.Vec3{{0, 2, -3}, {0, 2, 3}}, false},
+		{"Through", 1, 0, flat, []mgl.Vec3{{0, 0.5, -3}, {0, 0.5, 3}}, true},
+		{"Under", 1, 0, flat, []mgl.Vec3{{0, -1.5, -3}, {0, -1.5, 3}}, false},
+		{"Just over", 1, 0, flat, []mgl.Vec3{{0, 1, -3}, {0, 1, 3}}, false},
+		{"Diving through", 1, 0, flat, []mgl.Vec3{{0, 2, -3}, {0, -1, 3}}, true},
+		{"Climbing over", 1, 0, flat, []mgl.Vec3{{0, 0, -3}, {0, 4, 1}}, false},
+		{"Over a slope", 1, 0, []mgl.Vec3{{-5, 0, 0}, {5, 4, 0}}, []mgl.Vec3{{0, 3.5, -3}, {0, 3.5, 3}}, false},
+		{"Through a slope", 1, 0, []mgl.Vec3{{-5, 0, 0}, {5, 4, 0}}, []mgl.Vec3{{0, 2.5, -3}, {0, 2.5, 3}}, true},
+		{"Under a slope", 1, 0, []mgl.Vec3{{-5, 0, 0}, {5, 4, 0}}, []mgl.Vec3{{0, 0.5, -3}, {0, 0.5, 3}}, false},
+		{"Without height", 0, 0, flat, []mgl.Vec3{{0, 2, -3}, {0, 2, 3}}, true},
+		{"Thick diving into it", 1, 0.5, flat, []mgl.Vec3{{0, 1.6, 2}, {0, 0, -2}}, true},
+		{"Thick climbing over", 1, 0.5, flat, []mgl.Vec3{{0, 0.5, 2}, {0, 2.5, -2}}, false},
+		{"Thick along a slope", 1, 0.5, []mgl.Vec3{{-5, 0, 0}, {5, 4, 0}}, []mgl.Vec3{{-4, 2.5, 0.3}, {4, 2.5, 0.3}}, true},
+	}
+	for _, test := range tests {
+		collider := newCollider(image.Rect(-10, -10, 10, 10))
+		collider.SetWallHeight(test.height)
+		trail := append([]mgl.Vec3{}, test.trail...)
+		if err := collider.Track(&trail).Update(); err != nil {
+			t.Fatalf("%s: expected no collision for the trail; got %s", test.name, err)
+		}
+		head := append([]mgl.Vec3{}, test.head...)
+		err := collider.TrackRadius(&head, test.radius).Update()
+		// Thick lines hit where the walls start to overlap, give or take
+		// rounding
+		if hit, ok := err.(*CollisionSegment); test.hit != ok {
+			t.Errorf("%s: expected hit %v; got %v", test.name, test.hit, err)
+		} else if ok && test.height > 0 && !wallsOverlap(trail[0], trail[1], hit.Point, test.height+1e-4) {
+			t.Errorf("%s: expected the walls to overlap at %v", test.name, hit.Point)
+		}
+	}
+}
+
+func heightTrailTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	// A loop which climbs over the start of its own trail
+	var segment []mgl.Vec3
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	collider.SetWallHeight(1)
+	tracker := collider.Track(&segment)
+	for _, p := range []mgl.Vec3{{-2, 0, 0}, {4, 0, 0}, {4, 1.5, 4}, {0, 3, 4}, {0, 3, -2}, {-4, 0, -2}} {
+		segment = append(segment, p)
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("expected to fly over its own trail; got %s", err)
+		}
+	}
+
+	// Coming back down through it
+	segment = append(segment, mgl.Vec3{2, 0, 2})
+	if err := tracker.Update(); err == nil {
+		t.Errorf("expected to hit its own trail")
+	}
+}
+
+func heightProximityTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	collider.SetWallHeight(1)
+	collider.SetObstacles([]*Obstacle{Wall(0, mgl.Vec2{-5, 6}, mgl.Vec2{5, 6})})
+	trail := []mgl.Vec3{{-5, 0, 0}, {5, 0, 0}}
+	collider.Track(&trail).Update()
+
+	// Passing 0.5 above the top of the wall
+	head := []mgl.Vec3{{0, 1.5, -3}, {0, 1.5, 3}}
+	tracker := collider.Track(&head)
+	if err := tracker.Update(); err != nil {
+		t.Fatalf("expected to fly over; got %s", err)
+	}
+	if near := tracker.Near(1); near == nil || !mgl.FloatEqualThreshold(near.Distance, 0.5, 1e-4) {
+		t.Errorf("expected the wall 0.5 below; got %v", near)
+	}
+	if near := tracker.Near(0.4); near != nil {
+		t.Errorf("expected nothing within 0.4; got %v", near)
+	}
+
+	// Rays beside the head pass over the trail, but not the obstacle
+	if hit := collider.Raycast(mgl.Vec3{1, 1.5, -3}, mgl.Vec3{0, 0, 1}, 20); hit == nil || !hit.Obstacle {
+		t.Errorf("expected to hit the obstacle; got %v", hit)
+	}
+	if hit := collider.Raycast(mgl.Vec3{1, 0.5, -3}, mgl.Vec3{0, 0, 1}, 20); hit == nil || hit.Obstacle || hit.Boundary {
+		t.Errorf("expected to hit the trail; got %v", hit)
+	}
+
+	// Obstacles are in the way at any height
+	if err := tracker.Update(); err != nil {
+		t.Fatalf("expected no collision; got %s", err)
+	}
+	head = append(head, mgl.Vec3{0, 5, 8})
+	if _, ok := tracker.Update().(*CollisionObstacle); !ok {
+		t.Errorf("expected to hit the obstacle")
+	}
+}
+
+func TestGridHeight(t *testing.T) {
+	heightTester(t, GridCollider)
+	heightTrailTester(t, GridCollider)
+	heightProximityTester(t, GridCollider)
+}
+
+func TestLinearHeight(t *testing.T) {
+	heightTester(t, LinearCollider)
+	heightTrailTester(t, LinearCollider)
+	heightProximityTester(t, LinearCollider)
+}
+
+func TestQuadtreeHeight(t *testing.T) {
+	heightTester(t, QuadtreeCollider)
+	heightTrailTester(t, QuadtreeCollider)
+	heightProximityTester(t, QuadtreeCollider)
+}
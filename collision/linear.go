@@ -1,6 +1,8 @@
 package collision
 
 import (
+	"bytes"
+	"fmt"
 	"image"
 
 	mgl "github.com/go-gl/mathgl/mgl32"
@@ -15,78 +17,273 @@ func LinearCollider(bounds image.Rectangle) Collider {
 		width:  size.X,
 		height: size.Y,
 	}
+	collider.SetOutline(nil)
 	collider.Reset()
 	return collider
 }
 
 type linearCollider struct {
-	bounds   Boundary
-	width    int
-	height   int
-	segments []*[]mgl.Vec3
+	bounds    Boundary
+	edge      boundary
+	obstacles obstacles
+	width     int
+	height    int
+	trackers  []*linearTracker
+
+	// Height of the walls of trails, or 0 to ignore heights.
+	wallHeight float32
+
+	// Intersect segments in fixed-point, see SetReproducible.
+	reproducible bool
+
+	// Subscribers to events.
+	hooks
+
+	// Every line tracked since the last reset, by ID.
+	tracked    []*linearTracker
+	numTracked int
 }
 
 func (collider *linearCollider) Track(segment *[]mgl.Vec3) Tracker {
-	collider.segments = append(collider.segments, segment)
-	return &linearTracker{
-		collider: collider,
-		segment:  segment,
+	return collider.TrackRadius(segment, 0)
+}
+
+func (collider *linearCollider) TrackRadius(segment *[]mgl.Vec3, radius float32) Tracker {
+	tracker := &linearTracker{
+		trackedLine: newTrackedLine(collider, segment, collider.numTracked, radius),
+		collider:    collider,
+	}
+	collider.trackers = append(collider.trackers, tracker)
+	collider.tracked = append(collider.tracked, tracker)
+	collider.numTracked += 1
+	return tracker
+}
+
+func (collider *linearCollider) Untrack(t Tracker) {
+	for i, tracker := range collider.trackers {
+		if tracker == t {
+			collider.trackers = append(collider.trackers[:i], collider.trackers[i+1:]...)
+			tracker.closed = true
+			return
+		}
+	}
+}
+
+func (collider *linearCollider) UpdateAll(trackers []Tracker) []error {
+	return updateAll(collider, trackers)
+}
+
+func (collider *linearCollider) UpdateTick(trackers []Tracker, rule TickRule) []error {
+	return updateTick(collider, &collider.hooks, collider.wallHeight, collider.reproducible, trackers, rule)
+}
+
+func (collider *linearCollider) SetOutline(outline *Outline) {
+	collider.edge = collider.bounds
+	if outline != nil {
+		collider.edge = outline
 	}
 }
 
+func (collider *linearCollider) SetWrap(wrap bool) {
+	collider.edge = collider.bounds
+	if wrap {
+		collider.edge = unbounded{}
+	}
+}
+
+func (collider *linearCollider) SetWallHeight(height float32) {
+	collider.wallHeight = height
+}
+
+func (collider *linearCollider) SetReproducible(reproducible bool) {
+	collider.reproducible = reproducible
+}
+
+func (collider *linearCollider) SetObstacles(obs []*Obstacle) {
+	collider.obstacles = obs
+}
+
 func (collider *linearCollider) Reset() {
-	collider.segments = []*[]mgl.Vec3{}
+	collider.trackers = []*linearTracker{}
+	collider.tracked = nil
+	collider.numTracked = 0
+	collider.collision = nil
+}
+
+// Picture has no cells, since every segment is checked.
+func (collider *linearCollider) Picture() *Picture {
+	pic := newPicture(collider.bounds, collider.edge, collider.obstacles, &collider.hooks)
+	for _, tracker := range collider.trackers {
+		pic.line(tracker.id, tracker.radius, *tracker.segment)
+	}
+	return pic
+}
+
+func (collider *linearCollider) Nearest(point mgl.Vec3, radius float32) *Proximity {
+	return collider.nearest(nil, point, point, radius)
+}
+
+func (collider *linearCollider) nearest(self *linearTracker, p0, p1 mgl.Vec3, radius float32) *Proximity {
+	near := collider.obstacles.proximity(p0, p1, radius)
+	for _, other := range collider.trackers {
+		segment := *other.segment
+		m, clip := len(segment)-2, float32(1)
+		if other == self {
+			m, clip = nearSkip(segment, radius)
+		}
+		for i := 0; i <= m; i += 1 {
+			a, b := segment[i], segment[i+1]
+			if isGap(a, b) {
+				continue
+			}
+			if i == m {
+				b = lerp(a, b, clip)
+			}
+			if p := segmentProximity(a, b, p0, p1, radius, collider.wallHeight, other.id, other == self); p != nil && (near == nil || p.Distance < near.Distance) {
+				near = p
+			}
+		}
+	}
+	return near
+}
+
+func (collider *linearCollider) Raycast(origin, direction mgl.Vec3, maxDist float32) *RayHit {
+	return collider.raycast(nil, origin, direction, maxDist)
+}
+
+func (collider *linearCollider) raycast(self *linearTracker, origin, direction mgl.Vec3, maxDist float32) *RayHit {
+	r, ok := newRay(origin, direction, maxDist)
+	if !ok {
+		return nil
+	}
+	r.height = collider.wallHeight
+
+	hit := nearerHit(r.boundaryHit(collider.edge), collider.obstacles.hit(r))
+	for _, other := range collider.trackers {
+		segment := *other.segment
+		m := len(segment)
+		if other == self {
+			// Skip the head segment
+			m -= 1
+		}
+		for i := 1; i < m; i += 1 {
+			if isGap(segment[i-1], segment[i]) {
+				continue
+			}
+			hit = nearerHit(hit, r.segmentHit(segment[i-1], segment[i], other.id))
+		}
+	}
+	return hit
 }
 
 func (collider *linearCollider) String() string {
-	// TODO:
-	return "<linearCollider>"
+	w := &bytes.Buffer{}
+	for _, tracker := range collider.trackers {
+		segment := *tracker.segment
+		fmt.Fprintf(w, "line %d: %d points\n", tracker.id, len(segment))
+		for i := 1; i < len(segment); i++ {
+			if isGap(segment[i-1], segment[i]) {
+				continue
+			}
+			fmt.Fprintf(w, "  %v -> %v\n", segment[i-1], segment[i])
+		}
+	}
+	return w.String()
 }
 
 type linearTracker struct {
+	trackedLine
 	collider *linearCollider
-	segment  *[]mgl.Vec3
+
+	// Collision found by the last check, until it's committed.
+	found error
 }
 
-func (tracker *linearTracker) Update() error {
-	collider := tracker.collider
+func (tracker *linearTracker) Near(radius float32) *Proximity {
 	segment := *tracker.segment
 	n := len(segment)
-	if n < 2 {
-		// Not long enough
+	if n < 2 || isGap(segment[n-2], segment[n-1]) {
 		return nil
 	}
+	return tracker.collider.nearest(tracker, segment[n-2], segment[n-1], radius)
+}
 
-	var vec mgl.Vec3 = segment[n-1]
-	x1, y1 := vec[0], vec[2]
+func (tracker *linearTracker) Raycast(direction mgl.Vec3, maxDist float32) *RayHit {
+	segment := *tracker.segment
+	if len(segment) == 0 || IsBreak(segment[len(segment)-1]) {
+		return nil
+	}
+	return tracker.collider.raycast(tracker, segment[len(segment)-1], direction, maxDist)
+}
 
-	// Check boundary
-	if collider.bounds.X1 >= x1 || x1 >= collider.bounds.X2 ||
-		collider.bounds.Y1 >= y1 || y1 >= collider.bounds.Y2 {
-		return CollisionBoundary
+func (tracker *linearTracker) Trim(n int) {
+	segment := *tracker.segment
+	if n > len(segment)-2 {
+		n = len(segment) - 2
+	}
+	if n > 0 {
+		*tracker.segment = segment[n:]
 	}
+}
 
-	vec = segment[n-2]
-	x0, y0 := vec[0], vec[2]
+func (tracker *linearTracker) Close() {
+	tracker.collider.Untrack(tracker)
+}
 
-	for _, segment_ref := range collider.segments {
-		segment = *segment_ref
-		m := len(segment)
-		if segment_ref == tracker.segment {
-			// Don't compare the last element for the current line
-			m -= 1
-		}
-		for i := 1; i < m; i += 1 {
-			vec = segment[i-1]
-			seg_x0, seg_y0 := vec[0], vec[2]
+func (tracker *linearTracker) Update() error {
+	tracker.check()
+	return tracker.commit()
+}
+
+// check finds the collision of the head, which only reads the other lines.
+func (tracker *linearTracker) check() {
+	tracker.found = tracker.find()
+}
+
+// stale is always false, since committing doesn't change anything that
+// checking reads.
+func (tracker *linearTracker) stale() bool {
+	return false
+}
 
-			vec = segment[i]
-			seg_x1, seg_y1 := vec[0], vec[2]
+func (tracker *linearTracker) commit() error {
+	tracker.committed()
+	err := tracker.found
+	tracker.found = nil
+	return tracker.collider.updated(tracker, err)
+}
 
-			if IsCollision2D(seg_x0, seg_y0, seg_x1, seg_y1, x0, y0, x1, y1) {
-				return &CollisionSegment{seg_x0, seg_y0, seg_x1, seg_y1}
+func (tracker *linearTracker) find() error {
+	collider := tracker.collider
+	segment := *tracker.segment
+	head0, head1, _, ok := headOf(segment, tracker.closed)
+	if !ok {
+		return nil
+	}
+
+	skip, clip := selfSkip(segment, tracker.radius)
+
+	var hit *CollisionSegment
+	for _, other := range collider.trackers {
+		segment = *other.segment
+		m := len(segment) - 2
+		if other == tracker {
+			// Don't compare the head for the current line
+			m = skip
+		}
+		for i := 0; i <= m; i += 1 {
+			a, b := segment[i], segment[i+1]
+			if isGap(a, b) {
+				continue
+			}
+			if other == tracker && i == m && clip < 1 {
+				b = lerp(a, b, clip)
+			}
+			if c := segmentCollision(a, b, head0, head1, tracker.radius+other.radius, collider.wallHeight, collider.reproducible, other.id, i, other == tracker); c != nil && !other.tickHead(i) && before(c, hit) {
+				hit = c
 			}
 		}
 	}
-	return nil
+	// Earliest collision along the head segment
+	return earliest(hit, collider.obstacles.collision(head0, head1, tracker.radius, collider.reproducible), collider.edge.crossing(head0, head1, tracker.radius))
 }
@@ -0,0 +1,151 @@
+package collision
+
+import (
+	"fmt"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Obstacle is static geometry within the arena which lines collide with, such
+// as walls and pillars.
+type Obstacle struct {
+	// Points of the walls in the X/Z plane, where X is the first and Z is the
+	// second coordinate of each point.
+	Points []mgl.Vec2
+	// Closed joins the last point back to the first, such as for polygons.
+	Closed bool
+	// Radius is how thick the walls are on either side. A single point with
+	// a radius is a round pillar.
+	Radius float32
+}
+
+// Wall returns an obstacle of straight walls between points.
+func Wall(radius float32, points ...mgl.Vec2) *Obstacle {
+	return &Obstacle{Points: points, Radius: radius}
+}
+
+// PolygonObstacle returns an obstacle of thin walls around points.
+func PolygonObstacle(points ...mgl.Vec2) *Obstacle {
+	return &Obstacle{Points: points, Closed: true}
+}
+
+// Pillar returns a round obstacle.
+func Pillar(center mgl.Vec2, radius float32) *Obstacle {
+	return &Obstacle{Points: []mgl.Vec2{center}, Radius: radius}
+}
+
+// Segments calls fn with each wall of the obstacle as a segment in the X/Z
+// plane. A single point is a segment of no length.
+func (obstacle *Obstacle) Segments(fn func(a, b mgl.Vec3)) {
+	points := obstacle.Points
+	if len(points) == 1 {
+		p := mgl.Vec3{points[0][0], 0, points[0][1]}
+		fn(p, p)
+		return
+	}
+	for i := 1; i < len(points); i++ {
+		fn(mgl.Vec3{points[i-1][0], 0, points[i-1][1]}, mgl.Vec3{points[i][0], 0, points[i][1]})
+	}
+	if obstacle.Closed && len(points) > 2 {
+		last := points[len(points)-1]
+		fn(mgl.Vec3{last[0], 0, last[1]}, mgl.Vec3{points[0][0], 0, points[0][1]})
+	}
+}
+
+// CollisionObstacle is returned when a line collides with an obstacle.
+type CollisionObstacle struct {
+	Collision
+
+	// ID of the obstacle that was hit, which is its index in SetObstacles.
+	ID int
+	// X0, Y0, X1, Y1 is the wall that was hit.
+	X0, Y0, X1, Y1 float32
+}
+
+func (err *CollisionObstacle) Error() string {
+	return fmt.Sprintf("collision with obstacle %d: %v,%v -> %v,%v at %v", err.ID, err.X0, err.Y0, err.X1, err.Y1, err.Point)
+}
+
+// obstacles of a collider are checked one at a time, since there are few of
+// them compared to the segments of trails.
+type obstacles []*Obstacle
+
+// collision returns the earliest collision of the moving segment p0 -> p1,
+// which is r thick, with any of the obstacles, or nil. See segmentCollision
+// for fixed.
+func (obs obstacles) collision(p0, p1 mgl.Vec3, r float32, fixed bool) *CollisionObstacle {
+	var hit *CollisionObstacle
+	for id, obstacle := range obs {
+		obstacle.Segments(func(a, b mgl.Vec3) {
+			c := segmentCollision(a, b, p0, p1, r+obstacle.Radius, 0, fixed, id, 0, false)
+			if c == nil || (hit != nil && c.T >= hit.T) {
+				return
+			}
+			hit = &CollisionObstacle{
+				Collision: c.Collision,
+				ID:        id,
+				X0:        c.X0,
+				Y0:        c.Y0,
+				X1:        c.X1,
+				Y1:        c.Y1,
+			}
+		})
+	}
+	return hit
+}
+
+// hit returns the nearest hit of the ray against any of the obstacles, or
+// nil.
+func (obs obstacles) hit(r ray) *RayHit {
+	// Obstacles are in the way at any height
+	r.height = 0
+	var hit *RayHit
+	for id, obstacle := range obs {
+		obstacle.Segments(func(a, b mgl.Vec3) {
+			if h := r.capsuleHit(a, b, obstacle.Radius, id); h != nil {
+				h.Obstacle = true
+				hit = nearerHit(hit, h)
+			}
+		})
+	}
+	return hit
+}
+
+// proximity returns the nearest obstacle within radius of the query segment
+// p0 -> p1, measured from the surface of thick walls, or nil.
+func (obs obstacles) proximity(p0, p1 mgl.Vec3, radius float32) *Proximity {
+	var near *Proximity
+	for id, obstacle := range obs {
+		obstacle.Segments(func(a, b mgl.Vec3) {
+			p := segmentProximity(a, b, p0, p1, radius+obstacle.Radius, 0, id, false)
+			if p == nil {
+				return
+			}
+			p.Distance -= obstacle.Radius
+			if p.Distance < 0 {
+				p.Distance = 0
+			}
+			p.Obstacle = true
+			if near == nil || p.Distance < near.Distance {
+				near = p
+			}
+		})
+	}
+	return near
+}
+
+// earliest returns whichever of the collisions with a trail, an obstacle and
+// the edge of the arena happened first along the head segment, or nil if none
+// did. Trails win ties, then obstacles.
+func earliest(hit *CollisionSegment, obstacle *CollisionObstacle, edge *CollisionEdge) error {
+	if edge != nil && (hit == nil || edge.T < hit.T) && (obstacle == nil || edge.T < obstacle.T) {
+		return edge
+	}
+	if obstacle != nil && (hit == nil || obstacle.T < hit.T) {
+		return obstacle
+	}
+	if hit != nil {
+		return hit
+	}
+	return nil
+}
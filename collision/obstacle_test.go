@@ -0,0 +1,148 @@
+package collision
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// testObstacles are a pillar, a thin wall and a square.
+var testObstacles = []*Obstacle{
+	Pillar(mgl.Vec2{0, 5}, 1),
+	Wall(0, mgl.Vec2{-5, -2}, mgl.Vec2{5, -2}),
+	PolygonObstacle(mgl.Vec2{6, 6}, mgl.Vec2{8, 6}, mgl.Vec2{8, 8}, mgl.Vec2{6, 8}),
+}
+
+func TestObstacleSegments(t *testing.T) {
+	tests := []struct {
+		obstacle *Obstacle
+		n        int
+	}{
+		{testObstacles[0], 1},
+		{testObstacles[1], 1},
+		{testObstacles[2], 4},
+		{Wall(0.5, mgl.Vec2{0, 0}, mgl.Vec2{1, 0}, mgl.Vec2{1, 1}), 2},
+		{PolygonObstacle(mgl.Vec2{0, 0}, mgl.Vec2{1, 0}), 1},
+	}
+	for i, test := range tests {
+		n := 0
+		test.obstacle.Segments(func(a, b mgl.Vec3) { n++ })
+		if n != test.n {
+			t.Errorf("Segments test #%d failed: expected %d segments; got %d", i, test.n, n)
+		}
+	}
+}
+
+func obstacleTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	tests := []struct {
+		name     string
+		radius   float32
+		line     []mgl.Vec3
+		id       int
+		t        float32 // Negative if there's no collision
+		wallFrom mgl.Vec3
+	}{
+		{"Into the pillar", 0, []mgl.Vec3{{0, 0, 0}, {0, 0, 8}}, 0, 0.5, mgl.Vec3{0, 0, 5}},
+		{"Beside the pillar", 0, []mgl.Vec3{{2, 0, 0}, {2, 0, 9}}, 0, -1, mgl.Vec3{}},
+		{"Into the wall", 0, []mgl.Vec3{{0, 0, 0}, {0, 0, -4}}, 1, 0.5, mgl.Vec3{-5, 0, -2}},
+		{"Thick into the wall", 0.5, []mgl.Vec3{{3, 0, 0}, {3, 0, -4}}, 1, 0.375, mgl.Vec3{-5, 0, -2}},
+		{"Around the end of the wall", 0, []mgl.Vec3{{6, 0, 0}, {6, 0, -4}}, 0, -1, mgl.Vec3{}},
+		{"Into the square", 0, []mgl.Vec3{{7, 0, 0}, {7, 0, 7}}, 2, 6.0 / 7, mgl.Vec3{6, 0, 6}},
+	}
+	for _, test := range tests {
+		collider := newCollider(image.Rect(-10, -10, 10, 10))
+		collider.SetObstacles(testObstacles)
+		line := test.line
+		err := collider.TrackRadius(&line, test.radius).Update()
+		if test.t < 0 {
+			if err != nil {
+				t.Errorf("%s: expected no collision; got %s", test.name, err)
+			}
+			continue
+		}
+		c, ok := err.(*CollisionObstacle)
+		if !ok {
+			t.Errorf("%s: expected collision with obstacle %d; got %v", test.name, test.id, err)
+			continue
+		}
+		if c.ID != test.id || !mgl.FloatEqualThreshold(c.T, test.t, 1e-6) || c.X0 != test.wallFrom[0] || c.Y0 != test.wallFrom[2] {
+			t.Errorf("%s: expected collision with obstacle %d from %v at %v; got %s", test.name, test.id, test.wallFrom, test.t, c)
+		}
+	}
+
+	// Trails in front of an obstacle are hit first, and obstacles are kept by
+	// Reset
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	collider.SetObstacles(testObstacles)
+	collider.Reset()
+	across := []mgl.Vec3{{-5, 0, 3}, {5, 0, 3}}
+	if err := collider.Track(&across).Update(); err != nil {
+		t.Fatalf("expected no collision across the arena; got %s", err)
+	}
+	line := []mgl.Vec3{{0, 0, 0}, {0, 0, 8}}
+	if err := collider.Track(&line).Update(); err == nil {
+		t.Errorf("expected collision with the trail before the pillar")
+	} else if _, ok := err.(*CollisionSegment); !ok {
+		t.Errorf("expected collision with the trail before the pillar; got %s", err)
+	}
+
+	hit := collider.Raycast(mgl.Vec3{0, 0, -1}, mgl.Vec3{0, 0, -1}, 20)
+	if hit == nil || !hit.Obstacle || hit.ID != 1 || !mgl.FloatEqual(hit.Distance, 1) {
+		t.Errorf("expected ray to hit the wall 1 away; got %s", hit)
+	}
+	hit = collider.Raycast(mgl.Vec3{-3, 0, 5}, mgl.Vec3{1, 0, 0}, 20)
+	if hit == nil || !hit.Obstacle || hit.ID != 0 || !mgl.FloatEqualThreshold(hit.Distance, 2, 1e-5) {
+		t.Errorf("expected ray to hit the pillar 2 away; got %s", hit)
+	}
+	near := collider.Nearest(mgl.Vec3{2, 0, 5}, 1.5)
+	if near == nil || !near.Obstacle || near.ID != 0 || !mgl.FloatEqualThreshold(near.Distance, 1, 1e-5) {
+		t.Errorf("expected the pillar to be 1 away; got %s", near)
+	}
+}
+
+func TestGridObstacle(t *testing.T) {
+	obstacleTester(t, GridCollider)
+}
+
+func TestLinearObstacle(t *testing.T) {
+	obstacleTester(t, LinearCollider)
+}
+
+func TestQuadtreeObstacle(t *testing.T) {
+	obstacleTester(t, QuadtreeCollider)
+}
+
+// TestObstacleGridLinear is TestGridLinear with obstacles in the way.
+func TestObstacleGridLinear(t *testing.T) {
+	n := 1000
+	if testing.Short() {
+		n = 100
+	}
+	obstacles := []*Obstacle{
+		Pillar(mgl.Vec2{2, -3}, 1),
+		Wall(0.2, mgl.Vec2{-8, 0}, mgl.Vec2{-2, 1}, mgl.Vec2{-2, 4}),
+		PolygonObstacle(mgl.Vec2{3, 1}, mgl.Vec2{7, 2}, mgl.Vec2{4, 3}),
+	}
+	bounds := image.Rect(-10, -10, 10, 10)
+	rng := rand.New(rand.NewSource(4))
+	for i := 0; i < n; i++ {
+		data := make([]byte, 3*(1+rng.Intn(100)))
+		rng.Read(data)
+		radius := float32(rng.Intn(3)) / 10
+		colliders := []Collider{
+			thick{LinearCollider(bounds), radius},
+			thick{GridCollider(bounds), radius},
+			thick{NewGridCollider(bounds, GridOptions{CellSize: 0.3, Sparse: true}), radius},
+			thick{QuadtreeCollider(bounds), radius},
+		}
+		for _, collider := range colliders {
+			collider.SetObstacles(obstacles)
+		}
+		if err := replayMoves(data, colliders...); err != nil {
+			attachPictures(t, colliders...)
+			t.Fatalf("radius %v: %s\n\tdata: %v", radius, err, data)
+		}
+	}
+}
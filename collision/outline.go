@@ -0,0 +1,268 @@
+package collision
+
+import (
+	"image"
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Outline is an arena boundary of any shape. The arena is the area within
+// the first loop, except for the areas within any of the other loops, which
+// are holes.
+type Outline struct {
+	Loops []Loop
+}
+
+// Loop is a closed edge in the X/Z plane, where X is the first and Z is the
+// second coordinate of each point.
+type Loop interface {
+	// Contains returns true if x, y is within the loop.
+	Contains(x, y float32) bool
+	// Touch returns the fractional position along p0 -> p1 where it first
+	// comes within r of the edge of the loop, excluding p1 itself. Starting
+	// on the edge, or within r of it while moving away, doesn't count, so
+	// that lines can leave an edge they bounced off. Whether leaving the edge
+	// crosses it is up to the caller, see Outline.Crossing.
+	Touch(p0, p1 mgl.Vec3, r float32) (float32, bool)
+	// Polygon returns the points around the loop, counter-clockwise. Curves
+	// are approximated with n points.
+	Polygon(n int) []mgl.Vec2
+}
+
+// edgeTolerance is how close to the edge of a loop a point counts as on it,
+// since where an edge was hit is rounded.
+const edgeTolerance = 1e-4
+
+// Polygon is a loop of straight edges between its points, in either order.
+type Polygon []mgl.Vec2
+
+// RegularPolygon returns a polygon with n sides whose corners are radius away
+// from center.
+func RegularPolygon(center mgl.Vec2, radius float32, n int) Polygon {
+	poly := make(Polygon, n)
+	for i := range poly {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		poly[i] = mgl.Vec2{center[0] + radius*float32(math.Cos(angle)), center[1] + radius*float32(math.Sin(angle))}
+	}
+	return poly
+}
+
+func (poly Polygon) Contains(x, y float32) bool {
+	// Even-odd rule, by counting the edges crossed to the right of x, y
+	inside := false
+	for i, a := range poly {
+		b := poly[(i+1)%len(poly)]
+		if (a[1] > y) != (b[1] > y) && x < a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func (poly Polygon) Touch(p0, p1 mgl.Vec3, r float32) (float32, bool) {
+	d_x, d_y := p1[0]-p0[0], p1[2]-p0[2]
+	t, ok := float32(1), false
+	for i, a := range poly {
+		b := poly[(i+1)%len(poly)]
+		if dist, s := PointSegmentDistance2D(p0[0], p0[2], a[0], a[1], b[0], b[1]); dist <= r || dist <= edgeTolerance {
+			// Starts touching, which doesn't count when moving away from it
+			// or off it. Moving away from a segment, it only gets further.
+			e_x, e_y := b[0]-a[0], b[1]-a[1]
+			v_x, v_y := p0[0]-(a[0]+e_x*s), p0[2]-(a[1]+e_y*s)
+			if dist <= edgeTolerance && e_x*d_y-e_y*d_x != 0 || dist > edgeTolerance && v_x*d_x+v_y*d_y > 0 {
+				continue
+			}
+		}
+		if s, hit := CapsuleIntersect2D(a[0], a[1], b[0], b[1], p0[0], p0[2], p1[0], p1[2], r); hit && s < t {
+			t, ok = s, true
+		}
+	}
+	return t, ok
+}
+
+func (poly Polygon) Polygon(n int) []mgl.Vec2 {
+	var area float32
+	for i, a := range poly {
+		b := poly[(i+1)%len(poly)]
+		area += a[0]*b[1] - b[0]*a[1]
+	}
+	points := make([]mgl.Vec2, len(poly))
+	for i := range poly {
+		if area < 0 {
+			points[i] = poly[len(poly)-1-i]
+		} else {
+			points[i] = poly[i]
+		}
+	}
+	return points
+}
+
+// Circle is a round loop.
+type Circle struct {
+	Center mgl.Vec2
+	Radius float32
+}
+
+func (c Circle) Contains(x, y float32) bool {
+	d_x, d_y := x-c.Center[0], y-c.Center[1]
+	return d_x*d_x+d_y*d_y < c.Radius*c.Radius
+}
+
+func (c Circle) Touch(p0, p1 mgl.Vec3, r float32) (float32, bool) {
+	// In float64, and relative to the center
+	p_x, p_y := float64(p0[0])-float64(c.Center[0]), float64(p0[2])-float64(c.Center[1])
+	d_x, d_y := float64(p1[0])-float64(p0[0]), float64(p1[2])-float64(p0[2])
+	radius, rr := float64(c.Radius), float64(r)
+
+	dist := math.Hypot(p_x, p_y)
+	qa := d_x*d_x + d_y*d_y
+	qb := p_x*d_x + p_y*d_y
+	onEdge := math.Abs(dist-radius) <= edgeTolerance
+	inside := dist < radius
+	if onEdge {
+		// Inside is wherever it's moving to
+		inside = qb < 0
+	}
+	if math.Abs(dist-radius) <= rr || onEdge {
+		// Starts touching, which doesn't count when moving away from it or off
+		// it. Moving away from the edge, it only gets further until it's on
+		// the far side.
+		if away := qb < 0 && inside || qb > 0 && !inside; !away {
+			return 0, true
+		}
+	}
+
+	// Moving out to within r inside the edge, or in to within r outside it
+	edge := radius + rr
+	if inside {
+		edge = radius - rr
+	}
+	if edge <= 0 {
+		return 0, false
+	}
+	qc := p_x*p_x + p_y*p_y - edge*edge
+	disc := qb*qb - qa*qc
+	if qa == 0 || disc < 0 {
+		return 0, false
+	}
+	t := (-qb - math.Sqrt(disc)) / qa
+	if inside {
+		// Leaving through the far side
+		t = (-qb + math.Sqrt(disc)) / qa
+	}
+	if t < 0 || t >= 1 {
+		return 0, false
+	}
+	return float32(t), true
+}
+
+func (c Circle) Polygon(n int) []mgl.Vec2 {
+	return RegularPolygon(c.Center, c.Radius, n)
+}
+
+// Bounds returns the rectangle containing the outer loop.
+func (outline *Outline) Bounds() image.Rectangle {
+	if len(outline.Loops) == 0 {
+		return image.Rectangle{}
+	}
+	var r image.Rectangle
+	switch loop := outline.Loops[0].(type) {
+	case Circle:
+		r = image.Rect(
+			int(math.Floor(float64(loop.Center[0]-loop.Radius))), int(math.Floor(float64(loop.Center[1]-loop.Radius))),
+			int(math.Ceil(float64(loop.Center[0]+loop.Radius))), int(math.Ceil(float64(loop.Center[1]+loop.Radius))),
+		)
+	default:
+		for i, p := range loop.Polygon(64) {
+			pr := image.Rect(int(math.Floor(float64(p[0]))), int(math.Floor(float64(p[1]))), int(math.Ceil(float64(p[0]))), int(math.Ceil(float64(p[1]))))
+			if i == 0 {
+				r = pr
+			} else {
+				r = r.Union(pr)
+			}
+		}
+	}
+	return r
+}
+
+// Contains returns true if x, y is within the arena.
+func (outline *Outline) Contains(x, y float32) bool {
+	for i, loop := range outline.Loops {
+		if loop.Contains(x, y) != (i == 0) {
+			return false
+		}
+	}
+	return len(outline.Loops) > 0
+}
+
+// Crossing returns the collision for segment p0 -> p1, which is r thick,
+// touching the edge of any loop, or nil if it stays within the arena. The
+// Loop of the collision is the index of the loop that was touched.
+func (outline *Outline) Crossing(p0, p1 mgl.Vec3, r float32) *CollisionEdge {
+	onEdge := false
+	for i, loop := range outline.Loops {
+		normal, dist := nearestEdge(loop, p0, i > 0)
+		if dist > edgeTolerance {
+			continue
+		}
+		// Starting on the edge, such as after bouncing off it, which only
+		// counts when moving out of the arena
+		if p1.Sub(p0).Dot(normal) < 0 {
+			return &CollisionEdge{Collision: Collision{Point: p0}, Edge: EdgeOutline, Loop: i, Normal: normal}
+		}
+		onEdge = true
+	}
+	if !onEdge && !outline.Contains(p0[0], p0[2]) {
+		// Already outside
+		return &CollisionEdge{Collision: Collision{Point: p0}, Edge: EdgeOutline}
+	}
+	var hit *CollisionEdge
+	for i, loop := range outline.Loops {
+		if t, ok := loop.Touch(p0, p1, r); ok && (hit == nil || t < hit.T) {
+			hit = &CollisionEdge{
+				Collision: Collision{Point: lerp(p0, p1, t), T: t},
+				Edge:      EdgeOutline,
+				Loop:      i,
+			}
+		}
+	}
+	if hit != nil {
+		hit.Normal, _ = nearestEdge(outline.Loops[hit.Loop], hit.Point, hit.Loop > 0)
+	}
+	return hit
+}
+
+// nearestEdge returns the normal of the edge of loop nearest to point, which
+// points into the arena, and the distance to it. The normal points into the
+// loop, unless it's a hole.
+func nearestEdge(loop Loop, point mgl.Vec3, hole bool) (mgl.Vec3, float32) {
+	var n mgl.Vec2
+	var nearest float32
+	if c, ok := loop.(Circle); ok {
+		n = c.Center.Sub(mgl.Vec2{point[0], point[2]})
+		nearest = float32(math.Abs(float64(n.Len() - c.Radius)))
+	} else {
+		nearest = -1
+		poly := loop.Polygon(64)
+		for i, a := range poly {
+			b := poly[(i+1)%len(poly)]
+			if d, _ := PointSegmentDistance2D(point[0], point[2], a[0], a[1], b[0], b[1]); nearest < 0 || d < nearest {
+				// Counter-clockwise, so the inside is on the left
+				nearest, n = d, mgl.Vec2{a[1] - b[1], b[0] - a[0]}
+			}
+		}
+	}
+	if n.Len() == 0 {
+		return mgl.Vec3{}, nearest
+	}
+	if hole {
+		n = n.Mul(-1)
+	}
+	n = n.Normalize()
+	return mgl.Vec3{n[0], 0, n[1]}, nearest
+}
+
+func (outline *Outline) crossing(p0, p1 mgl.Vec3, r float32) *CollisionEdge {
+	return outline.Crossing(p0, p1, r)
+}
@@ -0,0 +1,144 @@
+package collision
+
+import (
+	"errors"
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// ringOutline is a circular arena with a round hole in the middle.
+var ringOutline = &Outline{Loops: []Loop{
+	Circle{mgl.Vec2{0, 0}, 9},
+	Circle{mgl.Vec2{0, 0}, 3},
+}}
+
+// crossOutline is a plus-shaped arena with a square hole in the middle.
+var crossOutline = &Outline{Loops: []Loop{
+	Polygon{{-2, -8}, {2, -8}, {2, -2}, {8, -2}, {8, 2}, {2, 2}, {2, 8}, {-2, 8}, {-2, 2}, {-8, 2}, {-8, -2}, {-2, -2}},
+	Polygon{{-1, -1}, {-1, 1}, {1, 1}, {1, -1}},
+}}
+
+func TestOutlineContains(t *testing.T) {
+	tests := []struct {
+		outline *Outline
+		x, y    float32
+		result  bool
+	}{
+		{ringOutline, 5, 0, true},
+		{ringOutline, 0, 0, false},
+		{ringOutline, 2, 2, false},
+		{ringOutline, 7, 7, false},
+		{crossOutline, 0, 5, true},
+		{crossOutline, 5, 0, true},
+		{crossOutline, 5, 5, false},
+		{crossOutline, 0, 0, false},
+		{crossOutline, 1.5, 1.5, true},
+		{&Outline{Loops: []Loop{RegularPolygon(mgl.Vec2{0, 0}, 5, 6)}}, 4.5, 0, true},
+		{&Outline{Loops: []Loop{RegularPolygon(mgl.Vec2{0, 0}, 5, 6)}}, 0, 4.5, false},
+	}
+	for i, test := range tests {
+		if r := test.outline.Contains(test.x, test.y); r != test.result {
+			t.Errorf("Contains test #%d failed: %v, %v expected %v", i, test.x, test.y, test.result)
+		}
+	}
+}
+
+func TestOutlineCrossing(t *testing.T) {
+	tests := []struct {
+		name    string
+		outline *Outline
+		p0, p1  mgl.Vec3
+		r       float32
+		loop    int
+		t       float32 // Negative if there's no crossing
+		normal  mgl.Vec3
+	}{
+		{"Within the ring", ringOutline, mgl.Vec3{5, 0, 0}, mgl.Vec3{0, 0, 5}, 0, 0, -1, mgl.Vec3{}},
+		{"Out of the ring", ringOutline, mgl.Vec3{5, 0, 0}, mgl.Vec3{13, 0, 0}, 0, 0, 0.5, mgl.Vec3{-1, 0, 0}},
+		{"Into the hole", ringOutline, mgl.Vec3{5, 0, 0}, mgl.Vec3{1, 0, 0}, 0, 1, 0.5, mgl.Vec3{1, 0, 0}},
+		{"Thick into the hole", ringOutline, mgl.Vec3{5, 0, 0}, mgl.Vec3{1, 0, 0}, 1, 1, 0.25, mgl.Vec3{1, 0, 0}},
+		{"Thick out of the ring", ringOutline, mgl.Vec3{5, 0, 0}, mgl.Vec3{13, 0, 0}, 1, 0, 0.375, mgl.Vec3{-1, 0, 0}},
+		{"Up to the hole", ringOutline, mgl.Vec3{5, 0, 0}, mgl.Vec3{3, 0, 0}, 0, 0, -1, mgl.Vec3{}},
+		{"Along an arm", crossOutline, mgl.Vec3{0, 0, 7}, mgl.Vec3{0, 0, 2}, 0, 0, -1, mgl.Vec3{}},
+		{"Cutting the corner", crossOutline, mgl.Vec3{0, 0, 6}, mgl.Vec3{6, 0, 0}, 0, 0, 1.0 / 3, mgl.Vec3{-1, 0, 0}},
+		{"Into the square hole", crossOutline, mgl.Vec3{0, 0, 5}, mgl.Vec3{0, 0, -5}, 0, 1, 0.4, mgl.Vec3{0, 0, 1}},
+		{"Already outside", crossOutline, mgl.Vec3{5, 0, 5}, mgl.Vec3{0, 0, 5}, 0, 0, 0, mgl.Vec3{}},
+		{"In off the edge", ringOutline, mgl.Vec3{9, 0, 0}, mgl.Vec3{5, 0, 0}, 0, 0, -1, mgl.Vec3{}},
+		{"In from just beyond the edge", ringOutline, mgl.Vec3{9.00001, 0, 0}, mgl.Vec3{5, 0, 0}, 0, 0, -1, mgl.Vec3{}},
+		{"Thick in off the edge", ringOutline, mgl.Vec3{8.5, 0, 0}, mgl.Vec3{5, 0, 0}, 1, 0, -1, mgl.Vec3{}},
+		{"Off the edge into the hole", ringOutline, mgl.Vec3{9, 0, 0}, mgl.Vec3{1, 0, 0}, 0, 1, 0.75, mgl.Vec3{1, 0, 0}},
+		{"Along the edge", ringOutline, mgl.Vec3{0, 0, 9}, mgl.Vec3{18, 0, 9}, 0, 0, 0, mgl.Vec3{0, 0, -1}},
+		{"Out off the edge", ringOutline, mgl.Vec3{9, 0, 0}, mgl.Vec3{10, 0, 0}, 0, 0, 0, mgl.Vec3{-1, 0, 0}},
+		{"Out off the hole", ringOutline, mgl.Vec3{3, 0, 0}, mgl.Vec3{2, 0, 0}, 0, 1, 0, mgl.Vec3{1, 0, 0}},
+		{"Off the hole", ringOutline, mgl.Vec3{3, 0, 0}, mgl.Vec3{5, 0, 0}, 0, 0, -1, mgl.Vec3{}},
+		{"In off an arm", crossOutline, mgl.Vec3{0, 0, 8}, mgl.Vec3{0, 0, 3}, 0, 0, -1, mgl.Vec3{}},
+		{"Thick in off an arm", crossOutline, mgl.Vec3{0, 0, 7.5}, mgl.Vec3{0, 0, 3}, 1, 0, -1, mgl.Vec3{}},
+		{"Off an arm into the square hole", crossOutline, mgl.Vec3{0, 0, 8}, mgl.Vec3{0, 0, -8}, 0, 1, 7.0 / 16, mgl.Vec3{0, 0, 1}},
+		{"Out off an arm", crossOutline, mgl.Vec3{0, 0, 8}, mgl.Vec3{0, 0, 9}, 0, 0, 0, mgl.Vec3{0, 0, -1}},
+	}
+	for _, test := range tests {
+		edge := test.outline.Crossing(test.p0, test.p1, test.r)
+		if test.t < 0 {
+			if edge != nil {
+				t.Errorf("%s: expected no crossing; got %s", test.name, edge)
+			}
+			continue
+		}
+		if edge == nil {
+			t.Errorf("%s: expected crossing loop %d at %v; got none", test.name, test.loop, test.t)
+			continue
+		}
+		if edge.Loop != test.loop || !mgl.FloatEqualThreshold(edge.T, test.t, 1e-6) || edge.Edge != EdgeOutline {
+			t.Errorf("%s: expected crossing loop %d at %v; got loop %d at %v", test.name, test.loop, test.t, edge.Loop, edge.T)
+		}
+		if !edge.Normal.ApproxEqualThreshold(test.normal, 1e-5) {
+			t.Errorf("%s: expected normal %v; got %v", test.name, test.normal, edge.Normal)
+		}
+	}
+}
+
+func outlineTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(ringOutline.Bounds())
+	collider.SetOutline(ringOutline)
+
+	// Around the ring between the hole and the edge
+	segment := []mgl.Vec3{{5, 0, 0}, {0, 0, 5}, {-5, 0, 0}, {0, 0, -5}}
+	tracker := collider.Track(&segment)
+	for n := 1; n <= len(segment); n++ {
+		points := segment
+		segment = points[:n]
+		if err := tracker.Update(); err != nil {
+			t.Errorf("expected no collision going around the ring; got %s", err)
+		}
+		segment = points
+	}
+
+	// Straight into the hole
+	segment = append(segment, mgl.Vec3{0, 0, 0})
+	err := tracker.Update()
+	if !errors.Is(err, CollisionBoundary) {
+		t.Fatalf("expected collision with the hole; got %v", err)
+	}
+	if impact, _ := Impact(err); !vecNear(impact.Point, mgl.Vec3{0, 0, -3}) || err.(*CollisionEdge).Loop != 1 {
+		t.Errorf("expected collision with the hole at [0 0 -3]; got %s", err)
+	}
+
+	hit := collider.Raycast(mgl.Vec3{6, 0, 1}, mgl.Vec3{1, 0, 0}, 20)
+	if hit == nil || !hit.Boundary || hit.Loop != 0 || !mgl.FloatEqualThreshold(hit.Point[0], 8.944272, 1e-5) {
+		t.Errorf("expected ray to hit the edge of the ring; got %s", hit)
+	}
+}
+
+func TestGridOutline(t *testing.T) {
+	outlineTester(t, GridCollider)
+}
+
+func TestLinearOutline(t *testing.T) {
+	outlineTester(t, LinearCollider)
+}
+
+func TestQuadtreeOutline(t *testing.T) {
+	outlineTester(t, QuadtreeCollider)
+}
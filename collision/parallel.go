@@ -0,0 +1,75 @@
+package collision
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// phased is a Tracker whose Update is split in two, so that the heads of many
+// lines can be checked in parallel, see Collider.UpdateAll. Update is the
+// same as check followed by commit.
+type phased interface {
+	Tracker
+	// check finds what Update would, without changing anything that the
+	// checks of other trackers read, so it's safe to call concurrently with
+	// them.
+	check()
+	// stale returns true if what check found could have been changed by the
+	// trackers that were committed since.
+	stale() bool
+	// commit applies what check found, and returns what Update would.
+	commit() error
+}
+
+// updateAll checks the trackers of c in parallel, and then commits them all
+// in order. Any that went stale are checked again when it's their turn, and
+// the rest are updated in place, so the results are the same as updating them
+// one after another.
+func updateAll(c Collider, trackers []Tracker) []error {
+	batch := make([]phased, len(trackers))
+	seen := make(map[phased]bool, len(trackers))
+	for i, t := range trackers {
+		// Only the first of duplicates can be checked ahead of time
+		if p, ok := owns(c, t); ok && !seen[p] {
+			batch[i] = p
+			seen[p] = true
+		}
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(batch) {
+		workers = len(batch)
+	}
+	var wg sync.WaitGroup
+	next := int64(-1)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(batch) {
+					return
+				}
+				if batch[i] != nil {
+					batch[i].check()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	errs := make([]error, len(trackers))
+	for i, p := range batch {
+		switch {
+		case p == nil:
+			errs[i] = trackers[i].Update()
+		case p.stale():
+			errs[i] = p.Update()
+		default:
+			errs[i] = p.commit()
+		}
+	}
+	return errs
+}
@@ -0,0 +1,128 @@
+package collision
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// parallelTester races crowds of lines around the arena, updating them one
+// after another with one collider and all at once with UpdateAll on another,
+// and checks that both find the same collisions and send the same events.
+func parallelTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	games := 50
+	if testing.Short() {
+		games = 5
+	}
+	bounds := image.Rect(-10, -10, 10, 10)
+	rng := rand.New(rand.NewSource(7))
+
+	type line struct {
+		segments [2][]mgl.Vec3
+		trackers [2]Tracker
+		heading  float64
+		crashed  bool
+	}
+	for game := 0; game < games; game++ {
+		colliders := [2]Collider{newCollider(bounds), newCollider(bounds)}
+		var events [2][]Event
+		for j := range colliders {
+			j := j
+			colliders[j].Subscribe(func(event Event) {
+				events[j] = append(events[j], event)
+			})
+		}
+
+		lines := make([]*line, 16)
+		for i := range lines {
+			start := mgl.Vec3{rng.Float32()*16 - 8, 0, rng.Float32()*16 - 8}
+			l := &line{heading: rng.Float64() * 2 * math.Pi}
+			var radius float32
+			if i%4 == 3 {
+				radius = 0.1
+			}
+			for j := range colliders {
+				l.segments[j] = []mgl.Vec3{start}
+				l.trackers[j] = colliders[j].TrackRadius(&l.segments[j], radius)
+			}
+			lines[i] = l
+		}
+
+		for tick := 0; tick < 200; tick++ {
+			var moving []*line
+			var batches [2][]Tracker
+			for _, l := range lines {
+				if l.crashed {
+					continue
+				}
+				if rng.Intn(50) == 0 {
+					for _, tracker := range l.trackers {
+						tracker.Trim(2)
+					}
+				}
+				turning := len(l.segments[0]) < 2 || rng.Intn(4) == 0
+				if turning {
+					l.heading += rng.Float64() - 0.5
+				}
+				dist := 0.05 + rng.Float64()*0.3
+				head := l.segments[0][len(l.segments[0])-1]
+				next := mgl.Vec3{head[0] + float32(math.Cos(l.heading)*dist), 0, head[2] + float32(math.Sin(l.heading)*dist)}
+				for j := range l.segments {
+					if turning {
+						l.segments[j] = append(l.segments[j], next)
+					} else {
+						l.segments[j][len(l.segments[j])-1] = next
+					}
+					batches[j] = append(batches[j], l.trackers[j])
+				}
+				moving = append(moving, l)
+			}
+			if len(moving) == 0 {
+				break
+			}
+			if tick%50 == 0 {
+				// Updating the same line twice is allowed too
+				for j := range batches {
+					batches[j] = append(batches[j], batches[j][0])
+				}
+			}
+
+			sequential := make([]error, len(batches[0]))
+			for i, tracker := range batches[0] {
+				sequential[i] = tracker.Update()
+			}
+			parallel := colliders[1].UpdateAll(batches[1])
+			if !reflect.DeepEqual(sequential, parallel) {
+				t.Fatalf("game %d, tick %d: expected %v; got %v", game, tick, sequential, parallel)
+			}
+			if !reflect.DeepEqual(events[0], events[1]) {
+				t.Fatalf("game %d, tick %d: expected events %v; got %v", game, tick, events[0], events[1])
+			}
+			for i, l := range moving {
+				l.crashed = sequential[i] != nil
+			}
+		}
+	}
+}
+
+func TestGridParallel(t *testing.T) {
+	parallelTester(t, GridCollider)
+}
+
+func TestSparseGridParallel(t *testing.T) {
+	parallelTester(t, func(bounds image.Rectangle) Collider {
+		return NewGridCollider(bounds, GridOptions{CellSize: 0.5, Sparse: true})
+	})
+}
+
+func TestLinearParallel(t *testing.T) {
+	parallelTester(t, LinearCollider)
+}
+
+func TestQuadtreeParallel(t *testing.T) {
+	parallelTester(t, QuadtreeCollider)
+}
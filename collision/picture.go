@@ -0,0 +1,267 @@
+package collision
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Picture is a top-down view of a collider in the X/Z plane, for debugging.
+// It can be drawn as an image, or exported as a PNG or an SVG.
+type Picture struct {
+	// Bounds of the arena, which the picture covers.
+	Bounds Boundary
+	// Outline of the arena as polygons, if it has one.
+	Outline   [][]mgl.Vec2
+	Obstacles []*Obstacle
+	// Cells which hold segments of tracked lines, such as the cells of a
+	// grid or the nodes of a quadtree.
+	Cells []Boundary
+	// Lines which are tracked, in order of ID.
+	Lines []PictureLine
+	// Collision is the point of the last collision since the collider was
+	// reset, or nil.
+	Collision *mgl.Vec3
+}
+
+// PictureLine is a tracked line in a Picture.
+type PictureLine struct {
+	ID     int
+	Radius float32
+	Points []mgl.Vec3
+}
+
+// newPicture returns a picture of the arena of a collider, without any
+// lines or cells.
+func newPicture(bounds Boundary, edge boundary, obs obstacles, h *hooks) *Picture {
+	pic := &Picture{
+		Bounds:    bounds,
+		Obstacles: obs,
+	}
+	if outline, ok := edge.(*Outline); ok {
+		for _, loop := range outline.Loops {
+			pic.Outline = append(pic.Outline, loop.Polygon(64))
+		}
+	}
+	if h.collision != nil {
+		p := *h.collision
+		pic.Collision = &p
+	}
+	return pic
+}
+
+// line adds a copy of the points of a tracked line to the picture.
+func (pic *Picture) line(id int, radius float32, segment []mgl.Vec3) {
+	pic.Lines = append(pic.Lines, PictureLine{
+		ID:     id,
+		Radius: radius,
+		Points: append([]mgl.Vec3{}, segment...),
+	})
+}
+
+var (
+	pictureBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	pictureCell       = color.RGBA{0xdd, 0xe4, 0xee, 0xff}
+	pictureEdge       = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	pictureObstacle   = color.RGBA{0x66, 0x66, 0x66, 0xff}
+	pictureCollision  = color.RGBA{0xff, 0x00, 0x00, 0xff}
+
+	// Collisions are marked with a dot of this radius in world units, or of
+	// three pixels if that's bigger.
+	pictureCollisionRadius float32 = 0.5
+
+	// Lines are colored by ID.
+	pictureLines = []color.RGBA{
+		{0x1f, 0x77, 0xb4, 0xff},
+		{0xff, 0x7f, 0x0e, 0xff},
+		{0x2c, 0xa0, 0x2c, 0xff},
+		{0x94, 0x67, 0xbd, 0xff},
+		{0x8c, 0x56, 0x4b, 0xff},
+		{0xe3, 0x77, 0xc2, 0xff},
+		{0x17, 0xbe, 0xcf, 0xff},
+		{0xbc, 0xbd, 0x22, 0xff},
+	}
+)
+
+func lineColor(id int) color.RGBA {
+	return pictureLines[id%len(pictureLines)]
+}
+
+// runs calls fn with each run of points between breaks.
+func runs(points []mgl.Vec3, fn func(run []mgl.Vec3)) {
+	start := 0
+	for i := 0; i <= len(points); i++ {
+		if i < len(points) && !IsBreak(points[i]) {
+			continue
+		}
+		if i > start {
+			fn(points[start:i])
+		}
+		start = i + 1
+	}
+}
+
+// canvas draws in world units onto an image.
+type canvas struct {
+	img    *image.RGBA
+	bounds Boundary
+	scale  float32
+}
+
+func (c *canvas) pixel(x, y float32) (float32, float32) {
+	return (x - c.bounds.X1) * c.scale, (y - c.bounds.Y1) * c.scale
+}
+
+func (c *canvas) rect(b Boundary, col color.RGBA) {
+	x1, y1 := c.pixel(b.X1, b.Y1)
+	x2, y2 := c.pixel(b.X2, b.Y2)
+	r := image.Rect(int(math.Floor(float64(x1))), int(math.Floor(float64(y1))), int(math.Ceil(float64(x2))), int(math.Ceil(float64(y2))))
+	draw.Draw(c.img, r, &image.Uniform{col}, image.Point{}, draw.Src)
+}
+
+// segment fills the pixels within radius of a -> b, and at least the pixels
+// that it passes through.
+func (c *canvas) segment(a, b mgl.Vec3, radius float32, col color.RGBA) {
+	ax, ay := c.pixel(a[0], a[2])
+	bx, by := c.pixel(b[0], b[2])
+	r := maxf(radius*c.scale, 0.5)
+	x0, x1 := int(math.Floor(float64(minf(ax, bx)-r))), int(math.Ceil(float64(maxf(ax, bx)+r)))
+	y0, y1 := int(math.Floor(float64(minf(ay, by)-r))), int(math.Ceil(float64(maxf(ay, by)+r)))
+	area := image.Rect(x0, y0, x1, y1).Intersect(c.img.Rect)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if dist, _ := PointSegmentDistance2D(float32(x)+0.5, float32(y)+0.5, ax, ay, bx, by); dist <= r {
+				c.img.SetRGBA(x, y, col)
+			}
+		}
+	}
+}
+
+// Image draws the picture with scale pixels per world unit. Z is down the
+// image.
+func (pic *Picture) Image(scale float32) *image.RGBA {
+	b := pic.Bounds
+	w := int(math.Ceil(float64((b.X2 - b.X1) * scale)))
+	h := int(math.Ceil(float64((b.Y2 - b.Y1) * scale)))
+	c := &canvas{img: image.NewRGBA(image.Rect(0, 0, w, h)), bounds: b, scale: scale}
+	draw.Draw(c.img, c.img.Rect, &image.Uniform{pictureBackground}, image.Point{}, draw.Src)
+
+	for _, cell := range pic.Cells {
+		c.rect(cell, pictureCell)
+	}
+	for _, poly := range pic.Outline {
+		for i, p := range poly {
+			q := poly[(i+1)%len(poly)]
+			c.segment(mgl.Vec3{p[0], 0, p[1]}, mgl.Vec3{q[0], 0, q[1]}, 0, pictureEdge)
+		}
+	}
+	for _, obstacle := range pic.Obstacles {
+		obstacle.Segments(func(a, b mgl.Vec3) {
+			c.segment(a, b, obstacle.Radius, pictureObstacle)
+		})
+	}
+	for _, line := range pic.Lines {
+		col := lineColor(line.ID)
+		runs(line.Points, func(run []mgl.Vec3) {
+			// A run of a single point is drawn as a dot
+			c.segment(run[0], run[0], line.Radius, col)
+			for i := 1; i < len(run); i++ {
+				c.segment(run[i-1], run[i], line.Radius, col)
+			}
+		})
+	}
+	if pic.Collision != nil {
+		c.segment(*pic.Collision, *pic.Collision, maxf(pictureCollisionRadius, 3/scale), pictureCollision)
+	}
+	return c.img
+}
+
+// WritePNG writes the picture drawn with scale pixels per world unit as a PNG.
+func (pic *Picture) WritePNG(w io.Writer, scale float32) error {
+	return png.Encode(w, pic.Image(scale))
+}
+
+func svgColor(col color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", col.R, col.G, col.B)
+}
+
+// svgPoints formats points in the X/Z plane for a points attribute.
+func svgPoints(n int, point func(i int) (float32, float32)) string {
+	var s []byte
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			s = append(s, ' ')
+		}
+		x, y := point(i)
+		s = append(s, fmt.Sprintf("%v,%v", x, y)...)
+	}
+	return string(s)
+}
+
+// WriteSVG writes the picture as an SVG in world units, which is displayed at
+// scale pixels per world unit. Z is down the image, like Image.
+func (pic *Picture) WriteSVG(w io.Writer, scale float32) error {
+	b := pic.Bounds
+	width, height := b.X2-b.X1, b.Y2-b.Y1
+	// Thin lines are drawn one pixel wide
+	thin := 1 / scale
+	stroke := func(radius float32) float32 {
+		return maxf(2*radius, thin)
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="%v %v %v %v" width="%v" height="%v">`+"\n", b.X1, b.Y1, width, height, width*scale, height*scale)
+	fmt.Fprintf(out, `<rect x="%v" y="%v" width="%v" height="%v" fill="%s"/>`+"\n", b.X1, b.Y1, width, height, svgColor(pictureBackground))
+
+	if len(pic.Cells) > 0 {
+		fmt.Fprintf(out, `<g class="cells" fill="%s">`+"\n", svgColor(pictureCell))
+		for _, cell := range pic.Cells {
+			fmt.Fprintf(out, `<rect x="%v" y="%v" width="%v" height="%v"/>`+"\n", cell.X1, cell.Y1, cell.X2-cell.X1, cell.Y2-cell.Y1)
+		}
+		fmt.Fprintln(out, `</g>`)
+	}
+
+	for _, poly := range pic.Outline {
+		fmt.Fprintf(out, `<polygon class="outline" points="%s" fill="none" stroke="%s" stroke-width="%v"/>`+"\n", svgPoints(len(poly), func(i int) (float32, float32) {
+			return poly[i][0], poly[i][1]
+		}), svgColor(pictureEdge), thin)
+	}
+
+	for i, obstacle := range pic.Obstacles {
+		points := obstacle.Points
+		if len(points) == 1 {
+			fmt.Fprintf(out, `<circle class="obstacle" id="obstacle-%d" cx="%v" cy="%v" r="%v" fill="%s"/>`+"\n", i, points[0][0], points[0][1], maxf(obstacle.Radius, thin/2), svgColor(pictureObstacle))
+			continue
+		}
+		element := "polyline"
+		if obstacle.Closed {
+			element = "polygon"
+		}
+		fmt.Fprintf(out, `<%s class="obstacle" id="obstacle-%d" points="%s" fill="none" stroke="%s" stroke-width="%v" stroke-linecap="round" stroke-linejoin="round"/>`+"\n", element, i, svgPoints(len(points), func(i int) (float32, float32) {
+			return points[i][0], points[i][1]
+		}), svgColor(pictureObstacle), stroke(obstacle.Radius))
+	}
+
+	for _, line := range pic.Lines {
+		fmt.Fprintf(out, `<g class="line" id="line-%d" fill="none" stroke="%s" stroke-width="%v" stroke-linecap="round" stroke-linejoin="round">`+"\n", line.ID, svgColor(lineColor(line.ID)), stroke(line.Radius))
+		runs(line.Points, func(run []mgl.Vec3) {
+			fmt.Fprintf(out, `<polyline points="%s"/>`+"\n", svgPoints(len(run), func(i int) (float32, float32) {
+				return run[i][0], run[i][2]
+			}))
+		})
+		fmt.Fprintln(out, `</g>`)
+	}
+
+	if p := pic.Collision; p != nil {
+		fmt.Fprintf(out, `<circle class="collision" cx="%v" cy="%v" r="%v" fill="%s"/>`+"\n", p[0], p[2], maxf(pictureCollisionRadius, 3*thin), svgColor(pictureCollision))
+	}
+	fmt.Fprintln(out, `</svg>`)
+	return out.Flush()
+}
@@ -0,0 +1,184 @@
+package collision
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// attachPictures writes a PNG and an SVG of each collider into a new directory
+// for a test which failed, along with a PNG of where the lines in each one
+// differ from the first.
+func attachPictures(t *testing.T, colliders ...Collider) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "collision-")
+	if err != nil {
+		t.Logf("failed to attach pictures: %s", err)
+		return
+	}
+	name := strings.NewReplacer("*", "", "collision.", "")
+	var first *image.RGBA
+	for i, collider := range colliders {
+		pic := collider.Picture()
+		kind := collider
+		if thick, ok := collider.(thick); ok {
+			kind = thick.Collider
+		}
+		base := filepath.Join(dir, fmt.Sprintf("%d-%s", i, name.Replace(fmt.Sprintf("%T", kind))))
+		if err := writeFile(base+".png", func(w io.Writer) error { return pic.WritePNG(w, 20) }); err != nil {
+			t.Logf("failed to attach pictures: %s", err)
+			return
+		}
+		if err := writeFile(base+".svg", func(w io.Writer) error { return pic.WriteSVG(w, 20) }); err != nil {
+			t.Logf("failed to attach pictures: %s", err)
+			return
+		}
+
+		// Cells are laid out differently by each collider
+		pic.Cells = nil
+		img := pic.Image(20)
+		if i == 0 {
+			first = img
+			continue
+		}
+		if err := writeFile(base+"-diff.png", func(w io.Writer) error { return png.Encode(w, diffImage(first, img)) }); err != nil {
+			t.Logf("failed to attach pictures: %s", err)
+			return
+		}
+	}
+	t.Logf("attached pictures of the colliders in %s", dir)
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// diffImage returns a faded copy of a, with the pixels that differ in b
+// drawn in magenta.
+func diffImage(a, b *image.RGBA) *image.RGBA {
+	diff := image.NewRGBA(a.Rect)
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		for x := a.Rect.Min.X; x < a.Rect.Max.X; x++ {
+			c := a.RGBAAt(x, y)
+			if c != b.RGBAAt(x, y) {
+				diff.SetRGBA(x, y, color.RGBA{0xff, 0x00, 0xff, 0xff})
+				continue
+			}
+			diff.SetRGBA(x, y, color.RGBA{0xff - (0xff-c.R)/4, 0xff - (0xff-c.G)/4, 0xff - (0xff-c.B)/4, 0xff})
+		}
+	}
+	return diff
+}
+
+func pictureTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	collider.SetObstacles([]*Obstacle{Pillar(mgl.Vec2{5, 5}, 1)})
+	a := []mgl.Vec3{{-5, 0, 0}, {5, 0, 0}}
+	b := []mgl.Vec3{{0, 0, -5}, {0, 0, 5}}
+	if err := collider.Track(&a).Update(); err != nil {
+		t.Fatalf("expected no collision; got %s", err)
+	}
+	if err := collider.Track(&b).Update(); err == nil {
+		t.Fatalf("expected a collision")
+	}
+
+	pic := collider.Picture()
+	if len(pic.Lines) != 2 || pic.Lines[0].ID != 0 || pic.Lines[1].ID != 1 {
+		t.Errorf("expected lines 0 and 1; got %v", pic.Lines)
+	}
+	if pic.Collision == nil || !vecNear(*pic.Collision, mgl.Vec3{0, 0, 0}) {
+		t.Errorf("expected the collision at the crossing; got %v", pic.Collision)
+	}
+	if _, linear := collider.(*linearCollider); linear == (len(pic.Cells) > 0) {
+		t.Errorf("expected cells only for colliders with cells; got %v", pic.Cells)
+	}
+
+	// Cells are laid out differently by each collider, and may cover
+	// everything
+	cells := pic.Cells
+	pic.Cells = nil
+	img := pic.Image(4)
+	pic.Cells = cells
+	if size := img.Rect.Size(); size != image.Pt(80, 80) {
+		t.Errorf("expected an image of 80x80; got %v", size)
+	}
+	for _, test := range []struct {
+		name  string
+		x, y  float32
+		color color.RGBA
+	}{
+		{"line 0", -4, 0, lineColor(0)},
+		{"line 1", 0, -4, lineColor(1)},
+		{"collision", 0, 0, pictureCollision},
+		{"pillar", 5, 5, pictureObstacle},
+		{"background", -8, -8, pictureBackground},
+	} {
+		x, y := int((test.x+10)*4), int((test.y+10)*4)
+		if got := img.RGBAAt(x, y); got != test.color {
+			t.Errorf("%s: expected %v at %d,%d; got %v", test.name, test.color, x, y, got)
+		}
+	}
+
+	svg := &bytes.Buffer{}
+	if err := pic.WriteSVG(svg, 4); err != nil {
+		t.Fatalf("expected to write an SVG; got %s", err)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(svg.Bytes()))
+	ids := map[string]bool{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected a valid SVG; got %s", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "id" || attr.Name.Local == "class" {
+					ids[attr.Value] = true
+				}
+			}
+		}
+	}
+	for _, id := range []string{"line-0", "line-1", "obstacle-0", "collision"} {
+		if !ids[id] {
+			t.Errorf("expected %q in the SVG; got %s", id, svg)
+		}
+	}
+
+	collider.Reset()
+	if pic := collider.Picture(); len(pic.Lines) != 0 || pic.Collision != nil || len(pic.Cells) != 0 || len(pic.Obstacles) != 1 {
+		t.Errorf("expected only the obstacle after reset; got %+v", pic)
+	}
+}
+
+func TestGridPicture(t *testing.T) {
+	pictureTester(t, GridCollider)
+}
+
+func TestLinearPicture(t *testing.T) {
+	pictureTester(t, LinearCollider)
+}
+
+func TestQuadtreePicture(t *testing.T) {
+	pictureTester(t, QuadtreeCollider)
+}
@@ -0,0 +1,127 @@
+package collision
+
+import (
+	"fmt"
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Side is which side of a query segment something is on, relative to its
+// direction in the X/Z plane.
+type Side int
+
+const (
+	SideNone  Side = 0
+	SideLeft  Side = -1
+	SideRight Side = 1
+)
+
+func (side Side) String() string {
+	switch side {
+	case SideLeft:
+		return "left"
+	case SideRight:
+		return "right"
+	}
+	return "none"
+}
+
+// Proximity is the result of a near-miss query against tracked segments.
+type Proximity struct {
+	// Distance from the query to the segment.
+	Distance float32
+	// Point on the segment which is nearest to the query.
+	Point mgl.Vec3
+	// Side of the query that the segment is on. Point queries don't have a
+	// direction, so it's always SideNone for those.
+	Side Side
+
+	// Obstacle is true when the segment is a wall of an obstacle, in which
+	// case ID is the index of the obstacle.
+	Obstacle bool
+
+	// ID of the tracked line that the segment belongs to.
+	ID int
+	// Self is true when the segment belongs to the querying line.
+	Self bool
+	// X0, Y0, X1, Y1 is the nearest segment.
+	X0, Y0, X1, Y1 float32
+}
+
+func (p *Proximity) String() string {
+	if p.Obstacle {
+		return fmt.Sprintf("<%v from wall of obstacle %d: %v,%v -> %v,%v on the %s>", p.Distance, p.ID, p.X0, p.Y0, p.X1, p.Y1, p.Side)
+	}
+	return fmt.Sprintf("<%v from segment of line %d: %v,%v -> %v,%v on the %s>", p.Distance, p.ID, p.X0, p.Y0, p.X1, p.Y1, p.Side)
+}
+
+// nearSkip returns the offset of the newest segment of the trail that is
+// considered when looking for segments near its head, and the fraction of that
+// segment which is considered. The trail is trivially near itself, so the
+// head and anything within radius of it along the trail are skipped. Gaps
+// count as straight across, so a wide gap ends the skipping.
+func nearSkip(segment []mgl.Vec3, radius float32) (int, float32) {
+	var length float32
+	for k := len(segment) - 3; k >= 0; k-- {
+		a, b := segment[k], segment[k+1]
+		if IsBreak(b) {
+			// The head itself starts after the break
+			continue
+		}
+		if IsBreak(a) {
+			if k == 0 {
+				break
+			}
+			// Skip over to the end of the run before the break
+			k--
+			a = segment[k]
+			length += b.Sub(a).Len()
+			if length > radius {
+				return k, 1
+			}
+			continue
+		}
+		l := b.Sub(a).Len()
+		length += l
+		if length > radius {
+			return k, (length - radius) / l
+		}
+	}
+	return -1, 0
+}
+
+// segmentProximity returns the proximity of segment a -> b of the tracked line
+// id to the query segment p0 -> p1, or nil if it's further than radius. Walls
+// of height above both which don't overlap are further apart by the gap
+// between them.
+func segmentProximity(a, b, p0, p1 mgl.Vec3, radius, height float32, id int, self bool) *Proximity {
+	dist, ta, tb := SegmentDistance2D(a[0], a[2], b[0], b[2], p0[0], p0[2], p1[0], p1[2])
+	point, query := lerp(a, b, ta), lerp(p0, p1, tb)
+	if gap := float32(math.Abs(float64(query[1]-point[1]))) - height; height > 0 && gap >= 0 {
+		dist = float32(math.Hypot(float64(dist), float64(gap)))
+	}
+	if dist > radius {
+		return nil
+	}
+
+	side := SideNone
+	dir, to := p1.Sub(p0), point.Sub(query)
+	if cross := dir[0]*to[2] - dir[2]*to[0]; cross > 0 {
+		side = SideRight
+	} else if cross < 0 {
+		side = SideLeft
+	}
+
+	return &Proximity{
+		Distance: dist,
+		Point:    point,
+		Side:     side,
+		ID:       id,
+		Self:     self,
+		X0:       a[0],
+		Y0:       a[2],
+		X1:       b[0],
+		Y1:       b[2],
+	}
+}
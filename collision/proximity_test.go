@@ -0,0 +1,80 @@
+package collision
+
+import (
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+func proximityTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	lines := [][]mgl.Vec3{
+		{{-5, 0, 0}, {5, 0, 0}},
+		{{-5, 0, 1}, {0, 0, 1}},
+		{{0, 0, 5}, {4, 0, 5}, {4, 0, 6}, {0.5, 0, 6}},
+	}
+	trackers := make([]Tracker, len(lines))
+	for i := range lines {
+		trackers[i] = collider.Track(&lines[i])
+	}
+	for i := range lines {
+		// Replay each line so that every segment is registered
+		points := lines[i]
+		for n := 1; n <= len(points); n++ {
+			lines[i] = points[:n]
+			if err := trackers[i].Update(); err != nil {
+				t.Fatalf("line %d: unexpected collision: %s", i, err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		near   *Proximity
+		expect *Proximity
+	}{
+		{"b out of range", trackers[1].Near(0.5), nil},
+		{"b near a", trackers[1].Near(1.5), &Proximity{Distance: 1, Side: SideLeft, ID: trackers[0].ID()}},
+		{"c near itself", trackers[2].Near(1.5), &Proximity{Distance: 1, Side: SideRight, ID: trackers[2].ID(), Self: true}},
+		{"point near a", collider.Nearest(mgl.Vec3{2, 0, -0.3}, 0.5), &Proximity{Distance: 0.3, Point: mgl.Vec3{2, 0, 0}, Side: SideNone, ID: trackers[0].ID()}},
+		{"point out of range", collider.Nearest(mgl.Vec3{2, 0, -3}, 1), nil},
+	}
+
+	for _, test := range tests {
+		near, expect := test.near, test.expect
+		if expect == nil {
+			if near != nil {
+				t.Errorf("%s: expected nothing nearby; got %s", test.name, near)
+			}
+			continue
+		}
+		if near == nil {
+			t.Errorf("%s: expected %v; got nothing nearby", test.name, expect)
+			continue
+		}
+		if !mgl.FloatEqualThreshold(near.Distance, expect.Distance, 1e-5) || near.Side != expect.Side || near.ID != expect.ID || near.Self != expect.Self {
+			t.Errorf("%s: expected %v; got %v", test.name, expect, near)
+		}
+		if expect.Point != (mgl.Vec3{}) && !near.Point.ApproxEqualThreshold(expect.Point, 1e-5) {
+			t.Errorf("%s: expected nearest point %v; got %v", test.name, expect.Point, near.Point)
+		}
+	}
+
+	// The trail right behind the head is never nearer than the radius
+	if near := trackers[2].Near(0.1); near != nil && near.Distance < 0.099 {
+		t.Errorf("expected own trail near the head to be skipped; got %v", near)
+	}
+}
+
+func TestGridProximity(t *testing.T) {
+	proximityTester(t, GridCollider)
+}
+
+func TestLinearProximity(t *testing.T) {
+	proximityTester(t, LinearCollider)
+}
+
+func TestQuadtreeProximity(t *testing.T) {
+	proximityTester(t, QuadtreeCollider)
+}
@@ -0,0 +1,573 @@
+package collision
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Nodes are split once they hold more than quadCapacity segments, unless they
+// are already quadMaxDepth deep.
+const quadCapacity = 8
+const quadMaxDepth = 16
+
+// QuadtreeCollider is a collision checker backed by a dynamic quadtree of
+// segment bounding boxes. Memory grows with the number of segments rather than
+// the size of the arena, which makes it suitable for huge arenas.
+func QuadtreeCollider(bounds image.Rectangle) Collider {
+	tree := &quadtreeCollider{
+		bounds: Boundary{float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Max.X), float32(bounds.Max.Y)},
+	}
+	tree.SetOutline(nil)
+	tree.Reset()
+	return tree
+}
+
+type quadtreeCollider struct {
+	bounds    Boundary
+	edge      boundary
+	obstacles obstacles
+	root      *quadNode
+
+	// Height of the walls of trails, or 0 to ignore heights.
+	wallHeight float32
+
+	// Intersect segments in fixed-point, see SetReproducible.
+	reproducible bool
+
+	// Boxes which were inserted or removed during UpdateAll.
+	batch []box
+
+	// Subscribers to events.
+	hooks
+
+	// Every line tracked since the last reset, by ID.
+	tracked    []*quadTracker
+	numTracked int
+}
+
+func (tree *quadtreeCollider) UpdateAll(trackers []Tracker) []error {
+	tree.batch = []box{}
+	defer func() { tree.batch = nil }()
+	return updateAll(tree, trackers)
+}
+
+func (tree *quadtreeCollider) UpdateTick(trackers []Tracker, rule TickRule) []error {
+	return updateTick(tree, &tree.hooks, tree.wallHeight, tree.reproducible, trackers, rule)
+}
+
+// changed notes that r was inserted or removed, if it's during UpdateAll.
+func (tree *quadtreeCollider) changed(r box) {
+	if tree.batch != nil {
+		tree.batch = append(tree.batch, r)
+	}
+}
+
+func (tree *quadtreeCollider) SetOutline(outline *Outline) {
+	tree.edge = tree.bounds
+	if outline != nil {
+		tree.edge = outline
+	}
+}
+
+func (tree *quadtreeCollider) SetWrap(wrap bool) {
+	tree.edge = tree.bounds
+	if wrap {
+		tree.edge = unbounded{}
+	}
+}
+
+func (tree *quadtreeCollider) SetWallHeight(height float32) {
+	tree.wallHeight = height
+}
+
+func (tree *quadtreeCollider) SetReproducible(reproducible bool) {
+	tree.reproducible = reproducible
+}
+
+func (tree *quadtreeCollider) SetObstacles(obs []*Obstacle) {
+	tree.obstacles = obs
+}
+
+func (tree *quadtreeCollider) Reset() {
+	root := newQuadNode(box{tree.bounds.X1, tree.bounds.Y1, tree.bounds.X2, tree.bounds.Y2})
+	tree.root = &root
+	tree.tracked = nil
+	tree.numTracked = 0
+	tree.collision = nil
+}
+
+// Picture shows the nodes which hold segments as cells.
+func (tree *quadtreeCollider) Picture() *Picture {
+	pic := newPicture(tree.bounds, tree.edge, tree.obstacles, &tree.hooks)
+	for _, tracker := range tree.tracked {
+		if !tracker.closed {
+			pic.line(tracker.id, tracker.radius, *tracker.segment)
+		}
+	}
+	tree.root.cells(&pic.Cells)
+	return pic
+}
+
+func (tree *quadtreeCollider) String() string {
+	w := &bytes.Buffer{}
+	tree.root.write(w, 0)
+	return w.String()
+}
+
+func (tree *quadtreeCollider) Track(segment *[]mgl.Vec3) Tracker {
+	return tree.TrackRadius(segment, 0)
+}
+
+func (tree *quadtreeCollider) TrackRadius(segment *[]mgl.Vec3, radius float32) Tracker {
+	tracker := &quadTracker{
+		trackedLine: newTrackedLine(tree, segment, tree.numTracked, radius),
+		tree:        tree,
+	}
+	tree.tracked = append(tree.tracked, tracker)
+	tree.numTracked += 1
+	return tracker
+}
+
+func (tree *quadtreeCollider) Untrack(t Tracker) {
+	tracker, ok := t.(*quadTracker)
+	if !ok || tracker.tree != tree || tracker.closed {
+		return
+	}
+	segment := *tracker.segment
+	for i := 0; i+1 < len(segment); i++ {
+		tree.unregister(tracker, tracker.trimmed+i, segment[i], segment[i+1])
+	}
+	tracker.closed = true
+}
+
+// unregister removes the tracker's segment at offset, which is a -> b, from
+// the tree. Gaps were never registered.
+func (tree *quadtreeCollider) unregister(tracker *quadTracker, offset int, a, b mgl.Vec3) {
+	if isGap(a, b) {
+		return
+	}
+	if head := tracker.head; head != nil && head.offset == offset {
+		// Its box may be older than a -> b
+		head.node.remove(head)
+		tracker.head = nil
+		return
+	}
+	var items []*quadItem
+	tree.root.query(segmentBox(a, b).grow(tracker.radius), func(item *quadItem) {
+		if item.tracker == tracker && item.offset == offset {
+			items = append(items, item)
+		}
+	})
+	for _, item := range items {
+		item.node.remove(item)
+	}
+}
+
+func (tree *quadtreeCollider) Nearest(point mgl.Vec3, radius float32) *Proximity {
+	return tree.nearest(nil, point, point, radius)
+}
+
+func (tree *quadtreeCollider) nearest(self *quadTracker, p0, p1 mgl.Vec3, radius float32) *Proximity {
+	skip, clip := -1, float32(0)
+	if self != nil {
+		skip, clip = nearSkip(*self.segment, radius)
+		skip += self.trimmed
+	}
+
+	// Ties go to the lowest line ID and offset, since the order of items in
+	// the tree depends on the order they were inserted in.
+	near, nearOffset := tree.obstacles.proximity(p0, p1, radius), -1
+	tree.root.query(segmentBox(p0, p1).grow(radius), func(item *quadItem) {
+		if item.tracker == self && item.offset > skip {
+			return
+		}
+		a, b, ok := item.Points()
+		if !ok {
+			return
+		}
+		if item.tracker == self && item.offset == skip {
+			b = lerp(a, b, clip)
+		}
+		p := segmentProximity(a, b, p0, p1, radius, tree.wallHeight, item.tracker.id, item.tracker == self)
+		if p == nil || near != nil && p.Distance > near.Distance {
+			return
+		}
+		if near != nil && p.Distance == near.Distance && (near.Obstacle || near.ID < p.ID || near.ID == p.ID && nearOffset < item.offset) {
+			return
+		}
+		near, nearOffset = p, item.offset
+	})
+	return near
+}
+
+func (tree *quadtreeCollider) Raycast(origin, direction mgl.Vec3, maxDist float32) *RayHit {
+	return tree.raycast(nil, origin, direction, maxDist)
+}
+
+func (tree *quadtreeCollider) raycast(self *quadTracker, origin, direction mgl.Vec3, maxDist float32) *RayHit {
+	r, ok := newRay(origin, direction, maxDist)
+	if !ok {
+		return nil
+	}
+	r.height = tree.wallHeight
+
+	head := -1
+	if self != nil {
+		head = self.trimmed + len(*self.segment) - 2
+	}
+
+	hit := nearerHit(r.boundaryHit(tree.edge), tree.obstacles.hit(r))
+	tree.root.query(segmentBox(origin, r.end()), func(item *quadItem) {
+		if item.tracker == self && item.offset == head {
+			return
+		}
+		a, b, ok := item.Points()
+		if !ok {
+			return
+		}
+		hit = nearerHit(hit, r.segmentHit(a, b, item.tracker.id))
+	})
+	return hit
+}
+
+type quadTracker struct {
+	trackedLine
+	tree *quadtreeCollider
+
+	// Number of points that were trimmed off the start of the line, which
+	// offsets count from.
+	trimmed int
+
+	// Last registered head segment, which is re-registered as it's extended.
+	head *quadItem
+
+	// What the last check found, until it's committed.
+	pass quadPass
+}
+
+// quadPass is what checking the head of a line found.
+type quadPass struct {
+	// Nothing to commit, such as for a gap.
+	noop   bool
+	offset int
+	// Box around the head that the tree was queried with.
+	query box
+	err   error
+}
+
+func (tracker *quadTracker) Near(radius float32) *Proximity {
+	segment := *tracker.segment
+	n := len(segment)
+	if n < 2 || isGap(segment[n-2], segment[n-1]) {
+		return nil
+	}
+	return tracker.tree.nearest(tracker, segment[n-2], segment[n-1], radius)
+}
+
+func (tracker *quadTracker) Raycast(direction mgl.Vec3, maxDist float32) *RayHit {
+	segment := *tracker.segment
+	if len(segment) == 0 || IsBreak(segment[len(segment)-1]) {
+		return nil
+	}
+	return tracker.tree.raycast(tracker, segment[len(segment)-1], direction, maxDist)
+}
+
+func (tracker *quadTracker) Trim(n int) {
+	segment := *tracker.segment
+	if n > len(segment)-2 {
+		n = len(segment) - 2
+	}
+	if n <= 0 {
+		return
+	}
+	if !tracker.closed {
+		for i := 0; i < n; i++ {
+			tracker.tree.unregister(tracker, tracker.trimmed+i, segment[i], segment[i+1])
+		}
+	}
+	*tracker.segment = segment[n:]
+	tracker.trimmed += n
+}
+
+func (tracker *quadTracker) Close() {
+	tracker.tree.Untrack(tracker)
+}
+
+func (tracker *quadTracker) Update() error {
+	tracker.check()
+	return tracker.commit()
+}
+
+// check finds the collision of the head, without registering it. The tree is
+// queried as it is, and the segments which registering would insert or
+// re-insert are checked directly.
+func (tracker *quadTracker) check() {
+	tracker.pass = quadPass{noop: true}
+	segment := *tracker.segment
+	tree := tracker.tree
+
+	head0, head1, offset, ok := headOf(segment, tracker.closed)
+	if !ok {
+		return
+	}
+	offset += tracker.trimmed
+
+	skip, clip := selfSkip(segment, tracker.radius)
+	skip += tracker.trimmed
+	from := tracker.trimmed
+	if tracker.head != nil {
+		from = tracker.head.offset
+	}
+
+	var hit *CollisionSegment
+	query := segmentBox(head0, head1).grow(tracker.radius)
+	check := func(item *quadItem) {
+		if item.tracker == tracker && item.offset > skip {
+			return
+		}
+		a, b, ok := item.Points()
+		if !ok {
+			return
+		}
+		if item.tracker == tracker && item.offset == skip && clip < 1 {
+			b = lerp(a, b, clip)
+		}
+		r := tracker.radius + item.tracker.radius
+		if c := segmentCollision(a, b, head0, head1, r, tree.wallHeight, tree.reproducible, item.tracker.id, item.offset-item.tracker.trimmed, item.tracker == tracker); c != nil && !item.tracker.tickHead(item.offset-item.tracker.trimmed) && before(c, hit) {
+			hit = c
+		}
+	}
+	tree.root.query(query, func(item *quadItem) {
+		if item.tracker == tracker && item.offset >= from {
+			return
+		}
+		check(item)
+	})
+	for i := from; i <= offset && i <= skip; i++ {
+		item := &quadItem{tracker: tracker, offset: i}
+		a, b, ok := item.Points()
+		if !ok || isGap(a, b) || !segmentBox(a, b).grow(tracker.radius).intersects(query) {
+			continue
+		}
+		check(item)
+	}
+
+	tracker.pass = quadPass{
+		offset: offset,
+		query:  query,
+		err:    earliest(hit, tree.obstacles.collision(head0, head1, tracker.radius, tree.reproducible), tree.edge.crossing(head0, head1, tracker.radius)),
+	}
+}
+
+// stale returns true if anything was inserted into or removed from the tree
+// where the last check queried it.
+func (tracker *quadTracker) stale() bool {
+	if tracker.pass.noop {
+		return false
+	}
+	for _, r := range tracker.tree.batch {
+		if r.intersects(tracker.pass.query) {
+			return true
+		}
+	}
+	return false
+}
+
+// commit registers the head, even if it crosses the boundary, so that other
+// lines can still hit what's left inside.
+func (tracker *quadTracker) commit() error {
+	tracker.committed()
+	pass := tracker.pass
+	tracker.pass = quadPass{noop: true}
+	if pass.noop {
+		return nil
+	}
+	tracker.register(pass.offset)
+	return tracker.tree.updated(tracker, pass.err)
+}
+
+// register inserts every segment from the last registered head up to the
+// segment at offset, except for gaps. The last head is re-inserted, since its
+// bounding box changes as it's extended.
+func (tracker *quadTracker) register(offset int) {
+	from := tracker.trimmed
+	if tracker.head != nil {
+		from = tracker.head.offset
+		tracker.head.node.remove(tracker.head)
+		tracker.tree.changed(tracker.head.box)
+	}
+	for i := from; i <= offset; i++ {
+		item := &quadItem{tracker: tracker, offset: i}
+		a, b, _ := item.Points()
+		if isGap(a, b) {
+			continue
+		}
+		item.box = segmentBox(a, b).grow(tracker.radius)
+		tracker.tree.root.insert(item, 0)
+		tracker.tree.changed(item.box)
+		tracker.head = item
+	}
+}
+
+// box is an axis-aligned bounding box in the X/Z plane.
+type box struct {
+	minX, minY, maxX, maxY float32
+}
+
+func segmentBox(a, b mgl.Vec3) box {
+	r := box{a[0], a[2], b[0], b[2]}
+	if r.minX > r.maxX {
+		r.minX, r.maxX = r.maxX, r.minX
+	}
+	if r.minY > r.maxY {
+		r.minY, r.maxY = r.maxY, r.minY
+	}
+	return r
+}
+
+func (r box) grow(d float32) box {
+	return box{r.minX - d, r.minY - d, r.maxX + d, r.maxY + d}
+}
+
+func (r box) intersects(o box) bool {
+	return r.minX <= o.maxX && o.minX <= r.maxX && r.minY <= o.maxY && o.minY <= r.maxY
+}
+
+func (r box) contains(o box) bool {
+	return r.minX <= o.minX && o.maxX <= r.maxX && r.minY <= o.minY && o.maxY <= r.maxY
+}
+
+// quadItem is a segment of a tracked line within the tree.
+type quadItem struct {
+	tracker *quadTracker
+	offset  int
+	box     box
+	node    *quadNode
+}
+
+// Points returns the endpoints of the segment, or false if the segment is
+// not (or no longer) available.
+func (item *quadItem) Points() (a, b mgl.Vec3, ok bool) {
+	segment := *item.tracker.segment
+	i := item.offset - item.tracker.trimmed
+	if i < 0 || i+1 >= len(segment) {
+		return a, b, false
+	}
+	return segment[i], segment[i+1], true
+}
+
+// quadNode holds the segments which fit within its loose box but not within
+// any of its children. The loose box is the node's box grown by half of its
+// size on every side, so that small segments straddling the middle of a node
+// can still be pushed down into a child instead of piling up near the root.
+type quadNode struct {
+	box
+	loose    box
+	items    []*quadItem
+	children *[4]quadNode
+}
+
+func newQuadNode(r box) quadNode {
+	return quadNode{box: r, loose: r.grow((r.maxX - r.minX) / 2)}
+}
+
+func (node *quadNode) insert(item *quadItem, depth int) {
+	if node.children == nil && len(node.items) >= quadCapacity && depth < quadMaxDepth {
+		node.split(depth)
+	}
+	if node.children != nil {
+		// Pick the child by the center of the segment
+		x, y := (item.box.minX+item.box.maxX)/2, (item.box.minY+item.box.maxY)/2
+		for i := range node.children {
+			child := &node.children[i]
+			if child.minX <= x && x <= child.maxX && child.minY <= y && y <= child.maxY {
+				if child.loose.contains(item.box) {
+					child.insert(item, depth+1)
+					return
+				}
+				break
+			}
+		}
+	}
+	item.node = node
+	node.items = append(node.items, item)
+}
+
+func (node *quadNode) split(depth int) {
+	midX, midY := (node.minX+node.maxX)/2, (node.minY+node.maxY)/2
+	node.children = &[4]quadNode{
+		newQuadNode(box{node.minX, node.minY, midX, midY}),
+		newQuadNode(box{midX, node.minY, node.maxX, midY}),
+		newQuadNode(box{node.minX, midY, midX, node.maxY}),
+		newQuadNode(box{midX, midY, node.maxX, node.maxY}),
+	}
+
+	items := node.items
+	node.items = nil
+	for _, item := range items {
+		node.insert(item, depth)
+	}
+}
+
+func (node *quadNode) remove(item *quadItem) {
+	for i, other := range node.items {
+		if other == item {
+			last := len(node.items) - 1
+			node.items[i] = node.items[last]
+			node.items[last] = nil
+			node.items = node.items[:last]
+			break
+		}
+	}
+	item.node = nil
+}
+
+// query calls fn with every item whose box intersects r.
+func (node *quadNode) query(r box, fn func(*quadItem)) {
+	if !node.loose.intersects(r) {
+		return
+	}
+	for _, item := range node.items {
+		if item.box.intersects(r) {
+			fn(item)
+		}
+	}
+	if node.children != nil {
+		for i := range node.children {
+			node.children[i].query(r, fn)
+		}
+	}
+}
+
+// cells appends the box of every node which holds items.
+func (node *quadNode) cells(cells *[]Boundary) {
+	if len(node.items) > 0 {
+		*cells = append(*cells, Boundary{node.minX, node.minY, node.maxX, node.maxY})
+	}
+	if node.children != nil {
+		for i := range node.children {
+			node.children[i].cells(cells)
+		}
+	}
+}
+
+func (node *quadNode) write(w *bytes.Buffer, depth int) {
+	if len(node.items) == 0 && node.children == nil {
+		return
+	}
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%s[%v,%v -> %v,%v] %d segments\n", indent, node.minX, node.minY, node.maxX, node.maxY, len(node.items))
+	for _, item := range node.items {
+		a, b, _ := item.Points()
+		fmt.Fprintf(w, "%s  %d: %v -> %v\n", indent, item.tracker.id, a, b)
+	}
+	if node.children != nil {
+		for i := range node.children {
+			node.children[i].write(w, depth+1)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package collision
+
+import (
+	"fmt"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// RayHit is the result of a raycast against the boundary and tracked
+// segments.
+type RayHit struct {
+	// Distance from the origin of the ray to Point.
+	Distance float32
+	// Point where the ray hit.
+	Point mgl.Vec3
+
+	// Boundary is true when the ray hit the boundary, in which case Edge and
+	// Loop are set instead of ID and the segment.
+	Boundary bool
+	Edge     Edge
+	Loop     int
+
+	// Obstacle is true when the ray hit an obstacle, in which case ID is the
+	// index of the obstacle and the segment is its wall.
+	Obstacle bool
+
+	// ID of the tracked line that was hit.
+	ID int
+	// X0, Y0, X1, Y1 is the segment that was hit.
+	X0, Y0, X1, Y1 float32
+}
+
+func (hit *RayHit) String() string {
+	if hit.Boundary {
+		return fmt.Sprintf("<boundary edge %s at %v, %v away>", hit.Edge, hit.Point, hit.Distance)
+	}
+	if hit.Obstacle {
+		return fmt.Sprintf("<wall of obstacle %d: %v,%v -> %v,%v at %v, %v away>", hit.ID, hit.X0, hit.Y0, hit.X1, hit.Y1, hit.Point, hit.Distance)
+	}
+	return fmt.Sprintf("<segment of line %d: %v,%v -> %v,%v at %v, %v away>", hit.ID, hit.X0, hit.Y0, hit.X1, hit.Y1, hit.Point, hit.Distance)
+}
+
+// ray is a raycast query in the X/Z plane.
+type ray struct {
+	origin    mgl.Vec3
+	direction mgl.Vec3 // Unit length in the X/Z plane
+	maxDist   float32
+
+	// Height of the walls of tracked lines, and of the origin, which the
+	// ray passes over or under unless they overlap, see SetWallHeight.
+	height float32
+}
+
+func newRay(origin, direction mgl.Vec3, maxDist float32) (ray, bool) {
+	direction = mgl.Vec3{direction[0], 0, direction[2]}
+	l := direction.Len()
+	if l == 0 {
+		return ray{}, false
+	}
+	return ray{origin: origin, direction: direction.Mul(1 / l), maxDist: maxDist}, true
+}
+
+// end returns the point at maxDist along the ray.
+func (r ray) end() mgl.Vec3 {
+	return r.origin.Add(r.direction.Mul(r.maxDist))
+}
+
+// boundaryHit returns the hit of the ray against the boundary, if it's within
+// maxDist.
+func (r ray) boundaryHit(b boundary) *RayHit {
+	edge := b.crossing(r.origin, r.end(), 0)
+	if edge == nil {
+		return nil
+	}
+	return &RayHit{
+		Distance: edge.T * r.maxDist,
+		Point:    edge.Point,
+		Boundary: true,
+		Edge:     edge.Edge,
+		Loop:     edge.Loop,
+	}
+}
+
+// segmentHit returns the hit of the ray against segment a -> b of the
+// tracked line id, if it's within maxDist and their walls overlap.
+func (r ray) segmentHit(a, b mgl.Vec3, id int) *RayHit {
+	dist, ok := RaySegment2D(r.origin[0], r.origin[2], r.direction[0], r.direction[2], a[0], a[2], b[0], b[2])
+	if !ok || dist > r.maxDist {
+		return nil
+	}
+	point := r.origin.Add(r.direction.Mul(dist))
+	if !wallsOverlap(a, b, point, r.height) {
+		return nil
+	}
+	return &RayHit{
+		Distance: dist,
+		Point:    point,
+		ID:       id,
+		X0:       a[0],
+		Y0:       a[2],
+		X1:       b[0],
+		Y1:       b[2],
+	}
+}
+
+// capsuleHit is segmentHit for a segment which is radius thick.
+func (r ray) capsuleHit(a, b mgl.Vec3, radius float32, id int) *RayHit {
+	if radius <= 0 {
+		return r.segmentHit(a, b, id)
+	}
+	end := r.end()
+	t, ok := CapsuleIntersect2D(a[0], a[2], b[0], b[2], r.origin[0], r.origin[2], end[0], end[2], radius)
+	if !ok {
+		return nil
+	}
+	dist := t * r.maxDist
+	return &RayHit{
+		Distance: dist,
+		Point:    r.origin.Add(r.direction.Mul(dist)),
+		ID:       id,
+		X0:       a[0],
+		Y0:       a[2],
+		X1:       b[0],
+		Y1:       b[2],
+	}
+}
+
+// nearerHit returns whichever hit is nearer, ignoring nil hits.
+func nearerHit(a, b *RayHit) *RayHit {
+	if a == nil || (b != nil && b.Distance < a.Distance) {
+		return b
+	}
+	return a
+}
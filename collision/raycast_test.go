@@ -0,0 +1,106 @@
+package collision
+
+import (
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+func raycastTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	lines := [][]mgl.Vec3{
+		{{-5, 0, 0}, {5, 0, 0}},
+		{{2, 0, -5}, {2, 0, 5}, {-3, 0, 5}},
+		{{-8, 0, -8}, {-4, 0, -4}},
+	}
+	trackers := make([]Tracker, len(lines))
+	for i := range lines {
+		trackers[i] = collider.Track(&lines[i])
+	}
+	for i := range lines {
+		// Replay each line so that every segment is registered
+		points := lines[i]
+		for n := 1; n <= len(points); n++ {
+			lines[i] = points[:n]
+			trackers[i].Update()
+		}
+	}
+
+	tests := []struct {
+		name   string
+		hit    *RayHit
+		expect *RayHit
+	}{
+		{
+			"down onto a",
+			collider.Raycast(mgl.Vec3{-1, 0, -3}, mgl.Vec3{0, 0, 1}, 20),
+			&RayHit{Distance: 3, Point: mgl.Vec3{-1, 0, 0}, ID: trackers[0].ID()},
+		},
+		{
+			"too short",
+			collider.Raycast(mgl.Vec3{-1, 0, -3}, mgl.Vec3{0, 0, 1}, 2),
+			nil,
+		},
+		{
+			"b before a",
+			collider.Raycast(mgl.Vec3{6, 0, -1}, mgl.Vec3{-1, 0, 0}, 20),
+			&RayHit{Distance: 4, Point: mgl.Vec3{2, 0, -1}, ID: trackers[1].ID()},
+		},
+		{
+			"boundary",
+			collider.Raycast(mgl.Vec3{6, 0, 2}, mgl.Vec3{1, 0, 0}, 20),
+			&RayHit{Distance: 4, Point: mgl.Vec3{10, 0, 2}, Boundary: true, Edge: EdgeX2},
+		},
+		{
+			"diagonal onto c",
+			collider.Raycast(mgl.Vec3{-8, 0, -4}, mgl.Vec3{1, 0, -1}, 20),
+			&RayHit{Distance: 2 * 1.41421356, Point: mgl.Vec3{-6, 0, -6}, ID: trackers[2].ID()},
+		},
+		{
+			"collinear along a",
+			collider.Raycast(mgl.Vec3{-7, 0, 0}, mgl.Vec3{1, 0, 0}, 20),
+			&RayHit{Distance: 2, Point: mgl.Vec3{-5, 0, 0}, ID: trackers[0].ID()},
+		},
+		{
+			"ahead of b ignores its own head",
+			trackers[1].Raycast(mgl.Vec3{1, 0, 0}, 20),
+			&RayHit{Distance: 5, Point: mgl.Vec3{2, 0, 5}, ID: trackers[1].ID()},
+		},
+		{
+			"ahead of c",
+			trackers[2].Raycast(mgl.Vec3{1, 0, 1}, 20),
+			&RayHit{Distance: 4 * 1.41421356, Point: mgl.Vec3{0, 0, 0}, ID: trackers[0].ID()},
+		},
+	}
+
+	for _, test := range tests {
+		hit, expect := test.hit, test.expect
+		if expect == nil {
+			if hit != nil {
+				t.Errorf("%s: expected no hit; got %s", test.name, hit)
+			}
+			continue
+		}
+		if hit == nil {
+			t.Errorf("%s: expected %s; got no hit", test.name, expect)
+			continue
+		}
+		if !mgl.FloatEqualThreshold(hit.Distance, expect.Distance, 1e-5) || !vecNear(hit.Point, expect.Point) ||
+			hit.Boundary != expect.Boundary || hit.Edge != expect.Edge || hit.ID != expect.ID {
+			t.Errorf("%s: expected %s; got %s", test.name, expect, hit)
+		}
+	}
+}
+
+func TestGridRaycast(t *testing.T) {
+	raycastTester(t, GridCollider)
+}
+
+func TestLinearRaycast(t *testing.T) {
+	raycastTester(t, LinearCollider)
+}
+
+func TestQuadtreeRaycast(t *testing.T) {
+	raycastTester(t, QuadtreeCollider)
+}
@@ -0,0 +1,555 @@
+package collision
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// ErrSnapshot matches any error from Restore about data which isn't a
+// snapshot that fits the collider, when compared with errors.Is.
+var ErrSnapshot = errors.New("invalid snapshot")
+
+// Every snapshot starts with one of these, so that restoring one kind of
+// collider from another is caught.
+var (
+	gridSnapshot     = [4]byte{'L', 'R', 'C', 'g'}
+	linearSnapshot   = [4]byte{'L', 'R', 'C', 'l'}
+	quadtreeSnapshot = [4]byte{'L', 'R', 'C', 'q'}
+	chunkSnapshot    = [4]byte{'L', 'R', 'C', 'c'}
+)
+
+// snapshotWriter encodes snapshots in little endian, so that the same state
+// always produces the same bytes.
+type snapshotWriter struct {
+	bytes.Buffer
+}
+
+func (w *snapshotWriter) write(v interface{}) {
+	binary.Write(&w.Buffer, binary.LittleEndian, v)
+}
+
+func (w *snapshotWriter) int(v int) {
+	w.write(int64(v))
+}
+
+func (w *snapshotWriter) points(points []mgl.Vec3) {
+	w.int(len(points))
+	w.write(points)
+}
+
+// snapshotReader decodes what snapshotWriter encoded, keeping the first error
+// so that it only needs checking at the end.
+type snapshotReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func newSnapshotReader(data []byte, header [4]byte) *snapshotReader {
+	r := &snapshotReader{r: bytes.NewReader(data)}
+	var got [4]byte
+	if r.read(&got); r.err == nil && got != header {
+		r.fail("not a %s snapshot", header[3:])
+	}
+	return r
+}
+
+func (r *snapshotReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrSnapshot, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *snapshotReader) read(v interface{}) {
+	if r.err != nil {
+		return
+	}
+	if err := binary.Read(r.r, binary.LittleEndian, v); err != nil {
+		r.fail("%s", err)
+	}
+}
+
+func (r *snapshotReader) int() int {
+	var v int64
+	r.read(&v)
+	return int(v)
+}
+
+// count reads a number of things which are at least size bytes each, and
+// fails if there aren't enough bytes left for them.
+func (r *snapshotReader) count(size int) int {
+	n := r.int()
+	if n < 0 || n > r.r.Len()/size {
+		r.fail("%d items of %d bytes, with %d bytes left", n, size, r.r.Len())
+		return 0
+	}
+	return n
+}
+
+func (r *snapshotReader) points() []mgl.Vec3 {
+	points := make([]mgl.Vec3, r.count(12))
+	r.read(points)
+	return points
+}
+
+// id reads the ID of one of n lines.
+func (r *snapshotReader) id(n int) int {
+	id := r.int()
+	if id < 0 || id >= n {
+		r.fail("no line %d", id)
+		return 0
+	}
+	return id
+}
+
+// done fails unless everything was read.
+func (r *snapshotReader) done() error {
+	if r.err == nil && r.r.Len() > 0 {
+		r.fail("%d bytes left over", r.r.Len())
+	}
+	return r.err
+}
+
+// tracked checks that the collider tracked at least n lines since it was
+// reset, so that the lines in a snapshot have somewhere to go.
+func (r *snapshotReader) tracked(n, tracked int) {
+	if n > tracked {
+		r.fail("%d lines, but only %d are tracked", n, tracked)
+	}
+}
+
+// lineSnapshot is the state of a tracked line that every collider keeps.
+type lineSnapshot struct {
+	closed  bool
+	radius  float32
+	trimmed int
+	points  []mgl.Vec3
+}
+
+func (w *snapshotWriter) line(closed bool, radius float32, trimmed int, segment []mgl.Vec3) {
+	w.write(closed)
+	if closed {
+		return
+	}
+	w.write(radius)
+	w.int(trimmed)
+	w.points(segment)
+}
+
+func (r *snapshotReader) line() lineSnapshot {
+	var line lineSnapshot
+	if r.read(&line.closed); line.closed {
+		return line
+	}
+	r.read(&line.radius)
+	if line.trimmed = r.int(); line.trimmed < 0 {
+		r.fail("%d points trimmed", line.trimmed)
+	}
+	line.points = r.points()
+	return line
+}
+
+func (w *snapshotWriter) cellSegments(segments []cellSegment) {
+	w.int(len(segments))
+	for _, cs := range segments {
+		w.int(cs.tracker.id)
+		w.int(cs.offset)
+	}
+}
+
+// cellSegments reads references to segments of n lines, which are resolved
+// to trackers once they're all known. Lines which were untracked since they
+// were found near another are still referenced.
+func (r *snapshotReader) cellSegments(n int) []cellSnapshot {
+	segments := make([]cellSnapshot, r.count(16))
+	for i := range segments {
+		segments[i] = cellSnapshot{id: r.id(n), offset: r.int()}
+	}
+	return segments
+}
+
+type cellSnapshot struct {
+	id, offset int
+}
+
+func resolveCells(segments []cellSnapshot, trackers []*gridTracker) []cellSegment {
+	if len(segments) == 0 {
+		return nil
+	}
+	resolved := make([]cellSegment, len(segments))
+	for i, cs := range segments {
+		resolved[i] = cellSegment{trackers[cs.id], cs.offset}
+	}
+	return resolved
+}
+
+func (grid *gridCollider) Snapshot() []byte {
+	w := &snapshotWriter{}
+	w.write(gridSnapshot)
+	w.write(grid.bounds)
+	w.write(grid.cellSize)
+	w.int(grid.numTracked)
+	for _, tracker := range grid.tracked {
+		w.line(tracker.closed, tracker.radius, tracker.trimmed, *tracker.segment)
+		if tracker.closed {
+			continue
+		}
+		w.int(tracker.cellIdx)
+		w.int(tracker.offset)
+		w.write(tracker.start)
+		w.write(tracker.end)
+		w.write(tracker.drift)
+		w.cellSegments(tracker.near)
+		w.cellSegments(tracker.pending)
+	}
+
+	var cells int
+	grid.cells.Each(func(idx int, cell gridCell) { cells++ })
+	w.int(cells)
+	grid.cells.Each(func(idx int, cell gridCell) {
+		w.int(idx)
+		w.cellSegments(cell)
+	})
+	return w.Bytes()
+}
+
+func (grid *gridCollider) Restore(data []byte) error {
+	r := newSnapshotReader(data, gridSnapshot)
+	var bounds Boundary
+	var cellSize float32
+	r.read(&bounds)
+	r.read(&cellSize)
+	if r.err == nil && (bounds != grid.bounds || cellSize != grid.cellSize) {
+		r.fail("grid of %v in cells of %v, not %v in cells of %v", bounds, cellSize, grid.bounds, grid.cellSize)
+	}
+
+	type state struct {
+		line            lineSnapshot
+		cellIdx, offset int
+		start, end      mgl.Vec3
+		drift           float32
+		near, pending   []cellSnapshot
+	}
+	n := r.count(1)
+	r.tracked(n, len(grid.tracked))
+	lines := make([]state, n)
+	for i := range lines {
+		line := &lines[i]
+		if line.line = r.line(); line.line.closed {
+			continue
+		}
+		line.cellIdx = r.int()
+		line.offset = r.int()
+		r.read(&line.start)
+		r.read(&line.end)
+		r.read(&line.drift)
+		line.near = r.cellSegments(n)
+		line.pending = r.cellSegments(n)
+	}
+	cells := make(map[int][]cellSnapshot)
+	order := make([]int, r.count(16))
+	for i := range order {
+		idx := r.int()
+		if _, ok := cells[idx]; r.err == nil && (ok || idx < 0 || idx >= grid.width*grid.height) {
+			r.fail("cell %d is repeated or outside the grid", idx)
+		}
+		order[i] = idx
+		cells[idx] = r.cellSegments(n)
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+
+	// Lines tracked since the snapshot are forgotten, so that tracking them
+	// again gets the same IDs
+	for _, tracker := range grid.tracked[n:] {
+		tracker.closed = true
+		tracker.near, tracker.pending = nil, nil
+	}
+	grid.tracked = grid.tracked[:n]
+	grid.numTracked = n
+
+	trackers := grid.tracked
+	for i, line := range lines {
+		tracker := trackers[i]
+		tracker.closed = line.line.closed
+		if tracker.closed {
+			tracker.near, tracker.pending = nil, nil
+			continue
+		}
+		tracker.radius = line.line.radius
+		tracker.trimmed = line.line.trimmed
+		*tracker.segment = line.line.points
+		tracker.committed()
+		tracker.cellIdx, tracker.offset = line.cellIdx, line.offset
+		tracker.start, tracker.end = line.start, line.end
+		tracker.drift = line.drift
+		tracker.near = resolveCells(line.near, trackers)
+		tracker.pending = resolveCells(line.pending, trackers)
+	}
+
+	if grid.sparse {
+		grid.cells = sparseCells{}
+	} else {
+		grid.cells = make(denseCells, grid.width*grid.height)
+	}
+	for _, idx := range order {
+		*grid.cells.Cell(idx) = resolveCells(cells[idx], trackers)
+	}
+	return nil
+}
+
+func (collider *linearCollider) Snapshot() []byte {
+	w := &snapshotWriter{}
+	w.write(linearSnapshot)
+	w.int(collider.numTracked)
+	for _, tracker := range collider.tracked {
+		w.line(tracker.closed, tracker.radius, 0, *tracker.segment)
+	}
+	return w.Bytes()
+}
+
+func (collider *linearCollider) Restore(data []byte) error {
+	r := newSnapshotReader(data, linearSnapshot)
+	n := r.count(1)
+	r.tracked(n, len(collider.tracked))
+	lines := make([]lineSnapshot, n)
+	for i := range lines {
+		lines[i] = r.line()
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+
+	for _, tracker := range collider.tracked[n:] {
+		tracker.closed = true
+	}
+	collider.tracked = collider.tracked[:n]
+	collider.numTracked = n
+
+	collider.trackers = []*linearTracker{}
+	for i, line := range lines {
+		tracker := collider.tracked[i]
+		tracker.closed = line.closed
+		if tracker.closed {
+			continue
+		}
+		tracker.radius = line.radius
+		*tracker.segment = line.points
+		tracker.committed()
+		collider.trackers = append(collider.trackers, tracker)
+	}
+	return nil
+}
+
+func (tree *quadtreeCollider) Snapshot() []byte {
+	w := &snapshotWriter{}
+	w.write(quadtreeSnapshot)
+	w.write(tree.bounds)
+	w.int(tree.numTracked)
+	for _, tracker := range tree.tracked {
+		w.line(tracker.closed, tracker.radius, tracker.trimmed, *tracker.segment)
+		if tracker.closed {
+			continue
+		}
+		// Only the head's box can differ from its points
+		if head := tracker.head; head != nil {
+			w.int(head.offset)
+			w.write([4]float32{head.box.minX, head.box.minY, head.box.maxX, head.box.maxY})
+		} else {
+			w.int(-1)
+		}
+	}
+	return w.Bytes()
+}
+
+func (tree *quadtreeCollider) Restore(data []byte) error {
+	r := newSnapshotReader(data, quadtreeSnapshot)
+	var bounds Boundary
+	r.read(&bounds)
+	if r.err == nil && bounds != tree.bounds {
+		r.fail("tree of %v, not %v", bounds, tree.bounds)
+	}
+
+	type state struct {
+		line lineSnapshot
+		head int
+		box  [4]float32
+	}
+	n := r.count(1)
+	r.tracked(n, len(tree.tracked))
+	lines := make([]state, n)
+	for i := range lines {
+		line := &lines[i]
+		if line.line = r.line(); line.line.closed {
+			continue
+		}
+		if line.head = r.int(); line.head >= 0 {
+			r.read(&line.box)
+		}
+		if r.err == nil && line.head >= 0 && (line.head < line.line.trimmed || line.head-line.line.trimmed+1 >= len(line.line.points)) {
+			r.fail("head %d of line %d is outside of it", line.head, i)
+		}
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+
+	for _, tracker := range tree.tracked[n:] {
+		tracker.closed = true
+		tracker.head = nil
+	}
+	tree.tracked = tree.tracked[:n]
+	tree.numTracked = n
+
+	// The tree is rebuilt from scratch, which may split it differently but
+	// holds the same items
+	root := newQuadNode(box{tree.bounds.X1, tree.bounds.Y1, tree.bounds.X2, tree.bounds.Y2})
+	tree.root = &root
+	for i, line := range lines {
+		tracker := tree.tracked[i]
+		tracker.closed = line.line.closed
+		tracker.head = nil
+		if tracker.closed {
+			continue
+		}
+		tracker.radius = line.line.radius
+		tracker.trimmed = line.line.trimmed
+		*tracker.segment = line.line.points
+		tracker.committed()
+		for offset := tracker.trimmed; offset <= line.head; offset++ {
+			item := &quadItem{tracker: tracker, offset: offset}
+			a, b, _ := item.Points()
+			if isGap(a, b) {
+				continue
+			}
+			if offset == line.head {
+				item.box = box{line.box[0], line.box[1], line.box[2], line.box[3]}
+				tracker.head = item
+			} else {
+				item.box = segmentBox(a, b).grow(tracker.radius)
+			}
+			tree.root.insert(item, 0)
+		}
+	}
+	return nil
+}
+
+func (collider *chunkCollider) Snapshot() []byte {
+	w := &snapshotWriter{}
+	w.write(chunkSnapshot)
+	w.write(collider.opts.Size)
+	w.int(collider.opts.Keep)
+	w.int(collider.numTracked)
+	for _, tracker := range collider.tracked {
+		w.line(tracker.closed, tracker.radius, tracker.trimmed, *tracker.segment)
+		if !tracker.closed {
+			w.int(tracker.head)
+		}
+	}
+
+	w.write(collider.kept != nil)
+	w.int(len(collider.kept))
+	for _, r := range collider.kept {
+		w.write([4]int64{int64(r.Min.X), int64(r.Min.Y), int64(r.Max.X), int64(r.Max.Y)})
+	}
+
+	keys := collider.sorted()
+	w.int(len(keys))
+	for _, p := range keys {
+		w.int(p.X)
+		w.int(p.Y)
+		c := *collider.chunks[p]
+		w.int(len(c))
+		for _, cs := range c {
+			w.int(cs.tracker.id)
+			w.int(cs.offset)
+		}
+	}
+	return w.Bytes()
+}
+
+func (collider *chunkCollider) Restore(data []byte) error {
+	r := newSnapshotReader(data, chunkSnapshot)
+	var size float32
+	r.read(&size)
+	keep := r.int()
+	if r.err == nil && (size != collider.opts.Size || keep != collider.opts.Keep) {
+		r.fail("chunks of %v kept %d around, not %v kept %d around", size, keep, collider.opts.Size, collider.opts.Keep)
+	}
+
+	type state struct {
+		line lineSnapshot
+		head int
+	}
+	n := r.count(1)
+	r.tracked(n, len(collider.tracked))
+	lines := make([]state, n)
+	for i := range lines {
+		line := &lines[i]
+		if line.line = r.line(); !line.line.closed {
+			line.head = r.int()
+		}
+	}
+	var hasKept bool
+	r.read(&hasKept)
+	kept := make([]image.Rectangle, r.count(32))
+	for i := range kept {
+		var v [4]int64
+		r.read(&v)
+		kept[i] = image.Rectangle{Min: image.Pt(int(v[0]), int(v[1])), Max: image.Pt(int(v[2]), int(v[3]))}
+	}
+	if !hasKept {
+		kept = nil
+	}
+	chunks := make(map[image.Point][]cellSnapshot)
+	order := make([]image.Point, r.count(24))
+	for i := range order {
+		p := image.Pt(r.int(), r.int())
+		if _, ok := chunks[p]; r.err == nil && ok {
+			r.fail("chunk %v is repeated", p)
+		}
+		order[i] = p
+		chunks[p] = r.cellSegments(n)
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+
+	for _, tracker := range collider.tracked[n:] {
+		tracker.closed = true
+		tracker.head = -1
+	}
+	collider.tracked = collider.tracked[:n]
+	collider.numTracked = n
+
+	trackers := collider.tracked
+	for i, line := range lines {
+		tracker := trackers[i]
+		tracker.closed = line.line.closed
+		tracker.head = -1
+		if tracker.closed {
+			continue
+		}
+		tracker.radius = line.line.radius
+		tracker.trimmed = line.line.trimmed
+		tracker.head = line.head
+		*tracker.segment = line.line.points
+		tracker.committed()
+	}
+
+	collider.chunks = make(map[image.Point]*chunk, len(order))
+	collider.kept = kept
+	for _, p := range order {
+		c := make(chunk, len(chunks[p]))
+		for i, cs := range chunks[p] {
+			c[i] = chunkSegment{trackers[cs.id], cs.offset}
+		}
+		collider.chunks[p] = &c
+	}
+	return nil
+}
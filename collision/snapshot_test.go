@@ -0,0 +1,172 @@
+package collision
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// snapshotGame moves a few lines around an arena at random, for checking that
+// the same moves after restoring a snapshot go the same way as before.
+type snapshotGame struct {
+	collider Collider
+	segments []*[]mgl.Vec3
+	trackers []Tracker
+	closed   []bool
+	log      []string
+}
+
+func newSnapshotGame(collider Collider, lines int) *snapshotGame {
+	game := &snapshotGame{collider: collider}
+	for i := 0; i < lines; i++ {
+		game.track(mgl.Vec3{float32(i*4 - 6), 0, float32(i%2*4 - 2)}, float32(i%3)*0.1)
+	}
+	return game
+}
+
+func (game *snapshotGame) track(start mgl.Vec3, radius float32) {
+	segment := &[]mgl.Vec3{start}
+	game.segments = append(game.segments, segment)
+	game.trackers = append(game.trackers, game.collider.TrackRadius(segment, radius))
+	game.closed = append(game.closed, false)
+}
+
+// play makes n moves chosen by rng, and logs what every update returned.
+// Lines which were closed stay where they are.
+func (game *snapshotGame) play(rng *rand.Rand, n int) {
+	for move := 0; move < n; move++ {
+		i, action, heading, turn := rng.Intn(len(game.trackers)), rng.Intn(40), rng.Float64()*2*math.Pi, rng.Intn(3) == 0
+		if game.closed[i] {
+			continue
+		}
+		segment, tracker := game.segments[i], game.trackers[i]
+		switch action {
+		case 0:
+			tracker.Trim(1)
+		case 1:
+			tracker.Close()
+			game.closed[i] = true
+			continue
+		}
+
+		head := (*segment)[len(*segment)-1]
+		next := mgl.Vec3{head[0] + float32(math.Cos(heading)), 0, head[2] + float32(math.Sin(heading))}
+		if len(*segment) < 2 || turn {
+			*segment = append(*segment, next)
+		} else {
+			(*segment)[len(*segment)-1] = next
+		}
+		err := tracker.Update()
+		game.log = append(game.log, fmt.Sprintf("%d: %v %v", tracker.ID(), err, tracker.Near(1)))
+	}
+}
+
+func snapshotTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	bounds := image.Rect(-10, -10, 10, 10)
+	for seed := int64(0); seed < 20; seed++ {
+		game := newSnapshotGame(newCollider(bounds), 4)
+		game.play(rand.New(rand.NewSource(seed)), 50)
+		snapshot := game.collider.Snapshot()
+		closed := append([]bool{}, game.closed...)
+
+		// Carry on, with a line that joins later
+		game.log = nil
+		game.track(mgl.Vec3{0, 0, 0}, 0)
+		game.play(rand.New(rand.NewSource(seed+100)), 50)
+		expected := game.log
+		after := game.collider.Snapshot()
+
+		if err := game.collider.Restore(snapshot); err != nil {
+			t.Fatalf("seed %d: expected to restore; got %s", seed, err)
+		}
+		if restored := game.collider.Snapshot(); !bytes.Equal(restored, snapshot) {
+			t.Fatalf("seed %d: expected the same snapshot after restoring it", seed)
+		}
+		game.log = nil
+		game.segments, game.trackers, game.closed = game.segments[:4], game.trackers[:4], append([]bool{}, closed...)
+		game.track(mgl.Vec3{0, 0, 0}, 0)
+		game.play(rand.New(rand.NewSource(seed+100)), 50)
+		if fmt.Sprint(game.log) != fmt.Sprint(expected) {
+			t.Errorf("seed %d: expected the same moves after restoring\n\texpected %v\n\tgot      %v", seed, expected, game.log)
+		}
+		if !bytes.Equal(game.collider.Snapshot(), after) {
+			t.Errorf("seed %d: expected the same snapshot after the same moves", seed)
+		}
+
+		// Restoring into a new collider which tracked the same lines
+		fresh := newSnapshotGame(newCollider(bounds), 4)
+		copy(fresh.closed, closed)
+		if err := fresh.collider.Restore(snapshot); err != nil {
+			t.Fatalf("seed %d: expected to restore into a new collider; got %s", seed, err)
+		}
+		fresh.track(mgl.Vec3{0, 0, 0}, 0)
+		fresh.play(rand.New(rand.NewSource(seed+100)), 50)
+		if fmt.Sprint(fresh.log) != fmt.Sprint(expected) {
+			t.Errorf("seed %d: expected the same moves in a new collider\n\texpected %v\n\tgot      %v", seed, expected, fresh.log)
+		}
+	}
+
+	// Nothing changes when restoring fails
+	game := newSnapshotGame(newCollider(bounds), 2)
+	game.play(rand.New(rand.NewSource(1)), 20)
+	snapshot := game.collider.Snapshot()
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"truncated": snapshot[:len(snapshot)-1],
+		"trailing":  append(append([]byte{}, snapshot...), 0),
+		"other":     LinearCollider(bounds).Snapshot(),
+		"too many":  newSnapshotGame(newCollider(bounds), 3).collider.Snapshot(),
+	} {
+		if _, ok := game.collider.(*linearCollider); ok && name == "other" {
+			data = QuadtreeCollider(bounds).Snapshot()
+		}
+		if err := game.collider.Restore(data); !errors.Is(err, ErrSnapshot) {
+			t.Errorf("%s: expected invalid snapshot; got %v", name, err)
+		}
+		if !bytes.Equal(game.collider.Snapshot(), snapshot) {
+			t.Errorf("%s: expected nothing to change after failing to restore", name)
+		}
+	}
+
+	// Corrupted snapshots either restore or fail, without panicking
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 2000; i++ {
+		data := append([]byte{}, snapshot...)
+		for edits := 1 + rng.Intn(4); edits > 0; edits-- {
+			data[rng.Intn(len(data))] = byte(rng.Intn(256))
+		}
+		if err := game.collider.Restore(data); err != nil {
+			if !errors.Is(err, ErrSnapshot) {
+				t.Fatalf("edit %d: expected invalid snapshot; got %v", i, err)
+			}
+			continue
+		}
+		if err := game.collider.Restore(snapshot); err != nil {
+			t.Fatalf("edit %d: expected to restore the original; got %s", i, err)
+		}
+	}
+}
+
+func TestGridSnapshot(t *testing.T) {
+	snapshotTester(t, GridCollider)
+}
+
+func TestSparseGridSnapshot(t *testing.T) {
+	snapshotTester(t, func(bounds image.Rectangle) Collider {
+		return NewGridCollider(bounds, GridOptions{CellSize: 0.5, Sparse: true})
+	})
+}
+
+func TestLinearSnapshot(t *testing.T) {
+	snapshotTester(t, LinearCollider)
+}
+
+func TestQuadtreeSnapshot(t *testing.T) {
+	snapshotTester(t, QuadtreeCollider)
+}
@@ -0,0 +1,164 @@
+package collision
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// thick tracks every line with the same radius.
+type thick struct {
+	Collider
+	radius float32
+}
+
+func (c thick) Track(segment *[]mgl.Vec3) Tracker {
+	return c.TrackRadius(segment, c.radius)
+}
+
+func thickTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	tests := []struct {
+		name     string
+		radii    [2]float32
+		lines    [2][]mgl.Vec3
+		collides bool
+	}{
+		{
+			"Passing within both radii",
+			[2]float32{0.3, 0.3},
+			[2][]mgl.Vec3{{{-5, 0, 0}, {5, 0, 0}}, {{-5, 0, 0.5}, {5, 0, 0.5}}},
+			true,
+		},
+		{
+			"Passing beyond both radii",
+			[2]float32{0.2, 0.2},
+			[2][]mgl.Vec3{{{-5, 0, 0}, {5, 0, 0}}, {{-5, 0, 0.5}, {5, 0, 0.5}}},
+			false,
+		},
+		{
+			"Only one is thick",
+			[2]float32{0, 0.6},
+			[2][]mgl.Vec3{{{-5, 0, 0}, {5, 0, 0}}, {{-5, 0, 0.5}, {5, 0, 0.5}}},
+			true,
+		},
+		{
+			"Stopping short of the end",
+			[2]float32{0.25, 0.25},
+			[2][]mgl.Vec3{{{0, 0, -5}, {0, 0, 5}}, {{-5, 0, 3}, {-0.6, 0, 3}}},
+			false,
+		},
+		{
+			"Reaching the end",
+			[2]float32{0.25, 0.25},
+			[2][]mgl.Vec3{{{0, 0, -5}, {0, 0, 5}}, {{-5, 0, 3}, {-0.4, 0, 3}}},
+			true,
+		},
+		{
+			"Squeezing through a gap",
+			[2]float32{0.1, 0.1},
+			[2][]mgl.Vec3{{{0, 0, -5}, {0, 0, 0}, {0.3, 0, 0}, {0.3, 0, -5}}, {{0.15, 0, -8}, {0.15, 0, -2}}},
+			true,
+		},
+		{
+			"Along the boundary",
+			[2]float32{0.5, 0.5},
+			[2][]mgl.Vec3{{{-5, 0, 5}, {-5, 0, 0}}, {{-9.7, 0, -5}, {-9.7, 0, 5}}},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		collider := newCollider(image.Rect(-10, -10, 10, 10))
+		lines := test.lines
+		var err error
+		for i := range lines {
+			tracker := collider.TrackRadius(&lines[i], test.radii[i])
+			points := lines[i]
+			for n := 1; n <= len(points); n++ {
+				lines[i] = points[:n]
+				err = tracker.Update()
+			}
+		}
+		if (err != nil) != test.collides {
+			t.Errorf("%s: expected collision=%v; got %v", test.name, test.collides, err)
+		}
+	}
+}
+
+// thickSelfTester turns a thick line by the same angle every step, which only
+// collides with its own trail once it turns back tighter than it is wide.
+func thickSelfTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	for _, test := range []struct {
+		turn     float64
+		collides bool
+	}{
+		{0.05, false},
+		{1.2, true},
+	} {
+		collider := newCollider(image.Rect(-10, -10, 10, 10))
+		segment := []mgl.Vec3{{0, 0, 0}}
+		tracker := collider.TrackRadius(&segment, 0.2)
+
+		var heading float64
+		var err error
+		for i := 0; i < 12 && err == nil; i++ {
+			heading += test.turn
+			head := segment[len(segment)-1]
+			segment = append(segment, head.Add(mgl.Vec3{float32(math.Cos(heading)) * 0.2, 0, float32(math.Sin(heading)) * 0.2}))
+			err = tracker.Update()
+		}
+		if (err != nil) != test.collides {
+			t.Errorf("turning by %v: expected collision=%v; got %v", test.turn, test.collides, err)
+		}
+	}
+}
+
+func TestGridThick(t *testing.T) {
+	thickTester(t, GridCollider)
+	thickSelfTester(t, GridCollider)
+	for _, variant := range gridVariants {
+		opts := variant.opts
+		newCollider := func(bounds image.Rectangle) Collider { return NewGridCollider(bounds, opts) }
+		thickTester(t, newCollider)
+		thickSelfTester(t, newCollider)
+	}
+}
+
+func TestLinearThick(t *testing.T) {
+	thickTester(t, LinearCollider)
+	thickSelfTester(t, LinearCollider)
+}
+
+func TestQuadtreeThick(t *testing.T) {
+	thickTester(t, QuadtreeCollider)
+	thickSelfTester(t, QuadtreeCollider)
+}
+
+// TestThickGridLinear is TestGridLinear with thick lines.
+func TestThickGridLinear(t *testing.T) {
+	n := 1000
+	if testing.Short() {
+		n = 100
+	}
+	bounds := image.Rect(-10, -10, 10, 10)
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < n; i++ {
+		data := make([]byte, 3*(1+rng.Intn(100)))
+		rng.Read(data)
+		radius := float32(rng.Intn(4)) / 10
+		colliders := []Collider{
+			thick{LinearCollider(bounds), radius},
+			thick{GridCollider(bounds), radius},
+			thick{NewGridCollider(bounds, GridOptions{CellSize: 0.3}), radius},
+			thick{fullWalkGrid(bounds, GridOptions{}), radius},
+			thick{QuadtreeCollider(bounds), radius},
+		}
+		if err := replayMoves(data, colliders...); err != nil {
+			attachPictures(t, colliders...)
+			t.Fatalf("radius %v: %s\n\tdata: %v", radius, err, data)
+		}
+	}
+}
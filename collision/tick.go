@@ -0,0 +1,337 @@
+package collision
+
+import (
+	"fmt"
+	"sort"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// TickRule decides what happens to lines whose heads run into each other
+// while they're updated in the same tick, see Collider.UpdateTick.
+type TickRule int
+
+const (
+	// TickCrashBoth crashes both lines where they met.
+	TickCrashBoth TickRule = iota
+	// TickCrashFirst only crashes the line whose time of impact, as a
+	// fraction of how far it moved in the tick, came first. The other
+	// carries on. Both crash if they're the same.
+	TickCrashFirst
+	// TickDraw crashes both lines where they met, but neither of them loses,
+	// see CollisionHeadOn.Draw.
+	TickDraw
+)
+
+func (rule TickRule) String() string {
+	switch rule {
+	case TickCrashBoth:
+		return "crash both"
+	case TickCrashFirst:
+		return "crash first"
+	case TickDraw:
+		return "draw"
+	}
+	return fmt.Sprintf("TickRule(%d)", int(rule))
+}
+
+// CollisionHeadOn is returned by Collider.UpdateTick for a line whose head ran
+// into the head of another line that was updated in the same tick.
+type CollisionHeadOn struct {
+	Collision
+
+	// ID of the other line.
+	ID int
+	// OtherT is where the lines met as a fraction along the head segment of
+	// the other line.
+	OtherT float32
+	// Draw is true when the rule was TickDraw, so that neither line lost.
+	Draw bool
+}
+
+func (err *CollisionHeadOn) Error() string {
+	if err.Draw {
+		return fmt.Sprintf("draw with line %d at %v", err.ID, err.Point)
+	}
+	return fmt.Sprintf("head-on collision with line %d at %v", err.ID, err.Point)
+}
+
+// ticker is a Tracker which can be updated by Collider.UpdateTick.
+type ticker interface {
+	Tracker
+	// tick sets whether the tracker is being updated in a tick, so that the
+	// others in the tick don't collide with its head until it's resolved.
+	tick(ticking bool)
+	// headSegment returns the head segment, its offset within the line and how
+	// thick it is, or false if it has none.
+	headSegment() (p0, p1 mgl.Vec3, offset int, radius float32, ok bool)
+	// tickFrom returns how far along the head segment the line was before
+	// it moved this tick, as a fraction of it.
+	tickFrom(p0, p1 mgl.Vec3) float32
+}
+
+// headOf returns the head segment of a line and its offset, or false if it
+// has none. A Break leaves a line without a head until the point after it,
+// whether it wrapped around or left a gap.
+func headOf(segment []mgl.Vec3, closed bool) (p0, p1 mgl.Vec3, offset int, ok bool) {
+	n := len(segment)
+	if closed || n < 2 || isGap(segment[n-2], segment[n-1]) {
+		return p0, p1, 0, false
+	}
+	return segment[n-2], segment[n-1], n - 2, true
+}
+
+// trackedLine is embedded in the trackers of every collider, for what they
+// all keep about their line and how it takes part in a tick.
+type trackedLine struct {
+	// Collider which tracks the line.
+	owner   Collider
+	segment *[]mgl.Vec3
+	id      int
+	radius  float32
+	closed  bool
+
+	// Whether it's being updated in a tick, see Collider.UpdateTick.
+	ticking bool
+	// Last point of the line when it was last updated, which is where its
+	// head carries on from in the next tick, or a Break until it's updated.
+	last mgl.Vec3
+}
+
+func newTrackedLine(owner Collider, segment *[]mgl.Vec3, id int, radius float32) trackedLine {
+	return trackedLine{owner: owner, segment: segment, id: id, radius: radius, last: Break}
+}
+
+// committed notes the last point of the line, once it's been updated.
+func (line *trackedLine) committed() {
+	if segment := *line.segment; len(segment) > 0 {
+		line.last = segment[len(segment)-1]
+	}
+}
+
+// tickFrom is where the last update left off along the head, since heads are
+// stretched over straight runs, or the start of a new head.
+func (line *trackedLine) tickFrom(p0, p1 mgl.Vec3) float32 {
+	d := p1.Sub(p0)
+	l := d[0]*d[0] + d[2]*d[2]
+	if l == 0 || IsBreak(line.last) {
+		return 0
+	}
+	from := line.last.Sub(p0)
+	return minf(maxf((from[0]*d[0]+from[2]*d[2])/l, 0), 1)
+}
+
+func (line *trackedLine) ID() int {
+	return line.id
+}
+
+func (line *trackedLine) tick(ticking bool) {
+	line.ticking = ticking
+}
+
+func (line *trackedLine) headSegment() (p0, p1 mgl.Vec3, offset int, radius float32, ok bool) {
+	p0, p1, offset, ok = headOf(*line.segment, line.closed)
+	return p0, p1, offset, line.radius, ok
+}
+
+// tickHead returns whether offset is the head segment while the line is being
+// updated in a tick, which others don't collide with until it's resolved.
+func (line *trackedLine) tickHead(offset int) bool {
+	return line.ticking && offset == len(*line.segment)-2
+}
+
+func (line *trackedLine) trackedBy() Collider {
+	return line.owner
+}
+
+// owned is a tracker which embeds trackedLine, so it can be updated by
+// updateAll and updateTick.
+type owned interface {
+	phased
+	ticker
+	trackedBy() Collider
+}
+
+// owns returns t if it's one of the trackers of c.
+func owns(c Collider, t Tracker) (owned, bool) {
+	tracker, ok := t.(owned)
+	return tracker, ok && tracker.trackedBy() == c
+}
+
+// meeting is where the heads of lines i and j in a tick ran into each other,
+// with the collision of each of them, if it ran into the other, and the time
+// of impact of each of them. Where it's on the part of a head from before the
+// tick, the other line ran into a trail instead.
+type meeting struct {
+	i, j           int
+	ci, cj         *CollisionSegment
+	ti, tj         float32
+	trailI, trailJ bool
+}
+
+// updateTick updates trackers with UpdateAll, without the trackers of c
+// colliding with each other's heads, and then resolves where their heads ran
+// into each other by rule, in order of the time of impact. Heads are
+// stretched over straight runs, so running into the part of one from before
+// the tick is running into its trail, whatever the rule. Events are sent once
+// everything is resolved.
+func updateTick(c Collider, h *hooks, height float32, fixed bool, trackers []Tracker, rule TickRule) []error {
+	type head struct {
+		tracker ticker
+		p0, p1  mgl.Vec3
+		offset  int
+		radius  float32
+		// Fraction of the head where it was before the tick.
+		from float32
+	}
+	heads := make([]*head, len(trackers))
+	owned := make([]bool, len(trackers))
+	for i, t := range trackers {
+		tracker, ok := owns(c, t)
+		if !ok {
+			continue
+		}
+		owned[i] = true
+		tracker.tick(true)
+		defer tracker.tick(false)
+		if p0, p1, offset, radius, ok := tracker.headSegment(); ok {
+			heads[i] = &head{tracker, p0, p1, offset, radius, tracker.tickFrom(p0, p1)}
+		}
+	}
+
+	h.muted = true
+	errs := c.UpdateAll(trackers)
+	h.muted = false
+
+	// Where each line stopped along its head, beyond the end if it didn't
+	stop := make([]float32, len(trackers))
+	for i, err := range errs {
+		stop[i] = 2
+		if impact, ok := Impact(err); ok {
+			stop[i] = impact.T
+		}
+	}
+
+	var meetings []meeting
+	for i, a := range heads {
+		for j := i + 1; j < len(heads); j++ {
+			b := heads[j]
+			if a == nil || b == nil || a.tracker == b.tracker {
+				continue
+			}
+			r := a.radius + b.radius
+			m := meeting{
+				i:  i,
+				j:  j,
+				ci: segmentCollision(b.p0, b.p1, a.p0, a.p1, r, height, fixed, b.tracker.ID(), b.offset, false),
+				cj: segmentCollision(a.p0, a.p1, b.p0, b.p1, r, height, fixed, a.tracker.ID(), a.offset, false),
+			}
+			switch {
+			case m.ci != nil && m.cj != nil:
+				m.ti, m.tj = m.ci.T, m.cj.T
+			case m.ci != nil:
+				// Only i ran into j, where j was at the nearest point to it
+				m.ti = m.ci.T
+				_, m.tj = PointSegmentDistance2D(m.ci.Point[0], m.ci.Point[2], b.p0[0], b.p0[2], b.p1[0], b.p1[2])
+			case m.cj != nil:
+				m.tj = m.cj.T
+				_, m.ti = PointSegmentDistance2D(m.cj.Point[0], m.cj.Point[2], a.p0[0], a.p0[2], a.p1[0], a.p1[2])
+			default:
+				continue
+			}
+			m.trailI, m.trailJ = m.tj < b.from, m.ti < a.from
+			meetings = append(meetings, m)
+		}
+	}
+	// Times of impact only count what the lines moved in this tick, since
+	// the rest of their heads is where they were before it
+	toi := func(i int, t float32) float32 {
+		if from := heads[i].from; from < 1 {
+			return (t - from) / (1 - from)
+		}
+		return t
+	}
+	// Ties go to the lowest line IDs, so that the order of trackers doesn't
+	// matter
+	first := func(m meeting) float32 {
+		switch {
+		case m.trailI && m.trailJ:
+			return 0
+		case m.trailI:
+			return toi(m.i, m.ti)
+		case m.trailJ:
+			return toi(m.j, m.tj)
+		}
+		return minf(toi(m.i, m.ti), toi(m.j, m.tj))
+	}
+	ids := func(m meeting) (int, int) {
+		a, b := trackers[m.i].ID(), trackers[m.j].ID()
+		if a > b {
+			a, b = b, a
+		}
+		return a, b
+	}
+	sort.Slice(meetings, func(x, y int) bool {
+		if tx, ty := first(meetings[x]), first(meetings[y]); tx != ty {
+			return tx < ty
+		}
+		ax, bx := ids(meetings[x])
+		ay, by := ids(meetings[y])
+		if ax != ay {
+			return ax < ay
+		}
+		return bx < by
+	})
+
+	crash := func(i int, c *CollisionSegment, t, otherT float32) {
+		stop[i] = t
+		errs[i] = &CollisionHeadOn{
+			Collision: Collision{Point: c.Point, T: t},
+			ID:        c.ID,
+			OtherT:    otherT,
+			Draw:      rule == TickDraw,
+		}
+	}
+	hit := func(i int, c *CollisionSegment) {
+		if c != nil && c.T <= stop[i] {
+			stop[i] = c.T
+			errs[i] = c
+		}
+	}
+	for _, m := range meetings {
+		if m.trailI || m.trailJ {
+			if m.trailI {
+				hit(m.i, m.ci)
+			}
+			if m.trailJ {
+				hit(m.j, m.cj)
+			}
+			continue
+		}
+		// Lines which stopped before they got there never met
+		if m.ti > stop[m.i] || m.tj > stop[m.j] {
+			continue
+		}
+		switch {
+		case m.cj == nil:
+			crash(m.i, m.ci, m.ti, m.tj)
+		case m.ci == nil:
+			crash(m.j, m.cj, m.tj, m.ti)
+		case rule == TickCrashFirst && toi(m.i, m.ti) < toi(m.j, m.tj):
+			crash(m.i, m.ci, m.ti, m.tj)
+		case rule == TickCrashFirst && toi(m.j, m.tj) < toi(m.i, m.ti):
+			crash(m.j, m.cj, m.tj, m.ti)
+		default:
+			crash(m.i, m.ci, m.ti, m.tj)
+			crash(m.j, m.cj, m.tj, m.ti)
+		}
+	}
+
+	// Other colliders sent their own
+	for i, err := range errs {
+		if owned[i] {
+			h.updated(trackers[i], err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,210 @@
+package collision
+
+import (
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// tickLines tracks lines with a short head each, and then moves their heads
+// to the given ends, ready for UpdateTick.
+func tickLines(t *testing.T, collider Collider, lines [][]mgl.Vec3, ends []mgl.Vec3) ([]Tracker, []*[]mgl.Vec3) {
+	t.Helper()
+	trackers := make([]Tracker, len(lines))
+	segments := make([]*[]mgl.Vec3, len(lines))
+	for i, line := range lines {
+		segment := append([]mgl.Vec3{}, line...)
+		segments[i] = &segment
+		trackers[i] = collider.Track(segments[i])
+		if err := trackers[i].Update(); err != nil {
+			t.Fatalf("line %d: expected no collision; got %s", i, err)
+		}
+	}
+	for i, end := range ends {
+		segment := *segments[i]
+		segment[len(segment)-1] = end
+	}
+	return trackers, segments
+}
+
+func tickTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	// Line 1 gets to the crossing first
+	lines := [][]mgl.Vec3{
+		{{-5, 0, 0}, {-4, 0, 0}},
+		{{0, 0, -3}, {0, 0, -2}},
+	}
+	ends := []mgl.Vec3{{4, 0, 0}, {0, 0, 6}}
+
+	tests := []struct {
+		rule  TickRule
+		crash []bool
+	}{
+		{TickCrashBoth, []bool{true, true}},
+		{TickCrashFirst, []bool{false, true}},
+		{TickDraw, []bool{true, true}},
+	}
+	for _, test := range tests {
+		for _, reversed := range []bool{false, true} {
+			collider := newCollider(image.Rect(-10, -10, 10, 10))
+			trackers, _ := tickLines(t, collider, lines, ends)
+			order := []int{0, 1}
+			if reversed {
+				order = []int{1, 0}
+			}
+			errs := make([]error, len(trackers))
+			for i, err := range collider.UpdateTick([]Tracker{trackers[order[0]], trackers[order[1]]}, test.rule) {
+				errs[order[i]] = err
+			}
+
+			for i, err := range errs {
+				if !test.crash[i] {
+					if err != nil {
+						t.Errorf("%s, reversed %v: expected line %d to carry on; got %s", test.rule, reversed, i, err)
+					}
+					continue
+				}
+				headOn, ok := err.(*CollisionHeadOn)
+				if !ok {
+					t.Errorf("%s, reversed %v: expected line %d to crash head-on; got %v", test.rule, reversed, i, err)
+					continue
+				}
+				if headOn.ID != 1-i || headOn.Draw != (test.rule == TickDraw) || !vecNear(headOn.Point, mgl.Vec3{0, 0, 0}) {
+					t.Errorf("%s, reversed %v: expected line %d to crash into %d at the crossing; got %s", test.rule, reversed, i, 1-i, err)
+				}
+				if impact, _ := Impact(err); !mgl.FloatEqualThreshold(impact.T, []float32{5.0 / 9, 3.0 / 9}[i], 1e-4) {
+					t.Errorf("%s, reversed %v: expected line %d to crash at its own time of impact; got %v", test.rule, reversed, i, impact.T)
+				}
+			}
+		}
+	}
+
+	// Line 0 ran straight for a while, so most of its head is from before
+	// the tick, and both get to the crossing halfway through it
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	trackers, _ := tickLines(t, collider, [][]mgl.Vec3{
+		{{-9, 0, 0}, {0, 0, 0}},
+		{{0.5, 0, -1}, {0.5, 0, -1}},
+	}, []mgl.Vec3{{1, 0, 0}, {0.5, 0, 1}})
+	for i, err := range collider.UpdateTick(trackers, TickCrashFirst) {
+		if _, ok := err.(*CollisionHeadOn); !ok {
+			t.Errorf("long head: expected line %d to crash head-on; got %v", i, err)
+		}
+	}
+
+	// Line 1 runs straight for 12 ticks, stretching its head, and then line 0
+	// crosses the part of it from before the last tick, which is its trail
+	for _, rule := range []TickRule{TickCrashBoth, TickCrashFirst, TickDraw} {
+		collider := newCollider(image.Rect(-10, -10, 10, 10))
+		trackers, segments := tickLines(t, collider, [][]mgl.Vec3{
+			{{0, 0, -3}, {0, 0, -2}},
+			{{-8, 0, 0}, {-8, 0, 0}},
+		}, []mgl.Vec3{{0, 0, -2}, {-8, 0, 0}})
+		var errs []error
+		for tick := 1; tick <= 12; tick++ {
+			if tick == 12 {
+				(*segments[0])[1] = mgl.Vec3{0, 0, 1}
+			}
+			(*segments[1])[1] = mgl.Vec3{-8 + 13*float32(tick)/12, 0, 0}
+			if errs = collider.UpdateTick(trackers, rule); tick < 12 && (errs[0] != nil || errs[1] != nil) {
+				t.Fatalf("%s, tick %d: expected no collisions; got %v", rule, tick, errs)
+			}
+		}
+		if hit, ok := errs[0].(*CollisionSegment); !ok || hit.ID != 1 || !vecNear(hit.Point, mgl.Vec3{0, 0, 0}) {
+			t.Errorf("%s, stretched head: expected line 0 to hit the trail of line 1; got %v", rule, errs[0])
+		}
+		if errs[1] != nil {
+			t.Errorf("%s, stretched head: expected line 1 to carry on; got %s", rule, errs[1])
+		}
+	}
+}
+
+func tickTieTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	// Both get to the crossing at the same time
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	trackers, _ := tickLines(t, collider, [][]mgl.Vec3{
+		{{-5, 0, 0}, {-4, 0, 0}},
+		{{0, 0, -5}, {0, 0, -4}},
+	}, []mgl.Vec3{{5, 0, 0}, {0, 0, 5}})
+	for i, err := range collider.UpdateTick(trackers, TickCrashFirst) {
+		if _, ok := err.(*CollisionHeadOn); !ok {
+			t.Errorf("expected line %d to crash head-on; got %v", i, err)
+		}
+	}
+}
+
+func tickStaticTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	// Line 0 hits line 2 before it would have met line 1, which carries on
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	trackers, _ := tickLines(t, collider, [][]mgl.Vec3{
+		{{-5, 0, 0}, {-4, 0, 0}},
+		{{0, 0, -3}, {0, 0, -2}},
+		{{-2, 0, -1}, {-2, 0, 1}},
+	}, []mgl.Vec3{{4, 0, 0}, {0, 0, 6}})
+
+	var events []Event
+	collider.Subscribe(func(event Event) {
+		events = append(events, event)
+	})
+	// Line 2 isn't moving this tick
+	errs := collider.UpdateTick(trackers[:2], TickCrashBoth)
+	if hit, ok := errs[0].(*CollisionSegment); !ok || hit.ID != 2 || !vecNear(hit.Point, mgl.Vec3{-2, 0, 0}) {
+		t.Errorf("expected line 0 to hit line 2; got %v", errs[0])
+	}
+	if errs[1] != nil {
+		t.Errorf("expected line 1 to carry on; got %s", errs[1])
+	}
+	if len(events) != 1 || events[0].ID != 0 || events[0].Other != 2 || events[0].Err != errs[0] {
+		t.Errorf("expected one collision event for line 0; got %v", events)
+	}
+}
+
+func tickEventsTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	trackers, _ := tickLines(t, collider, [][]mgl.Vec3{
+		{{-5, 0, 0}, {-4, 0, 0}},
+		{{0, 0, -3}, {0, 0, -2}},
+	}, []mgl.Vec3{{4, 0, 0}, {0, 0, 6}})
+	var events []Event
+	collider.Subscribe(func(event Event) {
+		events = append(events, event)
+	})
+	errs := collider.UpdateTick(trackers, TickCrashBoth)
+	if len(events) != 2 {
+		t.Fatalf("expected an event for each line; got %v", events)
+	}
+	for i, event := range events {
+		if event.Kind != EventCollision || event.ID != i || event.Other != 1-i || event.Err != errs[i] {
+			t.Errorf("expected line %d to collide with %d; got %s", i, 1-i, event)
+		}
+	}
+	if pic := collider.Picture(); pic.Collision == nil || !vecNear(*pic.Collision, mgl.Vec3{0, 0, 0}) {
+		t.Errorf("expected the collision at the crossing; got %v", pic.Collision)
+	}
+
+	// Updating again outside of a tick collides with the other head as usual
+	if err := trackers[0].Update(); err == nil {
+		t.Errorf("expected line 0 to hit line 1")
+	}
+}
+
+func TestGridTick(t *testing.T) {
+	tickTester(t, GridCollider)
+	tickTieTester(t, GridCollider)
+	tickStaticTester(t, GridCollider)
+	tickEventsTester(t, GridCollider)
+}
+
+func TestLinearTick(t *testing.T) {
+	tickTester(t, LinearCollider)
+	tickTieTester(t, LinearCollider)
+	tickStaticTester(t, LinearCollider)
+	tickEventsTester(t, LinearCollider)
+}
+
+func TestQuadtreeTick(t *testing.T) {
+	tickTester(t, QuadtreeCollider)
+	tickTieTester(t, QuadtreeCollider)
+	tickStaticTester(t, QuadtreeCollider)
+	tickEventsTester(t, QuadtreeCollider)
+}
@@ -0,0 +1,139 @@
+package collision
+
+import (
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+func untrackTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	lines := [][]mgl.Vec3{
+		{{-5, 0, 0}, {5, 0, 0}},
+		{{-5, 0, 2}, {5, 0, 2}},
+		{{-4, 0, -5}, {-4, 0, -4}, {4, 0, -4}, {4, 0, -3}},
+	}
+	trackers := make([]Tracker, len(lines))
+	for i := range lines {
+		trackers[i] = collider.Track(&lines[i])
+	}
+	for i := range lines {
+		// Replay each line so that every segment is registered
+		points := lines[i]
+		for n := 1; n <= len(points); n++ {
+			lines[i] = points[:n]
+			trackers[i].Update()
+		}
+	}
+
+	trackers[0].Close()
+	if hit := collider.Raycast(mgl.Vec3{0, 0, -3}, mgl.Vec3{0, 0, 1}, 20); hit == nil || hit.ID != trackers[1].ID() {
+		t.Errorf("expected ray to pass the untracked line and hit line %d; got %s", trackers[1].ID(), hit)
+	}
+	if near := collider.Nearest(mgl.Vec3{0, 0, 0.5}, 1); near != nil {
+		t.Errorf("expected nothing near the untracked line; got %s", near)
+	}
+
+	// Nothing collides with it, and it doesn't collide with anything
+	crossing := []mgl.Vec3{{0, 0, -1}, {0, 0, 1}}
+	if err := collider.Track(&crossing).Update(); err != nil {
+		t.Errorf("expected no collision with the untracked line; got %s", err)
+	}
+	lines[0] = append(lines[0], mgl.Vec3{5, 0, 3})
+	if err := trackers[0].Update(); err != nil {
+		t.Errorf("expected no collision once untracked; got %s", err)
+	}
+	if id := collider.Track(&[]mgl.Vec3{}).ID(); id == trackers[0].ID() {
+		t.Errorf("expected a new ID; got the untracked one %d", id)
+	}
+
+	// Trimming the first two points leaves only the last segment of line 2
+	trackers[2].Trim(2)
+	if len(lines[2]) != 2 {
+		t.Fatalf("expected 2 points left; got %v", lines[2])
+	}
+	trimmed := []mgl.Vec3{{-5, 0, -4.5}, {-3, 0, -4.5}}
+	if err := collider.Track(&trimmed).Update(); err != nil {
+		t.Errorf("expected no collision with the trimmed segment; got %s", err)
+	}
+	remaining := []mgl.Vec3{{3, 0, -3.5}, {5, 0, -3.5}}
+	if err := collider.Track(&remaining).Update(); err == nil {
+		t.Errorf("expected collision with the remaining segment")
+	}
+
+	// The head segment is always kept, and still extends
+	trackers[2].Trim(10)
+	if len(lines[2]) != 2 {
+		t.Fatalf("expected the head segment to be kept; got %v", lines[2])
+	}
+	lines[2][1] = mgl.Vec3{4, 0, 3}
+	if err := trackers[2].Update(); err == nil {
+		t.Errorf("expected the extended head to collide with line 1")
+	}
+}
+
+// trimTester extends a line with a tail of limited length around a loop,
+// which only collides once the loop is shorter than the tail.
+func trimTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	segment := []mgl.Vec3{}
+	tracker := collider.Track(&segment)
+
+	square := []mgl.Vec3{{-2, 0, -2}, {2, 0, -2}, {2, 0, 2}, {-2, 0, 2}}
+	for i := 0; i < 12; i++ {
+		segment = append(segment, square[i%len(square)])
+		tracker.Trim(len(segment) - 3)
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("step %d: expected no collision with a tail of 3 points; got %s", i, err)
+		}
+	}
+
+	// Cutting back across the loop still reaches the tail
+	segment = append(segment, mgl.Vec3{3, 0, 0})
+	if err := tracker.Update(); err == nil {
+		t.Errorf("expected collision with the tail")
+	}
+}
+
+func TestGridUntrack(t *testing.T) {
+	untrackTester(t, GridCollider)
+	trimTester(t, GridCollider)
+}
+
+func TestLinearUntrack(t *testing.T) {
+	untrackTester(t, LinearCollider)
+	trimTester(t, LinearCollider)
+}
+
+func TestQuadtreeUntrack(t *testing.T) {
+	untrackTester(t, QuadtreeCollider)
+	trimTester(t, QuadtreeCollider)
+}
+
+func TestGridUntrackFreesCells(t *testing.T) {
+	for _, variant := range gridVariants {
+		collider := NewGridCollider(image.Rect(-10, -10, 10, 10), variant.opts)
+		segment := []mgl.Vec3{{-5, 0, -5}}
+		tracker := collider.Track(&segment)
+		for _, p := range []mgl.Vec3{{5, 0, -5}, {5, 0, 5}, {-5, 0, 5}} {
+			segment = append(segment, p)
+			tracker.Update()
+		}
+
+		grid := collider.(*gridCollider)
+		tracker.Trim(2)
+		grid.cells.Each(func(idx int, cell gridCell) {
+			for _, cs := range cell {
+				if cs.tracker == tracker && cs.offset < 2 {
+					t.Errorf("%s: expected the trimmed segments to be removed; got %d: %s in %d", variant.name, cs.offset, cs, idx)
+				}
+			}
+		})
+
+		tracker.Close()
+		grid.cells.Each(func(idx int, cell gridCell) {
+			t.Errorf("%s: expected every cell to be empty once the line is closed; got %s in %d", variant.name, cell, idx)
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package collision
 
+import (
+	"math"
+	"math/big"
+)
+
 // IsBoundingBox returns true if a box intercepts b box.
 func IsBoxCollision(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float32) bool {
 	return a1_x <= b2_x && a2_x >= b1_x && a1_y <= b2_y && a2_y >= b1_y
@@ -8,64 +13,353 @@ func IsBoxCollision(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float32) bool
 // IsCollision returns true if segment a1->a2 intersects segment b1->b2.
 // Collisions are checked [a,b). That is, a->b->c will not collide, but
 // a->b,a->c will collide.
+//
+// There is no tolerance: every coordinate is taken as the exact value of its
+// float32, and every decision is made on the exact sign of the orientation
+// tests behind it (see cross2D). Touching counts as colliding, except at the
+// end of b which is only reached on the next move, and segments are only
+// connected when they share an identical point. An epsilon would make nearby
+// segments collide or not depending on the order they were checked in, and
+// would let a line slip through a trail which it grazes at a shallow angle.
 func IsCollision2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float32) bool {
+	_, ok := Intersect2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y)
+	return ok
+}
+
+// Intersect2D is like IsCollision2D, but it also returns the fractional
+// position along b1->b2 where it first touches a1->a2. The position is
+// rounded, but the collision itself is decided exactly.
+func Intersect2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float32) (float32, bool) {
 	// Partly based on https://stackoverflow.com/questions/563198/
+	// Subtracting float32s never gets the sign wrong, so the collinear
+	// checks below are exact.
 	s1_x := a2_x - a1_x
 	s1_y := a2_y - a1_y
 	s2_x := b2_x - b1_x
 	s2_y := b2_y - b1_y
 
 	connected := a2_x == b1_x && a2_y == b1_y
-	denom := s1_x*s2_y - s2_x*s1_y
-	if denom == 0 {
-		// Collinear
+	denom, denomSign := cross2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y)
+	if denomSign == 0 {
+		// Parallel, only collinear segments can touch
+		if _, sign := cross2D(a1_x, a1_y, a2_x, a2_y, a1_x, a1_y, b1_x, b1_y); sign != 0 {
+			return 0, false
+		}
+		if _, sign := cross2D(b1_x, b1_y, b2_x, b2_y, b1_x, b1_y, a1_x, a1_y); sign != 0 {
+			return 0, false
+		}
 
 		if connected {
 			// Pointing away?
-			return (s1_x*s2_x < 0) || (s1_y*s2_y < 0)
+			if (float64(s1_x)*float64(s2_x) < 0) || (float64(s1_y)*float64(s2_y) < 0) {
+				return 0, true
+			}
+			return 0, false
 		}
 
 		// Any of the wrong points connected? (Head-on connected)
 		if a2_x == b2_x && a2_y == b2_y {
-			return true
+			return collinearEntry(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y), true
 		}
 
 		// Basically box collision
-		return a1_x <= b2_x && a2_x >= b1_x && a1_y <= b2_y && a2_y >= b1_y
+		if IsBoxCollision(minf(a1_x, a2_x), minf(a1_y, a2_y), maxf(a1_x, a2_x), maxf(a1_y, a2_y), minf(b1_x, b2_x), minf(b1_y, b2_y), maxf(b1_x, b2_x), maxf(b1_y, b2_y)) {
+			return collinearEntry(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y), true
+		}
+		return 0, false
 	}
 
 	if connected {
 		// Connected but not collinear
-		return false
+		return 0, false
+	}
+
+	// s along b and t along a, as fractions of denom. Their signs and how
+	// they compare to denom are each an orientation test of their own:
+	//   s_numer         = (a2-a1) x (a1-b1)
+	//   s_numer - denom = (a2-a1) x (a1-b2)
+	//   t_numer         = (b2-b1) x (a1-b1)
+	//   t_numer - denom = (b2-b1) x (a2-b1)
+	s_numer, s := cross2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, a1_x, a1_y)
+	_, sd := cross2D(a1_x, a1_y, a2_x, a2_y, b2_x, b2_y, a1_x, a1_y)
+	_, t := cross2D(b1_x, b1_y, b2_x, b2_y, b1_x, b1_y, a1_x, a1_y)
+	_, td := cross2D(b1_x, b1_y, b2_x, b2_y, b1_x, b1_y, a2_x, a2_y)
+
+	// Same orientation either way, so that touching endpoints are treated
+	// the same no matter which way the segments wind.
+	s, sd, t, td = s*denomSign, sd*denomSign, t*denomSign, td*denomSign
+
+	// All of a is solid, but the end of b is only reached on the next move.
+	if s < 0 || t < 0 || sd >= 0 || td > 0 {
+		return 0, false
+	}
+
+	// Intersecting point is at s along b, or equivalently t_numer/denom along a.
+	r := float32(s_numer / denom)
+	if r >= 1 {
+		// Rounded up, but b's end isn't touching
+		r = math.Nextafter32(1, 0)
+	}
+	return r, true
+}
+
+// CapsuleIntersect2D is like Intersect2D, but for segments which are thick:
+// it returns the fractional position along b1->b2 where it first comes
+// within r of a1->a2. Unlike Intersect2D it's computed with the usual
+// floating point tolerance, and a radius of 0 is the same as Intersect2D.
+func CapsuleIntersect2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y, r float32) (float32, bool) {
+	if r <= 0 {
+		return Intersect2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y)
+	}
+	dist, _, nearest := SegmentDistance2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y)
+	if dist > r {
+		return 0, false
+	}
+	if d, _ := PointSegmentDistance2D(b1_x, b1_y, a1_x, a1_y, a2_x, a2_y); d <= r {
+		// Starts within
+		return 0, true
+	}
+
+	// b enters the capsule either through one of the round caps around a's
+	// ends, or through one of the flat sides along it. In float64, since
+	// nearly parallel segments cancel out.
+	p_x, p_y := float64(b1_x), float64(b1_y)
+	d_x, d_y := float64(b2_x)-p_x, float64(b2_y)-p_y
+	rr := float64(r)
+	t := math.Inf(1)
+
+	roundCap := func(c_x, c_y float64) {
+		// Smallest root of |p + d*t - c|^2 = r^2
+		w_x, w_y := p_x-c_x, p_y-c_y
+		qa := d_x*d_x + d_y*d_y
+		qb := w_x*d_x + w_y*d_y
+		qc := w_x*w_x + w_y*w_y - rr*rr
+		disc := qb*qb - qa*qc
+		if qa == 0 || disc < 0 {
+			return
+		}
+		if root := (-qb - math.Sqrt(disc)) / qa; root >= 0 && root < t {
+			t = root
+		}
+	}
+	roundCap(float64(a1_x), float64(a1_y))
+	roundCap(float64(a2_x), float64(a2_y))
+
+	s_x, s_y := float64(a2_x)-float64(a1_x), float64(a2_y)-float64(a1_y)
+	if l := math.Hypot(s_x, s_y); l > 0 {
+		// Signed distance from a's line at either end of b
+		n_x, n_y := -s_y/l, s_x/l
+		h0 := (p_x-float64(a1_x))*n_x + (p_y-float64(a1_y))*n_y
+		h1 := h0 + d_x*n_x + d_y*n_y
+		for _, side := range []float64{-rr, rr} {
+			if h0 == h1 {
+				break
+			}
+			root := (side - h0) / (h1 - h0)
+			if root < 0 || root >= t {
+				continue
+			}
+			q_x, q_y := p_x+d_x*root, p_y+d_y*root
+			if u := ((q_x-float64(a1_x))*s_x + (q_y-float64(a1_y))*s_y) / (l * l); 0 <= u && u <= 1 {
+				t = root
+			}
+		}
+	}
+
+	if math.IsInf(t, 1) {
+		// Only grazing, which rounding lost
+		t = float64(nearest)
+	}
+	if t >= 1 {
+		// The end of b is only reached on the next move
+		return 0, false
+	}
+	pos := float32(t)
+	if pos >= 1 {
+		pos = math.Nextafter32(1, 0)
+	}
+	return pos, true
+}
+
+// cross2D returns the cross product (p1-p0) x (q1-q0), and its exact sign.
+// The product is computed in float64, and only recomputed with exact rational
+// arithmetic when it's too close to 0 for the rounding error to be ruled out
+// and some of the rounding actually happened, which is rare.
+func cross2D(p0_x, p0_y, p1_x, p1_y, q0_x, q0_y, q1_x, q1_y float32) (float64, int) {
+	a_x, exact1 := exactSub(float64(p1_x), float64(p0_x))
+	a_y, exact2 := exactSub(float64(p1_y), float64(p0_y))
+	b_x, exact3 := exactSub(float64(q1_x), float64(q0_x))
+	b_y, exact4 := exactSub(float64(q1_y), float64(q0_y))
+
+	// The explicit conversions prevent fused multiply-adds, so that l and r
+	// are exactly the rounded products.
+	l := float64(a_x * b_y)
+	r := float64(a_y * b_x)
+	d := l - r
+
+	// Each difference, product and the final subtraction are rounded at most
+	// once, which bounds the error to 4 units of 2^-53 of the magnitudes
+	// involved. The margin on top keeps the value itself accurate enough to
+	// be rounded to a float32.
+	const errBound = 4.0 / (1 << 53) * (1 << 24)
+	if bound := errBound * (math.Abs(l) + math.Abs(r)); d > bound {
+		return d, 1
+	} else if d < -bound {
+		return d, -1
 	}
 
-	denomPositive := denom > 0
+	// Only the final subtraction was rounded, which can't get the sign
+	// wrong. This is the usual case for parallel segments.
+	if exact1 && exact2 && exact3 && exact4 && math.FMA(a_x, b_y, -l) == 0 && math.FMA(a_y, b_x, -r) == 0 {
+		switch {
+		case d > 0:
+			return d, 1
+		case d < 0:
+			return d, -1
+		}
+		return 0, 0
+	}
 
-	s3_x := a1_x - b1_x
-	s3_y := a1_y - b1_y
+	rat := func(v float32) *big.Rat { return new(big.Rat).SetFloat64(float64(v)) }
+	sub := func(a, b float32) *big.Rat { return new(big.Rat).Sub(rat(a), rat(b)) }
+	exact := new(big.Rat).Mul(sub(p1_x, p0_x), sub(q1_y, q0_y))
+	exact.Sub(exact, new(big.Rat).Mul(sub(p1_y, p0_y), sub(q1_x, q0_x)))
+	d, _ = exact.Float64()
+	return d, exact.Sign()
+}
 
-	s_numer := s1_x*s3_y - s1_y*s3_x
-	if (s_numer <= 0) == denomPositive {
-		return false
+// exactSub returns a - b, and whether it was exact.
+func exactSub(a, b float64) (float64, bool) {
+	// Knuth's TwoSum, which recovers the rounding error of a + -b
+	s := a - b
+	bv := s - a
+	av := s - bv
+	return s, (a-av)+(-b-bv) == 0
+}
+
+// collinearEntry returns the fractional position along b1->b2 where it first
+// enters the collinear segment a1->a2.
+func collinearEntry(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float32) float32 {
+	// In float64, since nearly overlapping points cancel out
+	d_x, d_y := float64(b2_x)-float64(b1_x), float64(b2_y)-float64(b1_y)
+	l := d_x*d_x + d_y*d_y
+	if l == 0 {
+		return 0
+	}
+	t1 := ((float64(a1_x)-float64(b1_x))*d_x + (float64(a1_y)-float64(b1_y))*d_y) / l
+	t2 := ((float64(a2_x)-float64(b1_x))*d_x + (float64(a2_y)-float64(b1_y))*d_y) / l
+	if t2 < t1 {
+		t1 = t2
+	}
+	if t1 < 0 {
+		// Starts within a
+		return 0
 	}
+	if t1 > 1 {
+		return 1
+	}
+	return float32(t1)
+}
 
-	t_numer := s2_x*s3_y - s2_y*s3_x
-	if (t_numer <= 0) == denomPositive {
-		return false
+func minf(a, b float32) float32 {
+	if a < b {
+		return a
 	}
+	return b
+}
 
-	if ((s_numer >= denom) == denomPositive) || ((t_numer >= denom) == denomPositive) {
-		return false
+func maxf(a, b float32) float32 {
+	if a > b {
+		return a
 	}
+	return b
+}
 
-	/*
-		// Intersecting point
-		t := t_numer / denom
-		i_x := a1_x + (t * s1_x)
-		i_y := a1_x + (t * s1_y)
-		fmt.Printf("collided at %v,%v when comparing %v\n", i_x, i_y, []float32{a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y})
+// PointSegmentDistance2D returns the distance from point p to segment a->b,
+// and the fractional position along a->b of the nearest point.
+func PointSegmentDistance2D(p_x, p_y, a_x, a_y, b_x, b_y float32) (float32, float32) {
+	s_x, s_y := b_x-a_x, b_y-a_y
+	var t float32
+	if l := s_x*s_x + s_y*s_y; l > 0 {
+		t = ((p_x-a_x)*s_x + (p_y-a_y)*s_y) / l
+		if t < 0 {
+			t = 0
+		} else if t > 1 {
+			t = 1
+		}
+	}
+	d_x, d_y := a_x+s_x*t-p_x, a_y+s_y*t-p_y
+	return float32(math.Sqrt(float64(d_x*d_x + d_y*d_y))), t
+}
 
-		fmt.Println(s_numer, t_numer, denom, "numer", a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y)
-	*/
-	return true
+// SegmentDistance2D returns the distance between segment a1->a2 and segment
+// b1->b2, and the fractional positions along each of the nearest points.
+func SegmentDistance2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float32) (dist, ta, tb float32) {
+	// Crossing segments (including their endpoints) are 0 apart. Whether they
+	// cross is decided exactly, since rounding makes nearly parallel segments
+	// cross far away. Collinear segments are left to the endpoints below.
+	_, b1Side := cross2D(a1_x, a1_y, a2_x, a2_y, a1_x, a1_y, b1_x, b1_y)
+	_, b2Side := cross2D(a1_x, a1_y, a2_x, a2_y, a1_x, a1_y, b2_x, b2_y)
+	_, a1Side := cross2D(b1_x, b1_y, b2_x, b2_y, b1_x, b1_y, a1_x, a1_y)
+	_, a2Side := cross2D(b1_x, b1_y, b2_x, b2_y, b1_x, b1_y, a2_x, a2_y)
+	if b1Side*b2Side <= 0 && a1Side*a2Side <= 0 && (b1Side != 0 || b2Side != 0) {
+		s1_x, s1_y := float64(a2_x)-float64(a1_x), float64(a2_y)-float64(a1_y)
+		s2_x, s2_y := float64(b2_x)-float64(b1_x), float64(b2_y)-float64(b1_y)
+		s3_x, s3_y := float64(a1_x)-float64(b1_x), float64(a1_y)-float64(b1_y)
+		if denom := s1_x*s2_y - s2_x*s1_y; denom != 0 {
+			u := math.Min(math.Max((s1_x*s3_y-s1_y*s3_x)/denom, 0), 1)
+			t := math.Min(math.Max((s2_x*s3_y-s2_y*s3_x)/denom, 0), 1)
+			return 0, float32(t), float32(u)
+		}
+	}
+
+	// Otherwise the nearest points include an endpoint of either segment
+	dist, ta = PointSegmentDistance2D(b1_x, b1_y, a1_x, a1_y, a2_x, a2_y)
+	tb = 0
+	if d, t := PointSegmentDistance2D(b2_x, b2_y, a1_x, a1_y, a2_x, a2_y); d < dist {
+		dist, ta, tb = d, t, 1
+	}
+	if d, t := PointSegmentDistance2D(a1_x, a1_y, b1_x, b1_y, b2_x, b2_y); d < dist {
+		dist, ta, tb = d, 0, t
+	}
+	if d, t := PointSegmentDistance2D(a2_x, a2_y, b1_x, b1_y, b2_x, b2_y); d < dist {
+		dist, ta, tb = d, 1, t
+	}
+	return dist, ta, tb
+}
+
+// RaySegment2D returns the distance along the ray from o in the unit direction
+// d to where it first touches segment a->b.
+func RaySegment2D(o_x, o_y, d_x, d_y, a_x, a_y, b_x, b_y float32) (float32, bool) {
+	s_x, s_y := b_x-a_x, b_y-a_y
+	w_x, w_y := a_x-o_x, a_y-o_y
+
+	denom := d_x*s_y - d_y*s_x
+	if denom == 0 {
+		// Parallel, only collinear segments can be hit
+		if w_x*d_y-w_y*d_x != 0 {
+			return 0, false
+		}
+		t1 := w_x*d_x + w_y*d_y
+		t2 := (b_x-o_x)*d_x + (b_y-o_y)*d_y
+		if t2 < t1 {
+			t1, t2 = t2, t1
+		}
+		if t2 < 0 {
+			// Behind us
+			return 0, false
+		}
+		if t1 < 0 {
+			// Starting within the segment
+			return 0, true
+		}
+		return t1, true
+	}
+
+	t := (w_x*s_y - w_y*s_x) / denom
+	u := (w_x*d_y - w_y*d_x) / denom
+	if t < 0 || u < 0 || u > 1 {
+		return 0, false
+	}
+	return t, true
 }
@@ -1,6 +1,13 @@
 package collision
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
 
 func TestBoxCollision(t *testing.T) {
 	tests := []struct {
@@ -55,8 +62,12 @@ func TestIsCollision(t *testing.T) {
 		{true, 1, 0, 1, 1, 0, 1, 4, 1},
 		{false, 0, 0, 1, 1, 2, 2, 3, 3},
 		{false, 2, 0, 3, 0, 3, 0, 3, 1},
-		{false, 2, 1, 3, 1, 1, 0, 2, 0}, // collinear disjoint vertically
-		//{false, 1.37, 1.39, 1.34, 1.35, 1.31, 1.31, 1.34, 1.35},
+		{false, 2, 1, 3, 1, 1, 0, 2, 0},                         // collinear disjoint vertically
+		{false, 1.37, 1.39, 1.34, 1.35, 1.31, 1.31, 1.34, 1.35}, // nearly collinear, touching at the end of b
+		{true, 4, 4, 0, 0, 1, 1, 2, 2},                          // d -> a, b -> c, collinear contained
+		{false, 0, 0, 2, 2, 0, 1, 1, 2},                         // parallel offset diagonally
+		{true, 0, 1, 0, 4, 0, 2, 1, 3},                          // touching at the start of b
+		{false, 0, 1, 0, 4, 1, 3, 0, 2},                         // touching at the end of b
 	}
 
 	for i, test := range tests {
@@ -66,3 +77,229 @@ func TestIsCollision(t *testing.T) {
 		}
 	}
 }
+
+func TestSegmentDistance(t *testing.T) {
+	tests := []struct {
+		dist float32
+
+		a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float32
+	}{
+		{0, 0, 0, 2, 2, 0, 2, 2, 0},        // crossing
+		{0, 0, 0, 2, 0, 2, 0, 3, 1},        // connected
+		{1, 0, 0, 4, 0, 0, 1, 4, 1},        // parallel
+		{1, 0, 0, 4, 0, 2, 1, 2, 3},        // perpendicular, apart
+		{5, 0, 0, 0, 0, 3, 4, 3, 4},        // points
+		{2, -1, 0, 1, 0, 3, 0, 5, 0},       // collinear, apart
+		{0, -1, 0, 1, 0, 0, 0, 5, 0},       // collinear, overlapping
+		{0.5, 0, 0, 0, 1, -1, 1.5, 1, 1.5}, // past the end
+		// nearly collinear, apart
+		{0.8, -5.209105, -4.268324, -2.7043025, -2.5946684, -2.0391269, -2.1502123, 0.24741447, -0.62239414},
+	}
+
+	for i, test := range tests {
+		dist, _, _ := SegmentDistance2D(test.a1_x, test.a1_y, test.a2_x, test.a2_y, test.b1_x, test.b1_y, test.b2_x, test.b2_y)
+		if !mgl.FloatEqualThreshold(dist, test.dist, 1e-6) {
+			t.Errorf("SegmentDistance2D test #%d failed: got %v; want %v", i, dist, test.dist)
+		}
+	}
+}
+
+func TestCapsuleIntersect(t *testing.T) {
+	tests := []struct {
+		result bool
+		t      float32
+
+		a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y, r float32
+	}{
+		{true, 0.25, 0, 0, 4, 0, 2, -2, 2, 2, 1},       // through the side
+		{true, 0.5, 0, 0, 4, 0, 2, 1, 2, -1, 0},        // no radius
+		{true, 0, 0, 0, 4, 0, 0, 0.5, 4, 0.5, 1},       // starts within
+		{true, 0.5, 0, 0, 4, 0, 7, 0, 3, 0, 1},         // into the round end
+		{true, 0.5, 0, 0, 4, 0, 6, 1, 2, 1, 1},         // grazing the round end
+		{false, 0, 0, 0, 4, 0, 6, 1.5, 4, 1.5, 1},      // passing the round end
+		{false, 0, 0, 0, 4, 0, 0, 3, 4, 3, 1},          // parallel, apart
+		{false, 0, 0, 0, 4, 0, 2, 3, 2, 1, 1},          // only the end of b touches
+		{true, 0.35, 0, 0, 0, 0, -4, 0.9, 4, 0.9, 1.5}, // point
+	}
+
+	for i, test := range tests {
+		r, ok := CapsuleIntersect2D(test.a1_x, test.a1_y, test.a2_x, test.a2_y, test.b1_x, test.b1_y, test.b2_x, test.b2_y, test.r)
+		if ok != test.result || (ok && !mgl.FloatEqualThreshold(r, test.t, 1e-6)) {
+			t.Errorf("CapsuleIntersect2D test #%d failed: got %v %v; want %v %v", i, ok, r, test.result, test.t)
+		}
+	}
+}
+
+// TestCapsuleIntersectDistance checks that the head is within the radius where
+// it first touches, and not anywhere before.
+func TestCapsuleIntersectDistance(t *testing.T) {
+	n := 100000
+	if testing.Short() {
+		n = 1000
+	}
+	rng := rand.New(rand.NewSource(1))
+	coord := func() float32 { return float32(rng.Intn(2000)-1000) / 100 }
+	for i := 0; i < n; i++ {
+		a1_x, a1_y, a2_x, a2_y := coord(), coord(), coord(), coord()
+		b1_x, b1_y, b2_x, b2_y := coord(), coord(), coord(), coord()
+		radius := float32(rng.Intn(300)) / 100
+
+		r, ok := CapsuleIntersect2D(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y, radius)
+		dist := func(s float32) float32 {
+			d, _ := PointSegmentDistance2D(b1_x+(b2_x-b1_x)*s, b1_y+(b2_y-b1_y)*s, a1_x, a1_y, a2_x, a2_y)
+			return d
+		}
+		const tolerance = 1e-3
+		if ok && dist(r) > radius+tolerance {
+			t.Fatalf("%v,%v -> %v,%v and %v,%v -> %v,%v with radius %v: %v apart at %v", a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y, radius, dist(r), r)
+		}
+		if !ok {
+			r = 1
+		}
+		for s := float32(0); s < r-0.01; s += 0.01 {
+			if dist(s) < radius-tolerance {
+				t.Fatalf("%v,%v -> %v,%v and %v,%v -> %v,%v with radius %v: %v apart at %v, before %v", a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y, radius, dist(s), s, r)
+			}
+		}
+	}
+}
+
+// intersectExact is Intersect2D in exact arithmetic, as a reference. Sums and
+// products of float32s never need more than a few hundred bits, so big.Float
+// with plenty of precision is exact and much faster than big.Rat.
+func intersectExact(a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y float32) (float64, bool) {
+	const prec = 2048
+	num := func(v float32) *big.Float { return new(big.Float).SetPrec(prec).SetFloat64(float64(v)) }
+	sub := func(a, b *big.Float) *big.Float { return new(big.Float).SetPrec(prec).Sub(a, b) }
+	mul := func(a, b *big.Float) *big.Float { return new(big.Float).SetPrec(prec).Mul(a, b) }
+	cross := func(x0, y0, x1, y1 *big.Float) *big.Float { return sub(mul(x0, y1), mul(y0, x1)) }
+	dot := func(x0, y0, x1, y1 *big.Float) *big.Float {
+		r := mul(x0, x1)
+		return r.Add(r, mul(y0, y1))
+	}
+	ratio := func(a, b *big.Float) float64 {
+		r, _ := new(big.Float).SetPrec(prec).Quo(a, b).Float64()
+		return r
+	}
+
+	a1x, a1y, a2x, a2y := num(a1_x), num(a1_y), num(a2_x), num(a2_y)
+	b1x, b1y, b2x, b2y := num(b1_x), num(b1_y), num(b2_x), num(b2_y)
+	s1x, s1y, s2x, s2y := sub(a2x, a1x), sub(a2y, a1y), sub(b2x, b1x), sub(b2y, b1y)
+	s3x, s3y := sub(a1x, b1x), sub(a1y, b1y)
+
+	connected := a2_x == b1_x && a2_y == b1_y
+	denom := cross(s1x, s1y, s2x, s2y)
+	if denom.Sign() == 0 {
+		if cross(s1x, s1y, s3x, s3y).Sign() != 0 || cross(s2x, s2y, s3x, s3y).Sign() != 0 {
+			return 0, false
+		}
+		if connected {
+			return 0, s1x.Sign()*s2x.Sign() < 0 || s1y.Sign()*s2y.Sign() < 0
+		}
+
+		// Entry along b into a, if they overlap at all
+		l := dot(s2x, s2y, s2x, s2y)
+		if l.Sign() == 0 {
+			// b is a point, is it within a?
+			la := dot(s1x, s1y, s1x, s1y)
+			if la.Sign() == 0 {
+				return 0, s3x.Sign() == 0 && s3y.Sign() == 0
+			}
+			in := dot(sub(b1x, a1x), sub(b1y, a1y), s1x, s1y)
+			return 0, in.Sign() >= 0 && in.Cmp(la) <= 0
+		}
+		t1 := dot(sub(a1x, b1x), sub(a1y, b1y), s2x, s2y)
+		t2 := dot(sub(a2x, b1x), sub(a2y, b1y), s2x, s2y)
+		if t2.Cmp(t1) < 0 {
+			t1, t2 = t2, t1
+		}
+		if t2.Sign() < 0 || t1.Cmp(l) > 0 {
+			return 0, false
+		}
+		if t1.Sign() < 0 {
+			return 0, true
+		}
+		return ratio(t1, l), true
+	}
+	if connected {
+		return 0, false
+	}
+
+	sn, tn := cross(s1x, s1y, s3x, s3y), cross(s2x, s2y, s3x, s3y)
+	if denom.Sign() < 0 {
+		denom.Neg(denom)
+		sn.Neg(sn)
+		tn.Neg(tn)
+	}
+	if sn.Sign() < 0 || tn.Sign() < 0 || sn.Cmp(denom) >= 0 || tn.Cmp(denom) > 0 {
+		return 0, false
+	}
+	return ratio(sn, denom), true
+}
+
+// TestIntersectExact checks Intersect2D against exact arithmetic on millions of
+// random and nearly degenerate inputs, or a few thousand with -short.
+func TestIntersectExact(t *testing.T) {
+	n := 500000
+	if testing.Short() {
+		n = 5000
+	}
+	rng := rand.New(rand.NewSource(1))
+	coord := func() float32 { return rng.Float32()*16 - 8 }
+	grid := func() float32 { return float32(rng.Intn(9)) / 2 }
+	nudge := func(v float32) float32 {
+		switch rng.Intn(3) {
+		case 0:
+			return math.Nextafter32(v, float32(math.Inf(-1)))
+		case 1:
+			return math.Nextafter32(v, float32(math.Inf(1)))
+		}
+		return v
+	}
+	generators := []struct {
+		name string
+		gen  func() [8]float32
+	}{
+		{"random", func() [8]float32 {
+			return [8]float32{coord(), coord(), coord(), coord(), coord(), coord(), coord(), coord()}
+		}},
+		{"grid", func() [8]float32 {
+			return [8]float32{grid(), grid(), grid(), grid(), grid(), grid(), grid(), grid()}
+		}},
+		{"nearly collinear", func() [8]float32 {
+			// b's points are on a's line, give or take an ulp
+			a1_x, a1_y, a2_x, a2_y := coord(), coord(), coord(), coord()
+			along := func() (float32, float32) {
+				f := rng.Float32()*3 - 1
+				return nudge(a1_x + (a2_x-a1_x)*f), nudge(a1_y + (a2_y-a1_y)*f)
+			}
+			b1_x, b1_y := along()
+			b2_x, b2_y := along()
+			return [8]float32{a1_x, a1_y, a2_x, a2_y, b1_x, b1_y, b2_x, b2_y}
+		}},
+		{"touching", func() [8]float32 {
+			// b starts or ends at a point on a, give or take an ulp
+			a1_x, a1_y, a2_x, a2_y := coord(), coord(), coord(), coord()
+			f := []float32{0, 1, rng.Float32()}[rng.Intn(3)]
+			p_x, p_y := nudge(a1_x+(a2_x-a1_x)*f), nudge(a1_y+(a2_y-a1_y)*f)
+			if rng.Intn(2) == 0 {
+				return [8]float32{a1_x, a1_y, a2_x, a2_y, p_x, p_y, coord(), coord()}
+			}
+			return [8]float32{a1_x, a1_y, a2_x, a2_y, coord(), coord(), p_x, p_y}
+		}},
+	}
+
+	for _, g := range generators {
+		for i := 0; i < n; i++ {
+			v := g.gen()
+			r, ok := Intersect2D(v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7])
+			expect, expectOk := intersectExact(v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7])
+			if ok != expectOk {
+				t.Fatalf("%s: Intersect2D%v: got %v; want %v", g.name, v, ok, expectOk)
+			}
+			if ok && math.Abs(float64(r)-expect) > 1e-6 {
+				t.Fatalf("%s: Intersect2D%v: got %v along b; want %v", g.name, v, r, expect)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package collision
+
+import (
+	"math"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Break is a point which splits a tracked line into disconnected runs, such
+// as where it wraps around the arena or leaves a gap. There's no segment to or
+// from a break, so nothing collides with the gap.
+var Break = mgl.Vec3{float32(math.NaN()), float32(math.NaN()), float32(math.NaN())}
+
+// IsBreak returns true if p is a Break.
+func IsBreak(p mgl.Vec3) bool {
+	return p[0] != p[0]
+}
+
+// isGap returns true if a -> b is the gap at a Break rather than a segment.
+func isGap(a, b mgl.Vec3) bool {
+	return IsBreak(a) || IsBreak(b)
+}
+
+// unbounded is the edge of a wraparound arena, which lines never collide
+// with.
+type unbounded struct{}
+
+func (unbounded) crossing(p0, p1 mgl.Vec3, r float32) *CollisionEdge {
+	return nil
+}
+
+// Wrap returns where segment p0 -> p1 exits the boundary, and the point on
+// the opposite edge where it enters again, or false if p1 doesn't leave the
+// boundary. Moving along an edge doesn't leave it. Leaving through a corner
+// enters through the opposite corner.
+func (b Boundary) Wrap(p0, p1 mgl.Vec3) (exit, entry mgl.Vec3, ok bool) {
+	x, y := p1[0], p1[2]
+	if b.X1 <= x && x <= b.X2 && b.Y1 <= y && y <= b.Y2 {
+		return exit, entry, false
+	}
+	crossing := b.Crossing(p0, p1)
+
+	// Rounding can leave the exit just off the edge
+	exit = crossing.Point
+	exit[0] = minf(maxf(exit[0], b.X1), b.X2)
+	exit[2] = minf(maxf(exit[2], b.Y1), b.Y2)
+	switch crossing.Edge {
+	case EdgeX1:
+		exit[0] = b.X1
+	case EdgeX2:
+		exit[0] = b.X2
+	case EdgeY1:
+		exit[2] = b.Y1
+	case EdgeY2:
+		exit[2] = b.Y2
+	}
+
+	entry = exit
+	if x < b.X1 && exit[0] == b.X1 {
+		entry[0] = b.X2
+	} else if x > b.X2 && exit[0] == b.X2 {
+		entry[0] = b.X1
+	}
+	if y < b.Y1 && exit[2] == b.Y1 {
+		entry[2] = b.Y2
+	} else if y > b.Y2 && exit[2] == b.Y2 {
+		entry[2] = b.Y1
+	}
+	return exit, entry, true
+}
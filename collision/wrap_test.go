@@ -0,0 +1,93 @@
+package collision
+
+import (
+	"errors"
+	"image"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+func TestBoundaryWrap(t *testing.T) {
+	b := Boundary{-10, -10, 10, 10}
+	tests := []struct {
+		p0, p1      mgl.Vec3
+		ok          bool
+		exit, entry mgl.Vec3
+	}{
+		{mgl.Vec3{0, 0, 0}, mgl.Vec3{5, 0, 5}, false, mgl.Vec3{}, mgl.Vec3{}},
+		{mgl.Vec3{8, 0, 1}, mgl.Vec3{12, 0, 3}, true, mgl.Vec3{10, 0, 2}, mgl.Vec3{-10, 0, 2}},
+		{mgl.Vec3{1, 0, -8}, mgl.Vec3{3, 0, -12}, true, mgl.Vec3{2, 0, -10}, mgl.Vec3{2, 0, 10}},
+		{mgl.Vec3{-8, 0, 8}, mgl.Vec3{-12, 0, 12}, true, mgl.Vec3{-10, 0, 10}, mgl.Vec3{10, 0, -10}},
+		{mgl.Vec3{-10, 0, 0}, mgl.Vec3{-12, 0, 0}, true, mgl.Vec3{-10, 0, 0}, mgl.Vec3{10, 0, 0}},
+		// Along the edge
+		{mgl.Vec3{10, 0, 0}, mgl.Vec3{10, 0, 5}, false, mgl.Vec3{}, mgl.Vec3{}},
+	}
+	for i, test := range tests {
+		exit, entry, ok := b.Wrap(test.p0, test.p1)
+		if ok != test.ok || exit != test.exit || entry != test.entry {
+			t.Errorf("Wrap test #%d failed: expected %v, %v, %v; got %v, %v, %v", i, test.exit, test.entry, test.ok, exit, entry, ok)
+		}
+	}
+}
+
+func wrapTester(t *testing.T, newCollider func(image.Rectangle) Collider) {
+	collider := newCollider(image.Rect(-10, -10, 10, 10))
+	collider.SetWrap(true)
+
+	// Runs right up to the edge, and continues from the opposite edge
+	wrapping := []mgl.Vec3{{5, 0, 0}, {10, 0, 0}}
+	tracker := collider.Track(&wrapping)
+	if err := tracker.Update(); err != nil {
+		t.Fatalf("expected no collision with the edge; got %s", err)
+	}
+	wrapping = append(wrapping, Break, mgl.Vec3{-10, 0, 0}, mgl.Vec3{-5, 0, 0})
+	if err := tracker.Update(); err != nil {
+		t.Fatalf("expected no collision after wrapping; got %s", err)
+	}
+
+	if hit := collider.Raycast(mgl.Vec3{2, 0, 3}, mgl.Vec3{0, 0, 1}, 20); hit != nil {
+		t.Errorf("expected ray to hit nothing; got %s", hit)
+	}
+	if near := collider.Nearest(mgl.Vec3{0, 0, 0}, 2); near != nil {
+		t.Errorf("expected nothing near the gap; got %s", near)
+	}
+
+	tests := []struct {
+		name     string
+		line     []mgl.Vec3
+		collides bool
+	}{
+		{"Across the gap", []mgl.Vec3{{0, 0, -3}, {0, 0, 3}}, false},
+		{"Across the run before the gap", []mgl.Vec3{{7, 0, -3}, {7, 0, 3}}, true},
+		{"Across the run after the gap", []mgl.Vec3{{-7, 0, -3}, {-7, 0, 3}}, true},
+		{"Out of the arena", []mgl.Vec3{{3, 0, 5}, {3, 0, 12}}, false},
+	}
+	for _, test := range tests {
+		line := test.line
+		err := collider.Track(&line).Update()
+		if test.collides && err == nil {
+			t.Errorf("%s: expected collision", test.name)
+		} else if !test.collides && err != nil {
+			t.Errorf("%s: expected no collision; got %s", test.name, err)
+		}
+	}
+
+	collider.SetWrap(false)
+	line := []mgl.Vec3{{-3, 0, 5}, {-3, 0, 12}}
+	if err := collider.Track(&line).Update(); !errors.Is(err, CollisionBoundary) {
+		t.Errorf("expected collision with the boundary once it doesn't wrap; got %v", err)
+	}
+}
+
+func TestGridWrap(t *testing.T) {
+	wrapTester(t, GridCollider)
+}
+
+func TestLinearWrap(t *testing.T) {
+	wrapTester(t, LinearCollider)
+}
+
+func TestQuadtreeWrap(t *testing.T) {
+	wrapTester(t, QuadtreeCollider)
+}
@@ -14,6 +14,8 @@ const (
 	KeyCamDown
 	KeyLineLeft
 	KeyLineRight
+	KeyLineUp
+	KeyLineDown
 	KeyCameraFollow
 	KeyPause
 	KeyReload
@@ -30,6 +32,8 @@ func DefaultBindings() *Bindings {
 		key.CodeE:          KeyCamDown,
 		key.CodeRightArrow: KeyLineRight,
 		key.CodeLeftArrow:  KeyLineLeft,
+		key.CodeUpArrow:    KeyLineUp,
+		key.CodeDownArrow:  KeyLineDown,
 		key.CodeF:          KeyCameraFollow,
 		key.CodeSpacebar:   KeyPause,
 		key.CodeR:          KeyReload,
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	mgl "github.com/go-gl/mathgl/mgl32"
+	"github.com/shazow/linerage3d/collision"
 	"golang.org/x/mobile/gl"
 )
 
@@ -33,27 +34,81 @@ type Line struct {
 	height    float32
 
 	step        float64
+	boost       float64 // Fraction of step to add on top
 	angle       float64
 	angleBuffer float64
 	offset      int
+
+	// Bounds to wrap around instead of leaving, if set, and where the line
+	// enters again after it reached them.
+	wrap  *collision.Boundary
+	entry *mgl.Vec3
+
+	// Gaps left in the trail, how far the line went since the last one
+	// started or ended, and whether it's in one.
+	gaps      Gaps
+	travelled float32
+	gapping   bool
+
+	// How high the line can fly, or 0 to stay on the floor. While flying, it
+	// gains climb in height per unit travelled, or dives if it's negative.
+	// The head starts a new segment whenever its climb changes.
+	ceiling  float32
+	climb    float32
+	climbing float32
+
+	// Longest a straight segment gets before the head starts a new one, or 0
+	// for no limit, so that the head stays within a few chunks of an endless
+	// arena.
+	split float32
+
+	// Fixed-point movement, so that the same inputs produce bit-identical
+	// segments on every machine.
+	fixed          bool
+	fixedPosition  [2]collision.Fixed
+	fixedDirection [2]collision.Fixed
+}
+
+// Gaps configures how often a line stops drawing its trail for a while,
+// leaving a gap that other lines can slip through. While it's in a gap, only
+// the head of the line is left behind it, which still collides.
+type Gaps struct {
+	// Every is how far the line goes between gaps, or 0 for no gaps.
+	Every float32
+	// Length is how far the line goes in each gap.
+	Length float32
 }
 
 func (line *Line) Reset() {
 	gl.BindBuffer(gl.ARRAY_BUFFER, line.VBO)
 	gl.BufferInit(gl.ARRAY_BUFFER, line.bufSize, gl.DYNAMIC_DRAW)
 
+	line.reset()
+}
+
+// reset restores the line to its starting position, without touching the
+// buffer.
+func (line *Line) reset() {
 	line.height = 1.0
 	line.step = 3.0 // Per second
+	line.boost = 0
 	line.angle = 0
 	line.angleBuffer = 0
 	line.offset = 0
 	line.direction = mgl.Vec3{1, 0, 1} // angle=0
 	line.position = mgl.Vec3{0, 0, 0}
 	line.segments = []mgl.Vec3{line.position}
+	line.entry = nil
+	line.travelled = 0
+	line.gapping = false
+	line.climb = 0
+	line.climbing = 0
+	line.fixedPosition = [2]collision.Fixed{0, 0}
+	line.fixedDirection = [2]collision.Fixed{collision.FixedOne, collision.FixedOne}
 }
 
 func (line *Line) Tick(interval time.Duration, rotate float64) {
-	step := float32(line.step * interval.Seconds())
+	step := float32(line.step * (1 + line.boost) * interval.Seconds())
 
 	line.Add(line.angleBuffer+rotate, step)
 	line.Buffer(line.offset)
@@ -66,17 +121,69 @@ func (line *Line) Add(angle float64, step float32) {
 	turning := math.Abs(line.angleBuffer-line.angle) > 0.1
 	if turning {
 		line.angle = line.angleBuffer
-		sin, cos := math.Sin(line.angle), math.Cos(line.angle)
-		line.direction = mgl.Vec3{float32(cos - sin), 0, float32(sin + cos)}
+		line.aim()
+	}
+
+	// Level out at the floor and the ceiling
+	climb := line.climb
+	if line.ceiling <= 0 || climb < 0 && line.position[1] <= 0 || climb > 0 && line.position[1] >= line.ceiling {
+		climb = 0
+	}
+	if climb != line.climbing {
+		line.climbing = climb
+		turning = true
 	}
 
-	// Normalize and reset height
-	unit := line.direction
-	l := step / unit.Len()
-	unit = mgl.Vec3{unit[0] * l, 0.0, unit[2] * l}
-	line.position = line.position.Add(unit)
+	// Continue from the opposite edge after wrapping around
+	from := line.position
+	wrapped := line.entry != nil
+	if wrapped {
+		from = *line.entry
+		line.entry = nil
+		line.moveTo(from)
+	}
 
-	if !turning && len(line.segments) > 1 {
+	if line.fixed {
+		line.addFixed(step)
+	} else {
+		// Normalize and reset height
+		unit := line.direction
+		l := step / unit.Len()
+		unit = mgl.Vec3{unit[0] * l, 0.0, unit[2] * l}
+		line.position = line.position.Add(unit)
+	}
+	// Climb or dive along the way
+	line.position[1] = mgl.Clamp(from[1]+climb*step, 0, line.ceiling)
+
+	// Stop at the edge, the rest of the trail is a separate run from the
+	// opposite edge
+	if line.wrap != nil {
+		if exit, entry, ok := line.wrap.Wrap(from, line.position); ok {
+			line.moveTo(exit)
+			line.entry = &entry
+		}
+	}
+
+	gap := false
+	if line.gaps.Every > 0 {
+		line.travelled += line.position.Sub(from).Len()
+		if line.gapping && line.travelled >= line.gaps.Length {
+			line.gapping, line.travelled = false, 0
+		} else if !line.gapping && line.travelled >= line.gaps.Every {
+			line.gapping, line.travelled = true, 0
+			gap = true
+		}
+	}
+
+	if wrapped || gap {
+		line.offset = len(line.segments)
+		line.segments = append(line.segments, collision.Break, from, line.position)
+	} else if line.gapping {
+		// Only the head is left behind in a gap, which starts after the break
+		n := len(line.segments)
+		line.segments[n-2], line.segments[n-1] = from, line.position
+		line.offset = n - 3
+	} else if !turning && len(line.segments) > 1 && !line.splits() {
 		// Replace
 		line.segments[len(line.segments)-1] = line.position
 	} else {
@@ -85,6 +192,87 @@ func (line *Line) Add(angle float64, step float32) {
 	}
 }
 
+// splits returns whether the head is long enough to start a new segment,
+// even though the line is going straight.
+func (line *Line) splits() bool {
+	if line.split <= 0 {
+		return false
+	}
+	n := len(line.segments)
+	return line.segments[n-1].Sub(line.segments[n-2]).Len() >= line.split
+}
+
+// aim points the direction along the angle.
+func (line *Line) aim() {
+	if line.fixed {
+		sin, cos := collision.FixedSinCos(collision.FixedAngle(line.angle))
+		line.fixedDirection = [2]collision.Fixed{cos - sin, sin + cos}
+		line.direction = mgl.Vec3{line.fixedDirection[0].Float(), 0, line.fixedDirection[1].Float()}
+	} else {
+		sin, cos := math.Sin(line.angle), math.Cos(line.angle)
+		line.direction = mgl.Vec3{float32(cos - sin), 0, float32(sin + cos)}
+	}
+}
+
+// addFixed moves the position by step along the direction in fixed-point.
+func (line *Line) addFixed(step float32) {
+	// The direction is always sqrt(2) long
+	const invSqrt2 = 46341
+	l := collision.ToFixed(float64(step)).Mul(invSqrt2)
+	line.fixedPosition[0] += line.fixedDirection[0].Mul(l)
+	line.fixedPosition[1] += line.fixedDirection[1].Mul(l)
+	line.position = mgl.Vec3{line.fixedPosition[0].Float(), 0, line.fixedPosition[1].Float()}
+}
+
+// moveTo puts the line at point, without adding to the trail.
+func (line *Line) moveTo(point mgl.Vec3) {
+	line.position = point
+	line.fixedPosition = [2]collision.Fixed{collision.ToFixed(float64(point[0])), collision.ToFixed(float64(point[2]))}
+}
+
+// Crash stops the line at point, which replaces the head of the trail.
+func (line *Line) Crash(point mgl.Vec3) {
+	line.moveTo(point)
+	line.segments[len(line.segments)-1] = point
+	line.Buffer(line.offset)
+}
+
+// Trimmed buffers the whole trail again, after its tracker trimmed points off
+// the front of it.
+func (line *Line) Trimmed() {
+	line.offset = 0
+	line.Buffer(0)
+}
+
+// Bounce reflects the line off a wall with normal at point, which replaces the
+// head of the trail and starts a new segment from there. The point is pulled
+// bounceInset away from the wall first, since where it was hit is rounded and
+// may be just beyond it.
+func (line *Line) Bounce(point, normal mgl.Vec3) {
+	line.bounce(point, normal)
+	line.Buffer(line.offset - 1)
+}
+
+// bounceInset is how far into the arena a bounce continues from.
+const bounceInset = 1e-3
+
+// bounce is Bounce without touching the buffer.
+func (line *Line) bounce(point, normal mgl.Vec3) {
+	d := line.direction
+	d = d.Sub(normal.Mul(2 * d.Dot(normal)))
+	// The direction is 45 degrees ahead of the angle
+	line.angle = math.Atan2(float64(d[2]), float64(d[0])) - math.Pi/4
+	line.angleBuffer = line.angle
+	line.aim()
+
+	point = point.Add(normal.Mul(bounceInset))
+	line.moveTo(point)
+	n := len(line.segments)
+	line.segments[n-1] = point
+	line.segments = append(line.segments, point)
+	line.offset = n
+}
+
 // Vector interface:
 
 func (vec *Line) Position() mgl.Vec3 {
@@ -116,15 +304,28 @@ func (shape *Line) BytesOffset(n int) []byte {
 	quad := [6]float32{}
 	buf := bytes.Buffer{}
 
+	// Walls stand on the points of the trail
 	var s mgl.Vec3
 	var bot, top float32 = 0.0, shape.height
 
 	for i := n; i < len(shape.segments); i++ {
 		s = shape.segments[i]
 
+		if collision.IsBreak(s) {
+			// Join the runs on either side with degenerate triangles, which
+			// aren't drawn
+			prev, next := shape.segments[i-1], shape.segments[i+1]
+			quad = [6]float32{
+				prev[0], prev[1] + top, prev[2],
+				next[0], next[1] + bot, next[2],
+			}
+			binary.Write(&buf, binary.LittleEndian, quad)
+			continue
+		}
+
 		quad = [6]float32{
-			s[0], bot, s[2], // Bottom Right
-			s[0], top, s[2], // Top Right
+			s[0], s[1] + bot, s[2], // Bottom Right
+			s[0], s[1] + top, s[2], // Top Right
 		}
 		binary.Write(&buf, binary.LittleEndian, quad)
 	}
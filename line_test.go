@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+	"github.com/shazow/linerage3d/collision"
+)
+
+// replayLine steers a fixed-point line with a pseudo-random input stream like
+// Tick does, until it crashes or runs out of ticks, and returns a hash of its
+// segments along with the tick it crashed on.
+func replayLine(seed int64, ticks int) (string, int) {
+	line := &Line{fixed: true}
+	line.reset()
+
+	collider := collision.GridCollider(image.Rect(-50, -50, 50, 50))
+	collider.SetReproducible(true)
+	tracker := collider.Track(&line.segments)
+
+	rng := rand.New(rand.NewSource(seed))
+	step := float32(line.step / 60)
+	crashed := -1
+	for i := 0; i < ticks; i++ {
+		rotate := float64(rng.Intn(3)-1) * turnSpeed
+		line.Add(line.angleBuffer+rotate, step)
+		if err := tracker.Update(); err != nil {
+			crashed = i
+			break
+		}
+	}
+
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, line.segments)
+	return fmt.Sprintf("%x", h.Sum(nil)), crashed
+}
+
+func TestLineReplay(t *testing.T) {
+	hash, crashed := replayLine(42, 5000)
+	if again, crashedAgain := replayLine(42, 5000); again != hash || crashedAgain != crashed {
+		t.Errorf("replay diverged: %s at tick %d; then %s at tick %d", hash, crashed, again, crashedAgain)
+	}
+	if other, _ := replayLine(43, 5000); other == hash {
+		t.Errorf("expected different inputs to produce a different trail")
+	}
+
+	// Fixed-point trails are the same on every machine
+	const expectHash, expectCrashed = "4ca692ed4987cd71b3d77a46c670e662baf2c79018be5ba835b4e27f670bca43", 1579
+	if hash != expectHash || crashed != expectCrashed {
+		t.Errorf("expected %s at tick %d; got %s at tick %d", expectHash, expectCrashed, hash, crashed)
+	}
+}
+
+func TestLineWrap(t *testing.T) {
+	line := &Line{height: 1}
+	line.reset()
+	line.wrap = &collision.Boundary{X1: -10, Y1: -10, X2: 10, Y2: 10}
+
+	collider := collision.GridCollider(image.Rect(-10, -10, 10, 10))
+	collider.SetWrap(true)
+	tracker := collider.Track(&line.segments)
+
+	// Straight through the corner, which wraps to the opposite corner
+	for i := 0; line.entry == nil; i++ {
+		if i > 100 {
+			t.Fatalf("expected line to reach the edge; got %v", line.position)
+		}
+		line.Add(0, 1)
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("expected no collision before wrapping; got %s", err)
+		}
+	}
+	if line.position != (mgl.Vec3{10, 0, 10}) || *line.entry != (mgl.Vec3{-10, 0, -10}) {
+		t.Fatalf("expected to wrap from 10,10 to -10,-10; got %v to %v", line.position, *line.entry)
+	}
+
+	line.Add(0, 1)
+	n := len(line.segments)
+	if !collision.IsBreak(line.segments[n-3]) || line.segments[n-2] != (mgl.Vec3{-10, 0, -10}) || line.offset != n-3 {
+		t.Fatalf("expected a break and a new run from the opposite corner; got %v", line.segments[n-4:])
+	}
+	if err := tracker.Update(); err != nil {
+		t.Fatalf("expected no collision after wrapping; got %s", err)
+	}
+
+	// The gap is drawn as degenerate triangles
+	var vertices [8 * 3]float32
+	binary.Read(bytes.NewReader(line.BytesOffset(n-4)), binary.LittleEndian, &vertices)
+	prevTop, breakTop := vertices[3:6], vertices[6:9]
+	breakBottom, nextBottom := vertices[9:12], vertices[12:15]
+	if !reflect.DeepEqual(prevTop, breakTop) || !reflect.DeepEqual(breakBottom, nextBottom) {
+		t.Errorf("expected break to repeat the vertices beside it; got %v", vertices)
+	}
+
+	// The second run heads into the start of the first one
+	for i := 0; i < 20; i++ {
+		line.Add(0, 1)
+		if err := tracker.Update(); err != nil {
+			impact, _ := collision.Impact(err)
+			if !impact.Point.ApproxEqual(mgl.Vec3{0, 0, 0}) {
+				t.Errorf("expected collision with the start of the trail; got %s", err)
+			}
+			return
+		}
+	}
+	t.Errorf("expected collision with the start of the trail; got %v", line.position)
+}
+
+func TestLineBounce(t *testing.T) {
+	line := &Line{}
+	line.reset()
+
+	collider := collision.GridCollider(image.Rect(-10, -10, 10, 10))
+	tracker := collider.Track(&line.segments)
+
+	line.Add(0.3, 1)
+	bounces := 0
+	for i := 0; bounces < 3; i++ {
+		if i > 100 {
+			t.Fatalf("expected 3 bounces; got %d", bounces)
+		}
+		line.Add(line.angleBuffer, 1)
+		err := tracker.Update()
+		if err == nil {
+			continue
+		}
+		edge, ok := err.(*collision.CollisionEdge)
+		if !ok {
+			t.Fatalf("expected to only hit the edge; got %s", err)
+		}
+
+		before := line.direction
+		line.bounce(edge.Point, edge.Normal)
+		bounces++
+
+		// Mirrored along the normal, and the same along the edge
+		if !mgl.FloatEqualThreshold(before.Dot(edge.Normal), -line.direction.Dot(edge.Normal), 1e-5) ||
+			!before.Cross(edge.Normal).ApproxEqualThreshold(line.direction.Cross(edge.Normal), 1e-5) {
+			t.Errorf("expected %v to bounce off %v; got %v", before, edge.Normal, line.direction)
+		}
+		// A little way back from the edge
+		point := edge.Point.Add(edge.Normal.Mul(bounceInset))
+		n := len(line.segments)
+		if line.segments[n-1] != point || line.segments[n-2] != point || line.position != point {
+			t.Errorf("expected the trail to continue from the bounce at %v; got %v", point, line.segments[n-3:])
+		}
+	}
+}
+
+func TestLineBounceOutline(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		outline *collision.Outline
+		radius  float32
+	}{
+		{"hexagon", hexagonArena, 0},
+		{"thick in a hexagon", hexagonArena, lineRadius},
+		{"ring", ringArena, 0},
+		{"thick in a ring", ringArena, lineRadius},
+	} {
+		line := &Line{}
+		line.reset()
+		start := mgl.Vec3{8, 0, 0}
+		line.moveTo(start)
+		line.segments = []mgl.Vec3{start}
+
+		collider := collision.LinearCollider(test.outline.Bounds())
+		collider.SetOutline(test.outline)
+		tracker := collider.TrackRadius(&line.segments, test.radius)
+
+		// Wandering around for many bounces, which all stay inside
+		rng := rand.New(rand.NewSource(1))
+		bounces := 0
+		for i := 0; bounces < 200; i++ {
+			if i > 20000 {
+				t.Fatalf("%s: expected 200 bounces; got %d", test.name, bounces)
+			}
+			line.Add(line.angleBuffer+float64(rng.Intn(3)-1)*turnSpeed, 0.5)
+			if err := tracker.Update(); err != nil {
+				edge, ok := err.(*collision.CollisionEdge)
+				if !ok || edge.Normal == (mgl.Vec3{}) {
+					t.Fatalf("%s: expected to bounce off the edge after %d bounces; got %s", test.name, bounces, err)
+				}
+				line.bounce(edge.Point, edge.Normal)
+				bounces++
+			}
+			// Only the head, so that the line never runs into its own trail
+			tracker.Trim(len(line.segments) - 2)
+		}
+	}
+}
+
+func TestLineGaps(t *testing.T) {
+	line := &Line{}
+	line.reset()
+	line.gaps = Gaps{Every: 3, Length: 1}
+
+	collider := collision.GridCollider(image.Rect(-10, -10, 10, 10))
+	tracker := collider.Track(&line.segments)
+
+	// Straight ahead through two gaps
+	for i := 0; i < 36; i++ {
+		line.Add(0, 0.25)
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("expected no collision; got %s", err)
+		}
+		if n := len(line.segments); line.gapping && !collision.IsBreak(line.segments[n-3]) {
+			t.Fatalf("expected only the head after the break in a gap; got %v", line.segments)
+		}
+	}
+
+	var runs [][]mgl.Vec3
+	run := []mgl.Vec3{}
+	for _, p := range line.segments {
+		if collision.IsBreak(p) {
+			runs = append(runs, run)
+			run = []mgl.Vec3{}
+			continue
+		}
+		run = append(run, p)
+	}
+	runs = append(runs, run)
+	if len(runs) != 3 {
+		t.Fatalf("expected 3 runs; got %v", runs)
+	}
+	// Within a step of the configured lengths
+	for i, run := range runs[:2] {
+		length := run[len(run)-1].Sub(run[0]).Len()
+		gap := runs[i+1][0].Sub(run[len(run)-1]).Len()
+		if i == 0 && (length < 3-0.25 || length > 3+0.25) {
+			t.Errorf("expected first run to be 3 long; got %v", length)
+		}
+		if gap < 1-0.25 || gap > 1+0.25 {
+			t.Errorf("expected gap %d to be 1 long; got %v", i, gap)
+		}
+	}
+
+	// Another line slips through the first gap, 3.5 along the line
+	across := []mgl.Vec3{{4.95, 0, 0}, {0, 0, 4.95}}
+	if err := collider.Track(&across).Update(); err != nil {
+		t.Errorf("expected to slip through the gap; got %s", err)
+	}
+}
+
+func TestLineSplit(t *testing.T) {
+	line := &Line{}
+	line.reset()
+	line.split = 4
+
+	collider := collision.ChunkedCollider(collision.ChunkOptions{Size: 4, Keep: 1})
+	tracker := collider.Track(&line.segments)
+	trimmed := 0
+	collider.Subscribe(func(event collision.Event) {
+		if event.Kind == collision.EventTrimmed {
+			trimmed++
+		}
+	})
+
+	// Straight ahead for a long way, in segments of up to a step over 4
+	for i := 0; i < 400; i++ {
+		line.Add(0, 0.5)
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("expected no collision; got %s", err)
+		}
+		for j := 1; j < len(line.segments); j++ {
+			if length := line.segments[j].Sub(line.segments[j-1]).Len(); length > 4.5 {
+				t.Fatalf("expected the trail to split; got a segment %v long", length)
+			}
+		}
+	}
+
+	// The trail left behind in dropped chunks is trimmed off
+	if trimmed == 0 || len(line.segments) > 10 {
+		t.Errorf("expected the trail to be trimmed behind the line; got %d trims and %d points", trimmed, len(line.segments))
+	}
+}
+
+func TestLineFlying(t *testing.T) {
+	line := &Line{height: 1}
+	line.reset()
+	line.ceiling = 2
+
+	// Climbing starts a new segment, and levels out at the ceiling
+	line.climb = 1
+	var heights []float32
+	for i := 0; i < 4; i++ {
+		line.Add(0, 1)
+		heights = append(heights, line.position[1])
+	}
+	if !reflect.DeepEqual(heights, []float32{1, 2, 2, 2}) {
+		t.Errorf("expected to climb up to the ceiling; got %v", heights)
+	}
+	if n := len(line.segments); n != 3 || line.segments[1][1] != 2 {
+		t.Errorf("expected a climbing segment and a level one; got %v", line.segments)
+	}
+
+	// Walls stand on the points of the trail
+	var vertices [3 * 2 * 3]float32
+	binary.Read(bytes.NewReader(line.BytesOffset(0)), binary.LittleEndian, &vertices)
+	if bottom, top := vertices[7], vertices[10]; bottom != 2 || top != 3 {
+		t.Errorf("expected the wall from 2 to 3; got %v to %v", bottom, top)
+	}
+
+	// Diving levels out at the floor
+	line.climb = -1
+	for i := 0; i < 4; i++ {
+		line.Add(0, 1)
+	}
+	if line.position[1] != 0 || line.climbing != 0 {
+		t.Errorf("expected to level out on the floor; got %v", line.position)
+	}
+
+	// Flying over a trail, which is in the way when staying low
+	for _, climb := range []float32{1, 0} {
+		line.reset()
+		line.ceiling, line.climb = 3, climb
+		collider := collision.GridCollider(image.Rect(-10, -10, 10, 10))
+		collider.SetWallHeight(line.height)
+		wall := []mgl.Vec3{{4, 0, -10}, {4, 0, 10}}
+		collider.Track(&wall).Update()
+		tracker := collider.Track(&line.segments)
+
+		var err error
+		for i := 0; i < 12 && err == nil; i++ {
+			line.Add(0, 1)
+			err = tracker.Update()
+		}
+		if hit := err != nil; hit != (climb == 0) {
+			t.Errorf("climbing %v: expected collision %v; got %v", climb, climb == 0, err)
+		}
+	}
+}
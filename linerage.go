@@ -3,6 +3,8 @@ package main
 import (
 	"image"
 	"log"
+	"os"
+	"path/filepath"
 	"time"
 
 	mgl "github.com/go-gl/mathgl/mgl32"
@@ -31,6 +33,64 @@ type lineShader struct {
 
 const turnSpeed = 0.1
 
+// Grinding is skimming close to a trail without hitting it, which is rewarded
+// with score and a speed boost that grows the closer we get.
+const grindRadius = 0.6
+const grindBoost = 0.5
+
+// How far ahead of the line to look for danger.
+const lookAhead = 20.0
+
+// Move lines in fixed-point, so that the same steps produce bit-identical
+// trails on every machine, and collide lines without a radius in fixed-point,
+// see Collider.SetReproducible. Lines are lineRadius thick, and steps still
+// follow the wall clock and grinding, so this alone doesn't make replays or
+// lockstep multiplayer agree.
+const reproducible = false
+
+// How far either side of its trail a line collides, which is about as wide as
+// the trail and the head look from behind the line.
+const lineRadius = 0.1
+
+// Shape of the arena, such as hexagonArena, ringArena or crossArena. The
+// default is a square.
+var arenaOutline *collision.Outline
+
+// Wrap lines around the edges of the default square arena, instead of
+// crashing into them.
+const wraparound = false
+
+// How far lines go between gaps in their trails, which other lines can slip
+// through, and how long the gaps are. No gaps if gapEvery is 0.
+const gapEvery = 0.0
+const gapLength = 1.0
+
+// Bounce off the edges of the arena, instead of crashing into them.
+const bounce = false
+
+// Claim the territory enclosed by closing a loop with the line's own trail,
+// instead of crashing into it, scoring territoryScore for each unit of area.
+const claimTerritory = false
+const territoryScore = 0.1
+
+// Fly over and under trails, climbing and diving up to flyCeiling, instead of
+// staying on the floor. Trails are walls of the line's height, which only
+// collide where the walls overlap.
+const flyCeiling = 0.0
+const climbRate = 0.5
+
+// How lines which run into each other in the same tick are resolved, see
+// collision.TickRule.
+const headOnRule = collision.TickCrashBoth
+
+// Play in an endless arena instead, made of chunks arenaChunk across. Chunks
+// far from the line are dropped, along with the trail in them.
+const endlessArena = false
+const arenaChunk = 16.0
+
+// Obstacles in the arena, such as pillarObstacles. The default is none.
+var arenaObstacles []*collision.Obstacle
+
 type linerageWorld struct {
 	scene    Scene
 	bindings *Bindings
@@ -39,6 +99,9 @@ type linerageWorld struct {
 	arena   *arena
 	line    *Line
 	emitter Emitter
+	score   float64
+
+	territory *territory
 }
 
 func LinerageWorld(scene Scene, bindings *Bindings, shaders Shaders) (World, error) {
@@ -60,6 +123,9 @@ func LinerageWorld(scene Scene, bindings *Bindings, shaders Shaders) (World, err
 
 	// Make line
 	line := NewLine(shaders.Get("line"), 2*4*100000)
+	line.fixed = reproducible
+	line.gaps = Gaps{Every: gapEvery, Length: gapLength}
+	line.ceiling = flyCeiling
 	line.Buffer(0)
 	scene.Add(line)
 
@@ -90,10 +156,57 @@ func LinerageWorld(scene Scene, bindings *Bindings, shaders Shaders) (World, err
 		scene.Add(NewFloor(shaders.Get("line"), line))
 	*/
 
-	arena := NewArenaNode(image.Rect(-10, -10, 10, 10), shaders.Get("line"))
+	var arena *arena
+	if endlessArena {
+		arena = NewChunkedArenaNode(collision.ChunkOptions{Size: arenaChunk}, shaders.Get("line"))
+		line.split = arenaChunk
+	} else if arenaOutline != nil {
+		arena = NewOutlineArenaNode(arenaOutline, shaders.Get("line"))
+	} else {
+		bounds := image.Rect(-10, -10, 10, 10)
+		arena = NewArenaNode(bounds, shaders.Get("line"))
+		if wraparound {
+			arena.SetWrap(true)
+			line.wrap = &collision.Boundary{
+				X1: float32(bounds.Min.X), Y1: float32(bounds.Min.Y),
+				X2: float32(bounds.Max.X), Y2: float32(bounds.Max.Y),
+			}
+		}
+	}
+	arena.SetObstacles(arenaObstacles)
+	arena.SetReproducible(reproducible)
+	if flyCeiling > 0 {
+		arena.SetWallHeight(line.height)
+	}
 	scene.Add(arena)
 
-	tracker := arena.Track(&line.segments)
+	claimed := NewTerritoryNode(shaders.Get("line"))
+	scene.Add(claimed)
+
+	world := &linerageWorld{
+		scene:    scene,
+		bindings: bindings,
+
+		tracker: arena.TrackRadius(&line.segments, lineRadius),
+		arena:   arena,
+		line:    line,
+		emitter: emitter,
+
+		territory: claimed,
+	}
+
+	// Burst where the line hits anything, whether it crashes or carries on
+	arena.Subscribe(func(event collision.Event) {
+		switch event.Kind {
+		case collision.EventTrimmed:
+			// The arena dropped the chunks behind the line
+			if event.ID == world.tracker.ID() {
+				world.line.Trimmed()
+			}
+		default:
+			emitter.MoveTo(event.Point)
+		}
+	})
 
 	bindings.On(KeyReload, func(_ KeyBinding) {
 		log.Println("Reloading shaders.")
@@ -106,23 +219,23 @@ func LinerageWorld(scene Scene, bindings *Bindings, shaders Shaders) (World, err
 	bindings.On(KeyDebug, func(_ KeyBinding) {
 		log.Println("Segment: ", line.segments)
 		log.Println(arena.Collider.String())
+		log.Println("Ahead: ", world.tracker.Raycast(line.direction, lookAhead))
+		if path, err := arena.SavePicture(filepath.Join(os.TempDir(), "linerage3d-collision")); err != nil {
+			log.Println("Picture error:", err)
+		} else {
+			log.Println("Picture: ", path)
+		}
 	})
 
-	return &linerageWorld{
-		scene:    scene,
-		bindings: bindings,
-
-		tracker: tracker,
-		arena:   arena,
-		line:    line,
-		emitter: emitter,
-	}, err
+	return world, err
 }
 
 func (world *linerageWorld) Reset() {
 	world.line.Reset()
 	world.arena.Reset()
-	world.tracker = world.arena.Track(&world.line.segments)
+	world.territory.Reset()
+	world.score = 0
+	world.tracker = world.arena.TrackRadius(&world.line.segments, lineRadius)
 }
 
 func (world *linerageWorld) Focus() Vector {
@@ -139,6 +252,14 @@ func (world *linerageWorld) Tick(interval time.Duration) error {
 		lineRotate += turnSpeed
 	}
 
+	world.line.climb = 0
+	if world.bindings.Pressed(KeyLineUp) {
+		world.line.climb += climbRate
+	}
+	if world.bindings.Pressed(KeyLineDown) {
+		world.line.climb -= climbRate
+	}
+
 	// Spinny!
 	//rotation := mgl.HomogRotate3D(float32(since.Seconds()), AxisFront)
 	//world.scene.transform = &rotation
@@ -147,15 +268,54 @@ func (world *linerageWorld) Tick(interval time.Duration) error {
 	world.emitter.MoveTo(world.line.position)
 	world.emitter.Tick(interval)
 
+	world.arena.Follow(world.line.segments)
+
 	var err error
-	err = world.tracker.Update()
+	err = world.arena.UpdateTick([]collision.Tracker{world.tracker}, headOnRule)[0]
+	if edge, ok := err.(*collision.CollisionEdge); ok && bounce && edge.Normal != (mgl.Vec3{}) {
+		// Nothing was hit before the edge, so carry on from there
+		world.line.Bounce(edge.Point, edge.Normal)
+		return nil
+	}
+	if hit, ok := err.(*collision.CollisionSegment); ok && claimTerritory {
+		if enclosure, ok := collision.Enclose(world.line.segments, hit); ok {
+			world.claim(enclosure)
+			return nil
+		}
+	}
 	if err != nil {
+		if impact, ok := collision.Impact(err); ok {
+			// Move the camera focus to where we died
+			world.line.Crash(impact.Point)
+		}
+
 		n := len(world.line.segments) - 4
 		if n < 0 {
 			n = 0
 		}
 		log.Printf("Collision with %s\n\tLast segments: %v", err, world.line.segments[n:])
+		log.Printf("Score: %0.2f", world.score)
+		return err
+	}
+
+	world.line.boost = 0
+	if near := world.tracker.Near(grindRadius); near != nil {
+		closeness := 1 - near.Distance/grindRadius
+		world.score += float64(closeness) * interval.Seconds()
+		world.line.boost = float64(closeness) * grindBoost
 	}
 
-	return err
+	return nil
+}
+
+// claim scores the enclosed territory which wasn't claimed already, and trims
+// the whole trail behind the head off, loop and all, so that the line carries
+// on from there.
+func (world *linerageWorld) claim(enclosure *collision.Enclosure) {
+	area := world.territory.Claim(enclosure)
+	world.score += float64(area) * territoryScore
+	log.Printf("Claimed %0.2f, %0.2f in total", area, world.territory.claimed)
+
+	world.tracker.Trim(len(world.line.segments) - 2)
+	world.line.Trimmed()
 }
@@ -20,6 +20,10 @@ import (
 const mouseSensitivity = 0.01
 const moveSpeed = 0.1
 
+// The camera jumps rather than sweeps to follow the focus further than this
+// in one frame, such as when it wraps around the arena.
+const followJump = 5.0
+
 type Point struct {
 	X, Y float32
 }
@@ -41,6 +45,7 @@ type Engine struct {
 	gameover     bool
 	following    bool
 	followOffset mgl.Vec3
+	followPos    mgl.Vec3
 }
 
 func (e *Engine) Start() {
@@ -141,8 +146,13 @@ func (e *Engine) Draw(c config.Event) {
 		e.camera.Move(camDelta)
 	} else if e.following {
 		pos := e.world.Focus().Position()
-		e.camera.Lerp(pos.Add(e.followOffset), pos, 0.1)
+		amount := float32(0.1)
+		if pos.Sub(e.followPos).Len() > followJump {
+			amount = 1
+		}
+		e.camera.Lerp(pos.Add(e.followOffset), pos, amount)
 	}
+	e.followPos = e.world.Focus().Position()
 
 	gl.ClearColor(0, 0, 0, 1)
 	//gl.Clear(gl.COLOR_BUFFER_BIT)
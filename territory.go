@@ -0,0 +1,142 @@
+package main
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl32"
+	"golang.org/x/mobile/gl"
+
+	"github.com/shazow/linerage3d/collision"
+)
+
+// Height of claimed territory above the arena floor, so that it's drawn over
+// it.
+const territoryHeight = 0.01
+
+// Pieces of territory smaller than this are slivers left over from claiming
+// around territory that was already claimed, and are dropped.
+const minPieceArea = 1e-6
+
+func NewTerritoryNode(shader Shader) *territory {
+	shape := NewStaticShape()
+	return &territory{
+		Node: &Node{
+			Shape:  shape,
+			shader: shader,
+		},
+		shape: shape,
+	}
+}
+
+// territory is the floor claimed by enclosing it with a line's own trail.
+type territory struct {
+	*Node
+	shape *StaticShape
+
+	// Area claimed so far.
+	claimed float32
+	// Convex pieces of the claimed territory, counter-clockwise, which don't
+	// overlap.
+	pieces [][]mgl.Vec2
+}
+
+// Claim adds the enclosed area to the territory, and returns how much of it
+// wasn't claimed already.
+func (t *territory) Claim(enclosure *collision.Enclosure) float32 {
+	area := t.claim(enclosure)
+	t.shape.Buffer()
+	return area
+}
+
+// claim is Claim without touching the buffer.
+func (t *territory) claim(enclosure *collision.Enclosure) float32 {
+	claimed := t.pieces
+	var area float64
+	for _, tri := range clipEars(enclosure.Points) {
+		pieces := [][]mgl.Vec2{{tri[0], tri[1], tri[2]}}
+		for _, other := range claimed {
+			pieces = subtractConvex(pieces, other)
+		}
+		for _, piece := range pieces {
+			// As a fan of triangles
+			for i := 2; i < len(piece); i++ {
+				for _, p := range []mgl.Vec2{piece[0], piece[i-1], piece[i]} {
+					t.shape.vertices = append(t.shape.vertices, p[0], territoryHeight, p[1])
+				}
+			}
+			area += polygonArea(piece)
+		}
+		t.pieces = append(t.pieces, pieces...)
+	}
+	t.claimed += float32(area)
+	return float32(area)
+}
+
+// Reset clears all the claimed territory.
+func (t *territory) Reset() {
+	t.shape.vertices = nil
+	t.claimed = 0
+	t.pieces = nil
+}
+
+// subtractConvex returns what's left of the convex pieces outside of the
+// convex polygon clip, as more convex pieces. All of them are
+// counter-clockwise.
+func subtractConvex(pieces [][]mgl.Vec2, clip []mgl.Vec2) [][]mgl.Vec2 {
+	var left [][]mgl.Vec2
+	for _, piece := range pieces {
+		// Peel off what's outside of each edge of clip in turn, until only
+		// what's inside of all of them is left, which is dropped
+		for i, a := range clip {
+			var outside []mgl.Vec2
+			outside, piece = splitConvex(piece, a, clip[(i+1)%len(clip)])
+			if len(outside) >= 3 && polygonArea(outside) > minPieceArea {
+				left = append(left, outside)
+			}
+			if len(piece) < 3 {
+				break
+			}
+		}
+	}
+	return left
+}
+
+// splitConvex splits a convex polygon along the line through a and b, into
+// the part to the right of it and the part to the left of it.
+func splitConvex(poly []mgl.Vec2, a, b mgl.Vec2) (right, left []mgl.Vec2) {
+	for i, p := range poly {
+		q := poly[(i+1)%len(poly)]
+		sp, sq := cross2(a, b, p), cross2(a, b, q)
+		if sp <= 0 {
+			right = append(right, p)
+		}
+		if sp >= 0 {
+			left = append(left, p)
+		}
+		if sp < 0 && sq > 0 || sp > 0 && sq < 0 {
+			// Crossing over to the other side
+			x := p.Add(q.Sub(p).Mul(sp / (sp - sq)))
+			right = append(right, x)
+			left = append(left, x)
+		}
+	}
+	return right, left
+}
+
+// polygonArea returns the area within points, which is negative if they're
+// clockwise.
+func polygonArea(points []mgl.Vec2) float64 {
+	var area float64
+	for i, a := range points {
+		b := points[(i+1)%len(points)]
+		area += float64(a[0]*b[1] - b[0]*a[1])
+	}
+	return area / 2
+}
+
+func (t *territory) Draw(camera Camera) {
+	shader := t.shader
+	gl.Uniform3fv(shader.Uniform("material.ambient"), []float32{0.05, 0.1, 0.3})
+	gl.Uniform3fv(shader.Uniform("lights[0].color"), []float32{0.1, 0.1, 0.2})
+	gl.Uniform1f(shader.Uniform("lights[0].intensity"), 0.3)
+
+	t.Node.Draw(camera)
+}
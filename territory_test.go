@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	mgl "github.com/go-gl/mathgl/mgl32"
+
+	"github.com/shazow/linerage3d/collision"
+)
+
+func TestTerritoryClaim(t *testing.T) {
+	shape := &StaticShape{}
+	territory := &territory{Node: &Node{Shape: shape}, shape: shape}
+
+	// Overlapping what was claimed before only adds the rest
+	tests := []struct {
+		enclosure *collision.Enclosure
+		added     float64
+	}{
+		{&collision.Enclosure{Points: []mgl.Vec2{{0, 0}, {4, 0}, {4, 4}, {0, 4}}, Area: 16}, 16},
+		{&collision.Enclosure{Points: []mgl.Vec2{{-2, 0}, {0, -2}, {2, 0}, {0, 2}, {0, 1}, {-1, 1}}, Area: 7.5}, 5.5},
+		{&collision.Enclosure{Points: []mgl.Vec2{{2, 2}, {6, 2}, {6, 6}, {2, 6}}, Area: 16}, 12},
+		{&collision.Enclosure{Points: []mgl.Vec2{{0, 0}, {4, 0}, {4, 4}, {0, 4}}, Area: 16}, 0},
+	}
+	var expected float64
+	for i, test := range tests {
+		if added := territory.claim(test.enclosure); math.Abs(float64(added)-test.added) > 1e-4 {
+			t.Errorf("claim #%d: expected %v added; got %v", i, test.added, added)
+		}
+		expected += test.added
+	}
+
+	vertices := shape.vertices
+	if len(vertices)%9 != 0 {
+		t.Fatalf("expected whole triangles; got %d floats", len(vertices))
+	}
+	var area float64
+	for i := 0; i < len(vertices); i += 9 {
+		for j := i + 1; j < i+9; j += 3 {
+			if vertices[j] != territoryHeight {
+				t.Errorf("expected triangle over the floor; got height %v", vertices[j])
+			}
+		}
+		area += polygonArea([]mgl.Vec2{{vertices[i], vertices[i+2]}, {vertices[i+3], vertices[i+5]}, {vertices[i+6], vertices[i+8]}})
+	}
+	if math.Abs(area-expected) > 1e-4 {
+		t.Errorf("expected area %v; got %v", expected, area)
+	}
+	if math.Abs(float64(territory.claimed)-expected) > 1e-4 {
+		t.Errorf("expected %v claimed; got %v", expected, territory.claimed)
+	}
+
+	territory.Reset()
+	if shape.Len() != 0 || territory.claimed != 0 || len(territory.pieces) != 0 {
+		t.Errorf("expected no territory after reset; got %d vertices, %v claimed", shape.Len(), territory.claimed)
+	}
+}